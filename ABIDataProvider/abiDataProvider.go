@@ -1,106 +1,74 @@
 package ABIDataProvider
 
 import (
-	"database/sql"
+	"carHiringWebsite/data"
 	"errors"
-	"fmt"
-	"io/ioutil"
-	"os"
-	"strings"
+	"log"
 	"time"
-
-	_ "github.com/mattn/go-adodb"
 )
 
 var (
-	conn            *sql.DB
+	// Kind selects the Provider, db to check against data imported into our database or access to query
+	// an Access database directly, which is only available on Windows. Set from flags in main
+	Kind *string
+
 	FraudulentClaim = errors.New("fraudulentClaim")
+	InvalidDatabase = errors.New("invalid ABI database")
+	UnknownProvider = errors.New("unknown ABI provider")
+	NoDataset       = errors.New("no ABI dataset loaded")
+
+	provider Provider
+
+	// providers are the backends built into this binary, access registers itself on Windows
+	providers = map[string]func() (Provider, error){
+		"db": newDBProvider,
+	}
 )
 
+// Provider checks drivers against the ABI fraudulent claims register
+type Provider interface {
+	// Candidates returns the claims that could belong to a driver born on DOB or living at postcode,
+	// which is upper case without spaces. They are scored by MatchClaims
+	Candidates(DOB time.Time, postcode string) ([]*data.InsurerColumn, error)
+	// Extension is the file type datasets for the provider are uploaded as
+	Extension() string
+	// Validate checks content is a usable dataset without loading it
+	Validate(name string, content []byte) (*data.ImportReport, error)
+	// Activate loads content as the dataset checks are made against
+	Activate(content []byte) error
+}
+
 func InitProvider() error {
-	var err error
 
-	files, err := ioutil.ReadDir("./ABIfiles/")
+	err := checkThresholds()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
 		return err
 	}
 
-	var modTime time.Time
-	var names []string
-	for _, fi := range files {
-
-		filename := strings.Split(fi.Name(), ".")
-		fileType := filename[len(filename)-1]
-		if fileType != "accdb" {
-			continue
-		}
-
-		if fi.Mode().IsRegular() {
-			if !fi.ModTime().Before(modTime) {
-				if fi.ModTime().After(modTime) {
-					modTime = fi.ModTime()
-					names = names[:0]
-				}
-				names = append(names, fi.Name())
-			}
-		}
+	constructor, ok := providers[*Kind]
+	if !ok {
+		return UnknownProvider
 	}
 
-	conn, err = sql.Open("adodb", "Provider=Microsoft.ACE.OLEDB.12.0;Data Source=./ABIfiles/"+names[0])
+	newProvider, err := constructor()
 	if err != nil {
 		return err
 	}
-	conn.SetMaxOpenConns(8)
-	conn.SetMaxIdleConns(8)
-	conn.SetConnMaxLifetime(5 * time.Minute)
+	provider = newProvider
+
+	log.Printf("ABI checks made using %v provider", *Kind)
 
 	return nil
 }
 
-func HasFraudulentClaim(lastName, firstNames, address, postcode string, DOB time.Time) (bool, error) {
-
-	postcode = strings.ToLower(postcode)
-	address = strings.ToLower(address)
-
-	row := conn.QueryRow(`SELECT Count(*) FROM fraudulent_claim_data WHERE
-								LCASE(TRIM(LEFT(ADDRESS_OF_CLAIM,InStr(ADDRESS_OF_CLAIM, ",") - 1))) = ? AND
-								StrReverse(LCASE(TRIM(LEFT(StrReverse(ADDRESS_OF_CLAIM),InStr(StrReverse(ADDRESS_OF_CLAIM), ",") - 1)))) = ? AND
-								FAMILY_NAME = ? AND 
-								FORENAMES = ? AND 
-								DATE_OF_BIRTH = ?`, address, postcode, lastName, firstNames, DOB.Format("02/01/2006"))
-
-	rows := 0
-	err := row.Scan(&rows)
-	if err != nil {
-		return false, err
-	}
+func Extension() string {
+	return provider.Extension()
+}
 
-	return rows > 0, nil
+func Validate(name string, content []byte) (*data.ImportReport, error) {
+	return provider.Validate(name, content)
+}
 
-	//dataList := make([]*data.InsurerColumn, 0)
-	//
-	//var (
-	//	dob time.Time
-	//	doc time.Time
-	//)
-	//
-	//count := 0
-	//for rows.Next() {
-	//
-	//	insurerData := &data.InsurerColumn{}
-	//	dataList = append(dataList, insurerData)
-	//
-	//	err := rows.Scan(&insurerData.ID, &insurerData.LastName, &insurerData.FisrtName, &dob, &insurerData.Address, &doc, &insurerData.InsurerCode)
-	//	if err != nil {
-	//		return nil, err
-	//	}
-	//
-	//	insurerData.DOB = *data.ConvertDate(dob)
-	//	insurerData.DOC = *data.ConvertDate(doc)
-	//
-	//	count++
-	//}
-	//
-	//dataList = dataList[:count]
+func Activate(content []byte) error {
+	return provider.Activate(content)
 }
@@ -0,0 +1,206 @@
+//go:build windows
+// +build windows
+
+package ABIDataProvider
+
+import (
+	"bytes"
+	"carHiringWebsite/data"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-adodb"
+)
+
+const accessDir = "./ABIfiles/"
+
+func init() {
+	providers["access"] = newAccessProvider
+}
+
+// accessProvider queries the newest .accdb in ABIfiles through the Microsoft ACE OLEDB provider
+type accessProvider struct {
+	conn     *sql.DB
+	connLock sync.RWMutex
+}
+
+func newAccessProvider() (Provider, error) {
+
+	ap := &accessProvider{}
+
+	err := ap.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return ap, nil
+}
+
+func (ap *accessProvider) open() error {
+
+	files, err := ioutil.ReadDir(accessDir)
+	if err != nil {
+		return err
+	}
+
+	var modTime time.Time
+	var names []string
+	for _, fi := range files {
+
+		filename := strings.Split(fi.Name(), ".")
+		fileType := filename[len(filename)-1]
+		if fileType != "accdb" {
+			continue
+		}
+
+		if fi.Mode().IsRegular() {
+			if !fi.ModTime().Before(modTime) {
+				if fi.ModTime().After(modTime) {
+					modTime = fi.ModTime()
+					names = names[:0]
+				}
+				names = append(names, fi.Name())
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return errors.New("no ABI database found")
+	}
+
+	newConn, err := sql.Open("adodb", "Provider=Microsoft.ACE.OLEDB.12.0;Data Source="+accessDir+names[0])
+	if err != nil {
+		return err
+	}
+	newConn.SetMaxOpenConns(8)
+	newConn.SetMaxIdleConns(8)
+	newConn.SetConnMaxLifetime(5 * time.Minute)
+
+	//Swap in the new database before closing the old one so reloads don't interrupt checks
+	ap.connLock.Lock()
+	oldConn := ap.conn
+	ap.conn = newConn
+	ap.connLock.Unlock()
+
+	if oldConn != nil {
+		oldConn.Close()
+	}
+
+	return nil
+}
+
+func (ap *accessProvider) Extension() string {
+	return ".accdb"
+}
+
+// Validate checks content is an Access database, the only check possible without opening it
+func (ap *accessProvider) Validate(name string, content []byte) (*data.ImportReport, error) {
+
+	sum := sha256.Sum256(content)
+
+	report := &data.ImportReport{
+		File:     name,
+		Hash:     hex.EncodeToString(sum[:]),
+		Errors:   make([]*data.ImportError, 0),
+		Imported: *data.ConvertDate(time.Now()),
+	}
+
+	if !strings.HasSuffix(strings.ToLower(name), ".accdb") {
+		report.Reason = "not an .accdb file"
+		return report, InvalidDatabase
+	}
+
+	if len(content) < 19 || !bytes.Equal(content[4:19], []byte("Standard ACE DB")) && !bytes.Equal(content[4:19], []byte("Standard Jet DB")) {
+		report.Reason = "not an Access database"
+		return report, InvalidDatabase
+	}
+
+	return report, nil
+}
+
+// Activate writes content to ABIfiles as the newest database and reopens it. Files are named by hash so
+// an open database is never overwritten, activating one already there just makes it newest
+func (ap *accessProvider) Activate(content []byte) error {
+
+	sum := sha256.Sum256(content)
+	path := filepath.Join(accessDir, "ABI_"+hex.EncodeToString(sum[:])[:16]+".accdb")
+
+	_, err := os.Stat(path)
+	if err == nil {
+		now := time.Now()
+		err = os.Chtimes(path, now, now)
+		if err != nil {
+			return err
+		}
+
+		return ap.open()
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	err = ioutil.WriteFile(path+".tmp", content, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return err
+	}
+
+	return ap.open()
+}
+
+// Candidates returns claims with a matching date of birth, Access can't normalise the postcode inside the
+// address so claims are only found by postcode once imported into our database
+func (ap *accessProvider) Candidates(DOB time.Time, postcode string) ([]*data.InsurerColumn, error) {
+
+	ap.connLock.RLock()
+	defer ap.connLock.RUnlock()
+
+	rows, err := ap.conn.Query(`SELECT FAMILY_NAME, FORENAMES, DATE_OF_BIRTH, ADDRESS_OF_CLAIM, DATE_OF_CLAIM, INSURER_CODE
+								FROM fraudulent_claim_data WHERE DATE_OF_BIRTH = ?`, DOB.Format("02/01/2006"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := make([]*data.InsurerColumn, 0)
+	for rows.Next() {
+
+		var (
+			dob         time.Time
+			claimDate   interface{}
+			insurerCode sql.NullString
+		)
+
+		claim := &data.InsurerColumn{}
+		err = rows.Scan(&claim.LastName, &claim.FisrtName, &dob, &claim.Address, &claimDate, &insurerCode)
+		if err != nil {
+			return nil, err
+		}
+
+		claim.DOB = *data.ConvertDate(dob)
+		if date, ok := claimDate.(time.Time); ok {
+			claim.DOC = *data.ConvertDate(date)
+		}
+		claim.InsurerCode = insurerCode.String
+
+		if i := strings.LastIndex(claim.Address, ","); i != -1 {
+			claim.PostCode = strings.TrimSpace(claim.Address[i+1:])
+		}
+
+		claims = append(claims, claim)
+	}
+
+	return claims, rows.Err()
+}
@@ -0,0 +1,137 @@
+package ABIDataProvider
+
+import (
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// seedDir is checked for a CSV to import when the database has no ABI dataset yet
+const seedDir = "./ABIfiles/"
+
+// dbProvider checks claims imported from CSV into our database, it runs anywhere the site does
+type dbProvider struct{}
+
+func newDBProvider() (Provider, error) {
+
+	dp := &dbProvider{}
+
+	active, err := db.GetActiveABIDataset()
+	if err != nil {
+		return nil, err
+	}
+	if active != "" {
+		return dp, nil
+	}
+
+	//A new install imports the newest CSV in ABIfiles, later datasets are uploaded by admins
+	name, err := newestCSV(seedDir)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		log.Printf("No ABI dataset imported, driver checks will fail until one is uploaded")
+		return dp, nil
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(seedDir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	err = dp.activate(name, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return dp, nil
+}
+
+func (dp *dbProvider) Extension() string {
+	return ".csv"
+}
+
+func (dp *dbProvider) Validate(name string, content []byte) (*data.ImportReport, error) {
+
+	_, report, err := parseCSV(name, hashContent(content), content)
+
+	return report, err
+}
+
+func (dp *dbProvider) Activate(content []byte) error {
+	return dp.activate("upload.csv", content)
+}
+
+func (dp *dbProvider) activate(name string, content []byte) error {
+
+	hash := hashContent(content)
+
+	claims, report, err := parseCSV(name, hash, content)
+	if err != nil {
+		return err
+	}
+
+	err = db.ImportABIDataset(hash, name, claims)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("ABI dataset %v imported, %v claims, %v rows rejected", name, report.Accepted, report.Rejected)
+
+	return nil
+}
+
+func (dp *dbProvider) Candidates(DOB time.Time, postcode string) ([]*data.InsurerColumn, error) {
+
+	active, err := db.GetActiveABIDataset()
+	if err != nil {
+		return nil, err
+	}
+	if active == "" {
+		return nil, NoDataset
+	}
+
+	return db.GetABICandidates(DOB, postcode)
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// newestCSV returns the name of the most recently modified CSV in dir, or "" if there isn't one
+func newestCSV(dir string) (string, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var newest os.FileInfo
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() || !strings.EqualFold(filepath.Ext(fi.Name()), ".csv") {
+			continue
+		}
+
+		if newest == nil || fi.ModTime().After(newest.ModTime()) {
+			newest = fi
+		}
+	}
+
+	if newest == nil {
+		return "", nil
+	}
+
+	return newest.Name(), nil
+}
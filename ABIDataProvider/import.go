@@ -0,0 +1,116 @@
+package ABIDataProvider
+
+import (
+	"carHiringWebsite/csvimport"
+	"carHiringWebsite/data"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	columnFamilyName  = "familyName"
+	columnForenames   = "forenames"
+	columnDOB         = "dob"
+	columnAddress     = "address"
+	columnClaimDate   = "claimDate"
+	columnInsurerCode = "insurerCode"
+)
+
+var (
+	// MaxRejected is the fraction of rows that may be rejected before a whole file is refused, set from flags in main
+	MaxRejected *float64
+
+	DatasetRefused = csvimport.DatasetRefused
+
+	// headers maps each accepted header, lower case with spaces and underscores removed, to its column.
+	// The names match the fraudulent_claim_data table exported from Access
+	headers = map[string]string{
+		"familyname":     columnFamilyName,
+		"surname":        columnFamilyName,
+		"forenames":      columnForenames,
+		"dateofbirth":    columnDOB,
+		"dob":            columnDOB,
+		"addressofclaim": columnAddress,
+		"address":        columnAddress,
+		"dateofclaim":    columnClaimDate,
+		"insurercode":    columnInsurerCode,
+	}
+
+	requiredColumns = []string{columnFamilyName, columnForenames, columnDOB, columnAddress}
+
+	// dateLayouts are tried in order, Access exports day/month/year
+	dateLayouts = []string{"02/01/2006", "2/1/2006", "2006-01-02", "02/01/2006 15:04:05", "2/1/2006 15:04:05"}
+)
+
+// parseCSV validates every row of an ABI claims file, returning the claims accepted and a report of the rows
+// rejected. The returned error is DatasetRefused when the file is unusable or too many rows were rejected
+func parseCSV(file, hash string, content []byte) ([]*data.InsurerColumn, *data.ImportReport, error) {
+
+	format := &csvimport.Format{Headers: headers, Required: requiredColumns, MaxRejected: *MaxRejected}
+
+	claims := make([]*data.InsurerColumn, 0)
+	report, err := csvimport.Parse(file, hash, content, format, func(value func(string) string) (string, string) {
+
+		claim, reason := parseRecord(value)
+		if reason != "" {
+			return "", reason
+		}
+
+		claims = append(claims, claim)
+
+		return "", ""
+	})
+	if err != nil {
+		return nil, report, err
+	}
+
+	return claims, report, nil
+}
+
+func parseRecord(value func(column string) string) (*data.InsurerColumn, string) {
+
+	claim := &data.InsurerColumn{
+		LastName:    value(columnFamilyName),
+		FisrtName:   value(columnForenames),
+		Address:     value(columnAddress),
+		InsurerCode: value(columnInsurerCode),
+	}
+
+	if claim.LastName == "" || claim.FisrtName == "" {
+		return nil, "missing name"
+	}
+
+	//Checks match on the first line of the address and the postcode, which Access stores last
+	if strings.Count(claim.Address, ",") < 1 {
+		return nil, "address has no postcode"
+	}
+	claim.PostCode = strings.TrimSpace(claim.Address[strings.LastIndex(claim.Address, ",")+1:])
+
+	dob, ok := parseDate(value(columnDOB))
+	if !ok {
+		return nil, "invalid date of birth " + strconv.Quote(value(columnDOB))
+	}
+	claim.DOB = *data.ConvertDate(dob)
+
+	if value(columnClaimDate) != "" {
+		claimDate, ok := parseDate(value(columnClaimDate))
+		if !ok {
+			return nil, "invalid date of claim " + strconv.Quote(value(columnClaimDate))
+		}
+		claim.DOC = *data.ConvertDate(claimDate)
+	}
+
+	return claim, ""
+}
+
+func parseDate(value string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		date, err := time.Parse(layout, value)
+		if err == nil {
+			return date, true
+		}
+	}
+
+	return time.Time{}, false
+}
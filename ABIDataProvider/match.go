@@ -0,0 +1,261 @@
+package ABIDataProvider
+
+import (
+	"carHiringWebsite/data"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	DecisionClear  = "clear"
+	DecisionReview = "review"
+	DecisionMatch  = "match"
+
+	// maxMatches limits how many claims are kept in a result, the highest scores first
+	maxMatches = 10
+
+	// winklerPrefix is the longest common prefix Jaro-Winkler rewards
+	winklerPrefix = 4
+)
+
+var (
+	// MatchThreshold is the score at or above which a claim is treated as the driver's, ReviewThreshold the
+	// score at or above which a claim is held for an admin to decide. PrefixScale is the Jaro-Winkler bonus given
+	// to each leading character two names share, at most 0.25. Set from flags in main
+	MatchThreshold  *float64
+	ReviewThreshold *float64
+	PrefixScale     *float64
+
+	InvalidThresholds = errors.New("invalid ABI match thresholds")
+
+	// weights are how much each part of a claim counts towards its score, they add up to 1
+	weights = struct {
+		familyName, forenames, dob, postcode, address float64
+	}{0.3, 0.2, 0.25, 0.15, 0.1}
+)
+
+// checkThresholds is called by InitProvider so bad flags stop the site rather than every check
+func checkThresholds() error {
+
+	if *ReviewThreshold <= 0 || *ReviewThreshold > *MatchThreshold || *MatchThreshold > 1 {
+		return InvalidThresholds
+	}
+	if *PrefixScale < 0 || *PrefixScale > 0.25 {
+		return InvalidThresholds
+	}
+
+	return nil
+}
+
+// MatchClaims scores the claims on the register that could belong to the driver. The result is a match when
+// the best score reaches MatchThreshold, review when it only reaches ReviewThreshold and clear otherwise
+func MatchClaims(lastName, firstNames, address, postcode string, DOB time.Time) (*data.ClaimMatchResult, error) {
+
+	postcode = normalisePostcode(postcode)
+
+	candidates, err := provider.Candidates(DOB, postcode)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &data.ClaimMatchResult{
+		Decision:        DecisionClear,
+		MatchThreshold:  *MatchThreshold,
+		ReviewThreshold: *ReviewThreshold,
+		Matches:         make([]*data.ClaimMatch, 0),
+	}
+
+	for _, claim := range candidates {
+		match := scoreClaim(claim, lastName, firstNames, address, postcode, DOB)
+		if match.Score < *ReviewThreshold {
+			continue
+		}
+
+		result.Matches = append(result.Matches, match)
+	}
+
+	sort.SliceStable(result.Matches, func(i, j int) bool {
+		return result.Matches[i].Score > result.Matches[j].Score
+	})
+	if len(result.Matches) > maxMatches {
+		result.Matches = result.Matches[:maxMatches]
+	}
+
+	if len(result.Matches) > 0 {
+		result.Score = result.Matches[0].Score
+	}
+
+	switch {
+	case result.Score >= *MatchThreshold:
+		result.Decision = DecisionMatch
+	case len(result.Matches) > 0:
+		result.Decision = DecisionReview
+	}
+
+	return result, nil
+}
+
+// HasFraudulentClaim reports whether a claim scores at or above MatchThreshold
+func HasFraudulentClaim(lastName, firstNames, address, postcode string, DOB time.Time) (bool, error) {
+
+	result, err := MatchClaims(lastName, firstNames, address, postcode, DOB)
+	if err != nil {
+		return false, err
+	}
+
+	return result.Decision == DecisionMatch, nil
+}
+
+// scoreClaim compares each part of a claim with the driver's details, postcode is already normalised
+func scoreClaim(claim *data.InsurerColumn, lastName, firstNames, address, postcode string, DOB time.Time) *data.ClaimMatch {
+
+	match := &data.ClaimMatch{Claim: claim}
+
+	match.FamilyName = jaroWinkler(normaliseName(claim.LastName), normaliseName(lastName))
+	match.Forenames = forenameScore(normaliseName(claim.FisrtName), normaliseName(firstNames))
+
+	if sameDay(claim.DOB.Time, DOB) {
+		match.DOB = 1
+	}
+
+	claimPostcode := normalisePostcode(claim.PostCode)
+	if claimPostcode == postcode {
+		match.PostCode = 1
+	} else {
+		match.PostCode = jaroWinkler(claimPostcode, postcode)
+	}
+
+	claimAddress := strings.Split(claim.Address, ",")[0]
+	match.Address = jaroWinkler(normaliseName(claimAddress), normaliseName(strings.Split(address, ",")[0]))
+
+	match.Score = weights.familyName*match.FamilyName + weights.forenames*match.Forenames + weights.dob*match.DOB +
+		weights.postcode*match.PostCode + weights.address*match.Address
+
+	return match
+}
+
+// forenameScore compares all forenames and the first alone, taking the better, so a missing middle name costs little
+func forenameScore(a, b string) float64 {
+
+	score := jaroWinkler(a, b)
+
+	aFields, bFields := strings.Fields(a), strings.Fields(b)
+	if len(aFields) > 1 || len(bFields) > 1 {
+		if len(aFields) > 0 && len(bFields) > 0 {
+			first := jaroWinkler(aFields[0], bFields[0])
+			if first > score {
+				score = first
+			}
+		}
+	}
+
+	return score
+}
+
+// sameDay compares calendar dates, both are UTC midnight timestamps, from the register and the client
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.UTC().Date()
+	by, bm, bd := b.UTC().Date()
+
+	return ay == by && am == bm && ad == bd
+}
+
+// normaliseName upper cases s, keeping only letters and digits with single spaces between words, so
+// "o'brien-smith" and "O BRIEN SMITH" compare equal
+func normaliseName(s string) string {
+
+	words := strings.FieldsFunc(strings.ToUpper(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return strings.Join(words, " ")
+}
+
+// normalisePostcode upper cases s and removes everything but letters and digits
+func normalisePostcode(s string) string {
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, s)
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of a and b, 1 when equal and 0 when nothing matches
+func jaroWinkler(a, b string) float64 {
+
+	if a == b {
+		return 1
+	}
+
+	ar, br := []rune(a), []rune(b)
+	if len(ar) == 0 || len(br) == 0 {
+		return 0
+	}
+
+	window := len(ar)
+	if len(br) > window {
+		window = len(br)
+	}
+	window = window/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	aMatched := make([]bool, len(ar))
+	bMatched := make([]bool, len(br))
+
+	matches := 0
+	for i := range ar {
+		start, end := i-window, i+window+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(br) {
+			end = len(br)
+		}
+
+		for j := start; j < end; j++ {
+			if bMatched[j] || ar[i] != br[j] {
+				continue
+			}
+			aMatched[i], bMatched[j] = true, true
+			matches++
+			break
+		}
+	}
+
+	if matches == 0 {
+		return 0
+	}
+
+	//Half the matched characters found in a different order
+	transpositions := 0
+	j := 0
+	for i := range ar {
+		if !aMatched[i] {
+			continue
+		}
+		for !bMatched[j] {
+			j++
+		}
+		if ar[i] != br[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ar)) + m/float64(len(br)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < len(ar) && prefix < len(br) && prefix < winklerPrefix && ar[prefix] == br[prefix] {
+		prefix++
+	}
+
+	return jaro + float64(prefix)**PrefixScale*(1-jaro)
+}
@@ -0,0 +1,200 @@
+package ABIDataProvider
+
+import (
+	"carHiringWebsite/data"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeProvider returns the same claims for every driver
+type fakeProvider struct {
+	claims []*data.InsurerColumn
+}
+
+func (p *fakeProvider) Candidates(DOB time.Time, postcode string) ([]*data.InsurerColumn, error) {
+	return p.claims, nil
+}
+
+func (p *fakeProvider) Extension() string { return "csv" }
+
+func (p *fakeProvider) Validate(name string, content []byte) (*data.ImportReport, error) {
+	return nil, nil
+}
+
+func (p *fakeProvider) Activate(content []byte) error { return nil }
+
+// setThresholds sets the flags main otherwise sets
+func setThresholds(match, review, prefix float64) {
+	MatchThreshold, ReviewThreshold, PrefixScale = &match, &review, &prefix
+}
+
+func newClaim(lastName, firstName, address, postcode string, DOB time.Time) *data.InsurerColumn {
+	claim := &data.InsurerColumn{LastName: lastName, FisrtName: firstName, Address: address, PostCode: postcode}
+	claim.DOB.Time = DOB
+	return claim
+}
+
+func TestJaroWinkler(t *testing.T) {
+	setThresholds(0.97, 0.85, 0.1)
+
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"MARTHA", "MARHTA", 0.961},
+		{"DWAYNE", "DUANE", 0.84},
+		{"DIXON", "DICKSONX", 0.813},
+		{"JON", "JOHN", 0.933},
+		{"SMITH", "SMITH", 1},
+		{"ABC", "XYZ", 0},
+		{"", "SMITH", 0},
+	}
+
+	for _, test := range tests {
+		got := jaroWinkler(test.a, test.b)
+		if math.Abs(got-test.want) > 0.001 {
+			t.Errorf("jaroWinkler(%q, %q) = %.4f, want %.3f", test.a, test.b, got, test.want)
+		}
+		if reverse := jaroWinkler(test.b, test.a); math.Abs(reverse-got) > 1e-9 {
+			t.Errorf("jaroWinkler(%q, %q) = %.4f, not symmetric with %.4f", test.b, test.a, reverse, got)
+		}
+	}
+}
+
+func TestNormalise(t *testing.T) {
+
+	if got := normaliseName("o'brien-smith"); got != "O BRIEN SMITH" {
+		t.Errorf("normaliseName = %q", got)
+	}
+	if got := normaliseName("  Mary   Jane "); got != "MARY JANE" {
+		t.Errorf("normaliseName = %q", got)
+	}
+	if got := normalisePostcode(" sw1a  1aa "); got != "SW1A1AA" {
+		t.Errorf("normalisePostcode = %q", got)
+	}
+}
+
+func TestMatchClaimsJonJohn(t *testing.T) {
+	setThresholds(0.97, 0.85, 0.1)
+
+	DOB := time.Date(1980, 5, 17, 0, 0, 0, 0, time.UTC)
+	provider = &fakeProvider{claims: []*data.InsurerColumn{
+		newClaim("Smith", "Jon", "12 High Street, Leeds", "LS1 4AP", DOB),
+	}}
+
+	result, err := MatchClaims("SMITH", "John", "12 High St, Leeds", "ls1  4ap", DOB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Decision != DecisionMatch {
+		t.Errorf("Decision = %v, Score %.4f, want %v", result.Decision, result.Score, DecisionMatch)
+	}
+	if len(result.Matches) != 1 {
+		t.Fatalf("len(Matches) = %v, want 1", len(result.Matches))
+	}
+
+	match := result.Matches[0]
+	if match.FamilyName != 1 || match.DOB != 1 || match.PostCode != 1 {
+		t.Errorf("FamilyName %v, DOB %v, PostCode %v, want 1", match.FamilyName, match.DOB, match.PostCode)
+	}
+	if match.Forenames >= 1 || match.Forenames < 0.9 {
+		t.Errorf("Forenames = %.4f, want a near match", match.Forenames)
+	}
+}
+
+func TestMatchClaimsThresholds(t *testing.T) {
+	setThresholds(0.97, 0.85, 0.1)
+
+	DOB := time.Date(1980, 5, 17, 0, 0, 0, 0, time.UTC)
+	claim := newClaim("Smith", "Jon", "12 High Street", "LS14AP", DOB)
+	provider = &fakeProvider{claims: []*data.InsurerColumn{claim}}
+
+	score := scoreClaim(claim, "Smith", "John", "12 High Street", "LS14AP", DOB).Score
+	above := math.Nextafter(score, 2)
+
+	tests := []struct {
+		name          string
+		match, review float64
+		want          string
+	}{
+		{"score at match threshold", score, score, DecisionMatch},
+		{"score below match threshold", above, score - 0.01, DecisionReview},
+		{"score at review threshold", above, score, DecisionReview},
+		{"score below review threshold", above, above, DecisionClear},
+	}
+
+	for _, test := range tests {
+		setThresholds(test.match, test.review, 0.1)
+
+		result, err := MatchClaims("Smith", "John", "12 High Street", "LS1 4AP", DOB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Decision != test.want {
+			t.Errorf("%v: Decision = %v, want %v", test.name, result.Decision, test.want)
+		}
+		if test.want == DecisionClear && (len(result.Matches) != 0 || result.Score != 0) {
+			t.Errorf("%v: kept %v matches scoring %v", test.name, len(result.Matches), result.Score)
+		}
+		if test.want != DecisionClear && result.Score != score {
+			t.Errorf("%v: Score = %v, want %v", test.name, result.Score, score)
+		}
+	}
+}
+
+func TestMatchClaimsOrder(t *testing.T) {
+	setThresholds(0.97, 0.5, 0.1)
+
+	DOB := time.Date(1980, 5, 17, 0, 0, 0, 0, time.UTC)
+	provider = &fakeProvider{claims: []*data.InsurerColumn{
+		newClaim("Smyth", "Jon", "1 Other Road", "LS14AP", DOB),
+		newClaim("Smith", "John", "12 High Street", "LS14AP", DOB),
+		newClaim("Jones", "Peter", "99 Far Lane", "YO11AA", DOB.AddDate(1, 0, 0)),
+	}}
+
+	result, err := MatchClaims("Smith", "John", "12 High Street", "LS1 4AP", DOB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Matches) != 2 {
+		t.Fatalf("len(Matches) = %v, want 2", len(result.Matches))
+	}
+	if result.Matches[0].Score != 1 || result.Matches[0].Claim.LastName != "Smith" {
+		t.Errorf("best match %v scored %v, want the exact claim first", result.Matches[0].Claim.LastName,
+			result.Matches[0].Score)
+	}
+	if result.Decision != DecisionMatch || result.Score != 1 {
+		t.Errorf("Decision = %v, Score %v", result.Decision, result.Score)
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+
+	tests := []struct {
+		match, review, prefix float64
+		valid                 bool
+	}{
+		{0.97, 0.85, 0.1, true},
+		{0.9, 0.9, 0, true},
+		{1, 0.5, 0.25, true},
+		{0.85, 0.97, 0.1, false},
+		{1.1, 0.85, 0.1, false},
+		{0.97, 0, 0.1, false},
+		{0.97, 0.85, 0.3, false},
+		{0.97, 0.85, -0.1, false},
+	}
+
+	for _, test := range tests {
+		setThresholds(test.match, test.review, test.prefix)
+
+		err := checkThresholds()
+		if test.valid && err != nil {
+			t.Errorf("checkThresholds(%v, %v, %v) = %v", test.match, test.review, test.prefix, err)
+		} else if !test.valid && err != InvalidThresholds {
+			t.Errorf("checkThresholds(%v, %v, %v) = %v, want InvalidThresholds", test.match, test.review, test.prefix, err)
+		}
+	}
+}
@@ -1,15 +1,17 @@
 package DVLADataProvider
 
 import (
-	"encoding/csv"
+	"carHiringWebsite/data"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,45 +21,220 @@ var (
 		"Suspended":    1,
 		"LostOrStolen": 2,
 		"Expired":      3,
+		"Valid":        4,
 	}
 
-	csvLock sync.RWMutex
-	csvData map[string]int
-	dir     = `./DVLAfiles/`
+	dir = `./DVLAfiles/`
+
+	// activeFile is the file in DVLAfiles uploaded datasets are written to
+	activeFile = "dvla.csv"
+
+	// ReloadInterval is how often DVLAfiles is checked for a changed dataset, set from flags in main
+	ReloadInterval *time.Duration
 
 	InvalidLicense = errors.New("invalidLicense")
+
+	// active holds the *dataset licence checks are made against, replaced whole when a new file is loaded
+	active atomic.Value
+
+	// checkLock stops two checks loading the same file at once, statusLock guards the result of the last check
+	checkLock  sync.Mutex
+	statusLock sync.Mutex
+	checked    time.Time
+	lastError  string
+	lastImport *data.ImportReport
+
+	// refused is the last file that failed validation, skipped until it changes
+	refused    fileState
+	refusedErr error
 )
 
-func InitProvider() {
-	csvData = make(map[string]int)
+type fileState struct {
+	file     string
+	size     int64
+	modified time.Time
+}
+
+func stateOf(fi os.FileInfo) fileState {
+	return fileState{file: fi.Name(), size: fi.Size(), modified: fi.ModTime()}
+}
+
+// dataset is a loaded DVLA file, never modified once stored in active
+type dataset struct {
+	file     string
+	hash     string
+	size     int64
+	modified time.Time
+	loaded   time.Time
+	licenses map[string]*License
+}
+
+func InitProvider() error {
+	active.Store(&dataset{licenses: make(map[string]*License)})
 
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		os.Mkdir(dir, os.ModePerm)
-	} else {
-		LoadCSVData()
+		err = os.Mkdir(dir, os.ModePerm)
+		if err != nil {
+			return err
+		}
 	}
 
-	go func() {
+	err := Check()
+	if err != nil {
+		log.Printf("DVLA dataset not loaded - err: %v", err)
+	}
 
+	go func() {
 		for {
-			time.Sleep(5 * time.Second)
-			LoadCSVData()
-		}
+			time.Sleep(*ReloadInterval)
 
+			err := Check()
+			if err != nil {
+				log.Printf("DVLA dataset not reloaded - err: %v", err)
+			}
+		}
 	}()
 
+	return nil
 }
 
-func LoadCSVData() error {
+// Check loads the newest CSV in DVLAfiles if it differs from the active dataset. Files with the same
+// name, size and modification time are skipped without being read, otherwise the contents are hashed
+// and only parsed when the hash has changed. A file that fails validation is not tried again until it changes
+func Check() error {
+	checkLock.Lock()
+	defer checkLock.Unlock()
 
-	files, err := ioutil.ReadDir(dir)
+	err := check()
+
+	statusLock.Lock()
+	checked = time.Now()
+	lastError = ""
+	if err != nil {
+		lastError = err.Error()
+	}
+	statusLock.Unlock()
+
+	return err
+}
+
+func check() error {
+
+	fi, err := newestFile()
+	if err != nil {
+		return err
+	}
+
+	current := active.Load().(*dataset)
+	if fi.Name() == current.file && fi.Size() == current.size && fi.ModTime().Equal(current.modified) {
+		return nil
+	}
+	if stateOf(fi) == refused {
+		return refusedErr
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+	if err != nil {
+		return err
+	}
+
+	hash := hashContent(content)
+
+	if fi.Name() == current.file && hash == current.hash {
+		//Touched but unchanged, keep the loaded data and remember the new modification time
+		unchanged := *current
+		unchanged.size = fi.Size()
+		unchanged.modified = fi.ModTime()
+		active.Store(&unchanged)
+		return nil
+	}
+
+	licenses, _, report, err := parseCSV(fi.Name(), hash, content)
+
+	statusLock.Lock()
+	lastImport = report
+	statusLock.Unlock()
+
+	//A bad file leaves the previous dataset in use
+	if err != nil {
+		refused, refusedErr = stateOf(fi), err
+		return err
+	}
+	report.Activated = true
+
+	active.Store(&dataset{
+		file:     fi.Name(),
+		hash:     hash,
+		size:     fi.Size(),
+		modified: fi.ModTime(),
+		loaded:   time.Now(),
+		licenses: licenses,
+	})
+
+	log.Printf("DVLA dataset %v loaded, %v licences, %v rows rejected", fi.Name(), report.Accepted, report.Rejected)
+
+	return nil
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Validate parses content as a DVLA file without loading it, returning up to previewRows of the accepted records
+func Validate(name string, content []byte, previewRows int) ([]*License, *data.ImportReport, error) {
+
+	_, accepted, report, err := parseCSV(name, hashContent(content), content)
+	if len(accepted) > previewRows {
+		accepted = accepted[:previewRows]
+	}
+
+	return accepted, report, err
+}
+
+// Activate replaces activeFile in DVLAfiles with content and loads it straight away. Content that fails
+// validation is not written, so the previous dataset stays in use and on disk
+func Activate(content []byte) error {
+
+	_, _, _, err := parseCSV(activeFile, hashContent(content), content)
+	if err != nil {
+		return err
+	}
+
+	temp := filepath.Join(dir, activeFile+".tmp")
+
+	err = ioutil.WriteFile(temp, content, 0644)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
 		return err
 	}
 
-	var modTime time.Time
-	var names []string
+	err = os.Rename(temp, filepath.Join(dir, activeFile))
+	if err != nil {
+		return err
+	}
+
+	err = Check()
+	if err != nil {
+		return err
+	}
+
+	if active.Load().(*dataset).hash != hashContent(content) {
+		return errors.New("dataset not activated, a newer file is in DVLAfiles")
+	}
+
+	return nil
+}
+
+// newestFile returns the most recently modified CSV in DVLAfiles, the first by name when several share a time
+func newestFile() (os.FileInfo, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var newest os.FileInfo
 	for _, fi := range files {
 
 		filename := strings.Split(fi.Name(), ".")
@@ -67,66 +244,54 @@ func LoadCSVData() error {
 		}
 
 		if fi.Mode().IsRegular() {
-			if !fi.ModTime().Before(modTime) {
-				if fi.ModTime().After(modTime) {
-					modTime = fi.ModTime()
-					names = names[:0]
-				}
-				names = append(names, fi.Name())
+			if newest == nil || fi.ModTime().After(newest.ModTime()) {
+				newest = fi
 			}
 		}
 	}
 
-	csvfile, err := os.Open(dir + names[0])
-
-	if err != nil {
-		return err
+	if newest == nil {
+		return nil, errors.New("no DVLA csv file found")
 	}
-	defer csvfile.Close()
 
-	reader := csv.NewReader(csvfile)
-	if _, err := reader.Read(); err != nil { //read header
-		log.Fatal(err)
-	}
+	return newest, nil
+}
 
-	csvLock.Lock()
-	csvData = make(map[string]int)
-	for {
-		rec, err := reader.Read()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Fatal(err)
+// GetStatus describes the active dataset
+func GetStatus() *data.DatasetStatus {
+	statusLock.Lock()
+	defer statusLock.Unlock()
 
-		}
-		status := 0
-		if _, ok := statuses[rec[8]]; ok {
-			status = statuses[rec[8]]
-		}
+	current := active.Load().(*dataset)
 
-		csvData[rec[0]] = status
-	}
-	csvLock.Unlock()
-	return nil
+	return &data.DatasetStatus{
+		File:      current.file,
+		Hash:      current.hash,
+		Rows:      len(current.licenses),
+		Modified:  *data.ConvertDate(current.modified),
+		Loaded:    *data.ConvertDate(current.loaded),
+		Checked:   *data.ConvertDate(checked),
+		LastError: lastError,
 
+		LastImport: lastImport,
+	}
 }
 
 func GetLicenseStatus(licenceNumber string) int {
 
-	csvLock.RLock()
-	defer csvLock.RUnlock()
-	if _, ok := csvData[licenceNumber]; ok {
-		return csvData[licenceNumber]
+	license := GetLicense(licenceNumber)
+	if license == nil {
+		return -1
 	}
 
-	return -1
+	return license.Status
 }
 
+// IsInvalidLicense reports whether the licence is listed with any status other than Valid
 func IsInvalidLicense(licenceNumber string) bool {
 
 	status := GetLicenseStatus(licenceNumber)
 
-	return status != -1
+	return status != -1 && status != statuses["Valid"]
 
 }
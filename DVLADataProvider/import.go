@@ -0,0 +1,141 @@
+package DVLADataProvider
+
+import (
+	"carHiringWebsite/csvimport"
+	"carHiringWebsite/data"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	columnLicense    = "licenceNumber"
+	columnStatus     = "status"
+	columnFamilyName = "familyName"
+	columnForenames  = "forenames"
+	columnDOB        = "dob"
+	columnIssued     = "issued"
+	columnExpires    = "expires"
+	columnAuthority  = "authority"
+	columnAddress    = "address"
+	columnDate       = "statusDate"
+
+	// dateLayout is the DVLA day.month.year format, leading zeros are optional
+	dateLayout = "2.1.2006"
+)
+
+var (
+	// MaxRejected is the fraction of rows that may be rejected before a whole file is refused, set from flags in main
+	MaxRejected *float64
+
+	DatasetRefused = csvimport.DatasetRefused
+
+	// headers maps each accepted header, lower case with spaces removed, to its column
+	headers = map[string]string{
+		"licencenumber": columnLicense,
+		"licensenumber": columnLicense,
+		"licence":       columnLicense,
+		"status":        columnStatus,
+		"licencestatus": columnStatus,
+
+		"familyname":       columnFamilyName,
+		"surname":          columnFamilyName,
+		"lastname":         columnFamilyName,
+		"forenames":        columnForenames,
+		"firstnames":       columnForenames,
+		"dob":              columnDOB,
+		"dateofbirth":      columnDOB,
+		"yearofissue":      columnIssued,
+		"issued":           columnIssued,
+		"expires":          columnExpires,
+		"expiry":           columnExpires,
+		"issuingauthority": columnAuthority,
+		"authority":        columnAuthority,
+		"address":          columnAddress,
+		"date":             columnDate,
+		"statusdate":       columnDate,
+	}
+
+	dateColumns = []string{columnDOB, columnIssued, columnExpires, columnDate}
+
+	requiredColumns = []string{columnLicense, columnStatus}
+
+	// licensePattern is a GB driving licence number, surname, date of birth, initials and check digits
+	licensePattern = regexp.MustCompile(`^[A-Z9]{5}[0-9]{6}[A-Z9]{2}[0-9][A-Z0-9]{2}$`)
+)
+
+// parseCSV validates every row of a DVLA file, returning the licence records accepted, also in file order, and
+// a report of the rows rejected. The returned error is DatasetRefused when the file is unusable or too many rows
+// were rejected
+func parseCSV(file, hash string, content []byte) (map[string]*License, []*License, *data.ImportReport, error) {
+
+	format := &csvimport.Format{Headers: headers, Required: requiredColumns, MaxRejected: *MaxRejected}
+
+	licenses := make(map[string]*License)
+	accepted := make([]*License, 0)
+	report, err := csvimport.Parse(file, hash, content, format, func(value func(string) string) (string, string) {
+
+		license, reason := parseRecord(value)
+		if reason != "" {
+			return license.Number, reason
+		}
+
+		if _, ok := licenses[license.Number]; ok {
+			return license.Number, "duplicate licence number"
+		}
+
+		licenses[license.Number] = license
+		accepted = append(accepted, license)
+
+		return license.Number, ""
+	})
+	if err != nil {
+		return nil, nil, report, err
+	}
+
+	return licenses, accepted, report, nil
+}
+
+// parseRecord reads a row into a License, returning the reason when the row is invalid. Optional
+// columns missing from the file are left as zero values
+func parseRecord(value func(column string) string) (*License, string) {
+
+	license := &License{
+		Number:     strings.ToUpper(value(columnLicense)),
+		FamilyName: value(columnFamilyName),
+		Forenames:  value(columnForenames),
+		Authority:  strings.ToUpper(value(columnAuthority)),
+		Address:    value(columnAddress),
+	}
+
+	if !licensePattern.MatchString(license.Number) {
+		return license, "invalid licence number"
+	}
+
+	status, ok := statuses[value(columnStatus)]
+	if !ok {
+		return license, "unknown status " + strconv.Quote(value(columnStatus))
+	}
+	license.Status = status
+
+	dates := make(map[string]time.Time)
+	for _, column := range dateColumns {
+		if value(column) == "" {
+			continue
+		}
+
+		date, err := time.Parse(dateLayout, value(column))
+		if err != nil {
+			return license, "invalid date " + strconv.Quote(value(column)) + " for " + column
+		}
+		dates[column] = date
+	}
+
+	license.DOB = dates[columnDOB]
+	license.Issued = dates[columnIssued]
+	license.Expires = dates[columnExpires]
+	license.StatusDate = dates[columnDate]
+
+	return license, ""
+}
@@ -0,0 +1,108 @@
+package DVLADataProvider
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ValidAuthorities are the issuing authorities a licence may come from
+	ValidAuthorities = []string{"DVLA", "DVA"}
+
+	NameMismatch     = errors.New("licenceNameMismatch")
+	DOBMismatch      = errors.New("licenceDOBMismatch")
+	LicenseExpired   = errors.New("licenceExpired")
+	InvalidAuthority = errors.New("licenceInvalidAuthority")
+)
+
+// License is a DVLA licence record, fields whose column wasn't in the file are left empty
+type License struct {
+	Number     string
+	FamilyName string
+	Forenames  string
+	DOB        time.Time
+	Issued     time.Time
+	Expires    time.Time
+	Authority  string
+	Address    string
+	Status     int
+	StatusDate time.Time
+}
+
+// GetLicense returns the record for the licence number, or nil if it isn't in the active dataset
+func GetLicense(licenceNumber string) *License {
+
+	current := active.Load().(*dataset)
+
+	return current.licenses[strings.ToUpper(strings.TrimSpace(licenceNumber))]
+}
+
+// Verify checks a licence presented for a booking ending at until. A listed licence with a status
+// other than Valid is InvalidLicense, otherwise the record must match the driver's name and date of
+// birth, come from a valid authority and not expire before until. Licences not in the dataset pass
+func Verify(licenceNumber, lastName, names string, dob, until time.Time) error {
+
+	license := GetLicense(licenceNumber)
+	if license == nil {
+		return nil
+	}
+
+	if license.Status != statuses["Valid"] {
+		return InvalidLicense
+	}
+
+	if license.FamilyName != "" && !sameName(license.FamilyName, lastName) {
+		return NameMismatch
+	}
+	if license.Forenames != "" && !sameName(license.Forenames, names) {
+		return NameMismatch
+	}
+
+	if !license.DOB.IsZero() && !sameDate(license.DOB, dob) {
+		return DOBMismatch
+	}
+
+	if license.Authority != "" && !validAuthority(license.Authority) {
+		return InvalidAuthority
+	}
+
+	if !license.Expires.IsZero() && !license.Expires.After(until) {
+		return LicenseExpired
+	}
+
+	return nil
+}
+
+// IsMismatch reports whether err is one of the licence record checks made by Verify, other than InvalidLicense
+func IsMismatch(err error) bool {
+	return err == NameMismatch || err == DOBMismatch || err == LicenseExpired || err == InvalidAuthority
+}
+
+func validAuthority(authority string) bool {
+	for _, valid := range ValidAuthorities {
+		if strings.EqualFold(authority, valid) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameName compares names ignoring case, punctuation and spacing
+func sameName(a, b string) bool {
+	return normaliseName(a) == normaliseName(b)
+}
+
+func normaliseName(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}), " ")
+}
+
+// sameDate compares calendar dates, dob is a UTC midnight timestamp from the client
+func sameDate(a, b time.Time) bool {
+	b = b.UTC()
+
+	return a.Year() == b.Year() && a.Month() == b.Month() && a.Day() == b.Day()
+}
@@ -0,0 +1,242 @@
+package authorisation
+
+import (
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"carHiringWebsite/roles"
+	"carHiringWebsite/services/apiKeyService"
+	"carHiringWebsite/services/auditService"
+	"carHiringWebsite/session"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey int
+
+const userKey contextKey = iota
+
+var (
+	Unauthenticated = errors.New("unauthenticated")
+	Forbidden       = errors.New("permission denied")
+	ReadOnlySession = errors.New("session is read-only")
+	KeyNotAllowed   = errors.New("api keys cannot be used here")
+)
+
+// Require wraps a handler so it only runs when the caller holds the permission.
+// The authorised user is stored on the request context, see GetUser
+func Require(permission roles.Permission, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		user, err := Authorise(r, permission)
+		if err == nil && user.ImpersonatorID != 0 {
+			err = Forbidden
+		}
+
+		serve(w, r, user, err, handler)
+	}
+}
+
+// RequireParameter is Require for handlers whose permission depends on the value of a request parameter.
+// Values missing from permissions are refused
+func RequireParameter(parameter string, permissions map[string]roles.Permission, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		permission, ok := permissions[r.FormValue(parameter)]
+		if !ok {
+			serve(w, r, nil, Forbidden, handler)
+			return
+		}
+
+		Require(permission, handler)(w, r)
+	}
+}
+
+// Authenticated wraps a handler so it only runs for a signed in user, whatever their role.
+// Read-only impersonation sessions are refused, use AuthenticatedRead for handlers that change nothing.
+// API keys are refused as these handlers act for a customer
+func Authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		user, err := Authenticate(r)
+		if err == nil && user.APIKeyID != 0 {
+			err = KeyNotAllowed
+		} else if err == nil && user.ImpersonatorID != 0 && user.ReadOnly {
+			err = ReadOnlySession
+		}
+
+		serve(w, r, user, err, handler)
+	}
+}
+
+// AuthenticatedRead is Authenticated for handlers that only read, so it also admits read-only impersonation
+func AuthenticatedRead(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		user, err := Authenticate(r)
+		if err == nil && user.APIKeyID != 0 {
+			err = KeyNotAllowed
+		}
+
+		serve(w, r, user, err, handler)
+	}
+}
+
+func serve(w http.ResponseWriter, r *http.Request, user *data.User, err error, handler http.HandlerFunc) {
+
+	if err != nil {
+		log.Printf("authorisation error - err: %v\nurl:%v\n", err, r.URL)
+		if err == Unauthenticated {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		return
+	}
+
+	if user.ImpersonatorID != 0 {
+		err = auditService.Record(user, auditService.ImpersonationRequest, auditService.EntityUser, user.ID, nil,
+			map[string]string{"Path": r.URL.Path, "Query": r.URL.RawQuery})
+		if err != nil {
+			log.Printf("authorisation error - err: %v\nurl:%v\n", err, r.URL)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	handler(w, r.WithContext(context.WithValue(r.Context(), userKey, user)))
+}
+
+// Authorise resolves the caller of the request and checks they hold the permission
+func Authorise(r *http.Request, permission roles.Permission) (*data.User, error) {
+
+	user, err := Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !Can(user, permission) {
+		return nil, Forbidden
+	}
+
+	return user, nil
+}
+
+// Can reports whether the user holds the permission, limited to the key's scopes for API key requests
+func Can(user *data.User, permission roles.Permission) bool {
+
+	if !roles.Has(user.Role, permission) {
+		return false
+	}
+
+	if user.APIKeyID == 0 {
+		return true
+	}
+
+	for _, scope := range user.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticate resolves the caller of the request from its Authorization header when an API key
+// is sent, otherwise from their session cookie
+func Authenticate(r *http.Request) (*data.User, error) {
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return authenticateSession(r)
+	}
+
+	const bearer = "Bearer "
+	if !strings.HasPrefix(header, bearer) {
+		return nil, Unauthenticated
+	}
+
+	key, err := apiKeyService.Validate(strings.TrimSpace(header[len(bearer):]))
+	if err == apiKeyService.InvalidKey || err == apiKeyService.ExpiredKey || err == apiKeyService.RevokedKey {
+		return nil, Unauthenticated
+	} else if err != nil {
+		return nil, err
+	}
+
+	//The key acts as the admin who created it, so demoting or disabling them also limits the key
+	user, err := db.SelectUserByID(key.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Disabled {
+		return nil, Unauthenticated
+	}
+
+	user.APIKeyID = key.ID
+	user.Scopes = key.Scopes
+	user.RemoteAddr = RemoteAddr(r)
+
+	return user, nil
+}
+
+// authenticateSession resolves the caller of the request from their session cookie.
+// The user is re-read from the database and stored back in the session so role changes apply
+// immediately. The address of the request is only set on the copy returned, for services to audit the caller
+func authenticateSession(r *http.Request) (*data.User, error) {
+
+	token, err := r.Cookie("session-token")
+	if err != nil || len(token.Value) == 0 {
+		return nil, Unauthenticated
+	}
+
+	err = session.ValidateToken(token.Value)
+	if err != nil {
+		return nil, Unauthenticated
+	}
+
+	bag, err := session.GetByToken(token.Value)
+	if err != nil {
+		return nil, Unauthenticated
+	}
+
+	sessionUser := bag.GetUser()
+
+	dbUser, err := db.SelectUserByID(sessionUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if dbUser.Disabled {
+		return nil, Unauthenticated
+	}
+
+	dbUser.SessionToken = bag.GetToken()
+	bag.UpdateUser(dbUser)
+
+	dbUser.RemoteAddr = RemoteAddr(r)
+
+	dbUser.ImpersonatorID = sessionUser.ImpersonatorID
+	dbUser.ReadOnly = sessionUser.ReadOnly
+
+	return dbUser, nil
+}
+
+// RemoteAddr returns the IP address the request was made from
+func RemoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// GetUser returns the user stored on the request by Require or Authenticated
+func GetUser(r *http.Request) *data.User {
+	user, _ := r.Context().Value(userKey).(*data.User)
+	return user
+}
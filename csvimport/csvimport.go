@@ -0,0 +1,145 @@
+package csvimport
+
+import (
+	"bytes"
+	"carHiringWebsite/data"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxReportErrors limits how many rejected rows are kept in an import report
+const maxReportErrors = 100
+
+var DatasetRefused = errors.New("dataset refused")
+
+// Format describes the columns of a dataset file. Headers maps each accepted header, lower case with spaces and
+// underscores removed, to its column and Required are the columns a file must have
+type Format struct {
+	Headers  map[string]string
+	Required []string
+	// MaxRejected is the fraction of rows that may be rejected before a whole file is refused
+	MaxRejected float64
+}
+
+// Row reads one record. value returns a column trimmed, or an empty string when the file doesn't have it. The
+// row is accepted when reason is empty, subject identifies it in the report, such as its licence number
+type Row func(value func(column string) string) (subject, reason string)
+
+// Parse validates every row of a CSV dataset, passing each to row and returning a report of those rejected.
+// Columns are found by header so their order doesn't matter and unknown columns are ignored. The returned error
+// is DatasetRefused when the file is unusable or too many rows were rejected
+func Parse(file, hash string, content []byte, format *Format, row Row) (*data.ImportReport, error) {
+
+	report := &data.ImportReport{
+		File:     file,
+		Hash:     hash,
+		Errors:   make([]*data.ImportError, 0),
+		Imported: *data.ConvertDate(time.Now()),
+	}
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return report, refuse(report, "unreadable header: "+err.Error())
+	}
+
+	columns := mapColumns(header, format.Headers)
+	for _, column := range format.Required {
+		if _, ok := columns[column]; !ok {
+			return report, refuse(report, "missing column "+column)
+		}
+	}
+
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		report.Rows++
+
+		//A quoting error can't be skipped past, the rest of the file can't be trusted
+		if err != nil {
+			line := 0
+			var parseError *csv.ParseError
+			if errors.As(err, &parseError) {
+				line = parseError.StartLine
+			}
+			reject(report, line, "", err.Error())
+			return report, refuse(report, "malformed csv at line "+strconv.Itoa(line))
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		if len(rec) != len(header) {
+			reject(report, line, "", fmt.Sprintf("expected %v fields, found %v", len(header), len(rec)))
+			continue
+		}
+
+		subject, reason := row(func(column string) string {
+			i, ok := columns[column]
+			if !ok {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		})
+		if reason != "" {
+			reject(report, line, subject, reason)
+			continue
+		}
+
+		report.Accepted++
+	}
+
+	if report.Accepted == 0 {
+		return report, refuse(report, "no valid rows")
+	}
+
+	if float64(report.Rejected) > float64(report.Rows)*format.MaxRejected {
+		return report, refuse(report, fmt.Sprintf("%v of %v rows rejected", report.Rejected, report.Rows))
+	}
+
+	return report, nil
+}
+
+// mapColumns returns the index of each known column in header, the first wins if a column is repeated
+func mapColumns(header []string, headers map[string]string) map[string]int {
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		key := strings.ToLower(strings.Join(strings.Fields(strings.TrimPrefix(name, "\ufeff")), ""))
+		key = strings.Replace(key, "_", "", -1)
+
+		column, ok := headers[key]
+		if !ok {
+			continue
+		}
+
+		if _, ok := columns[column]; !ok {
+			columns[column] = i
+		}
+	}
+
+	return columns
+}
+
+func reject(report *data.ImportReport, line int, subject, reason string) {
+	report.Rejected++
+
+	if len(report.Errors) < maxReportErrors {
+		report.Errors = append(report.Errors, &data.ImportError{Line: line, LicenseNumber: subject, Reason: reason})
+	}
+}
+
+func refuse(report *data.ImportReport, reason string) error {
+	report.Reason = reason
+
+	return fmt.Errorf("%w, %v: %v", DatasetRefused, report.File, reason)
+}
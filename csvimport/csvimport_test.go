@@ -0,0 +1,101 @@
+package csvimport
+
+import (
+	"errors"
+	"testing"
+)
+
+var testFormat = &Format{
+	Headers:     map[string]string{"licencenumber": "licence", "name": "name", "familyname": "name"},
+	Required:    []string{"licence"},
+	MaxRejected: 0.5,
+}
+
+// parseNames returns the name of each row accepted, rows without one are rejected
+func parseNames(content string, format *Format) ([]string, error) {
+
+	names := make([]string, 0)
+	_, err := Parse("test.csv", "hash", []byte(content), format, func(value func(string) string) (string, string) {
+		if value("name") == "" {
+			return value("licence"), "missing name"
+		}
+		names = append(names, value("name"))
+		return value("licence"), ""
+	})
+
+	return names, err
+}
+
+func TestParseHeaders(t *testing.T) {
+
+	names, err := parseNames("\ufeffLicence_Number, Unknown, Name, Family Name\nA1, x, Smith , Jones\n", testFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "Smith" {
+		t.Errorf("names = %q, want the first name column trimmed", names)
+	}
+
+	_, err = parseNames("name\nSmith\n", testFormat)
+	if !errors.Is(err, DatasetRefused) {
+		t.Errorf("missing required column = %v, want DatasetRefused", err)
+	}
+}
+
+func TestParseReport(t *testing.T) {
+
+	var subjects []string
+	report, err := Parse("test.csv", "hash", []byte("licencenumber,name\nA1,Smith\nA2,\nA3,Jones,extra\nA4,Brown\n"),
+		testFormat, func(value func(string) string) (string, string) {
+			if value("name") == "" {
+				return value("licence"), "missing name"
+			}
+			subjects = append(subjects, value("licence"))
+			return value("licence"), ""
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Rows != 4 || report.Accepted != 2 || report.Rejected != 2 || len(report.Errors) != 2 {
+		t.Fatalf("report = %+v, want 4 rows, 2 accepted and 2 rejected", report)
+	}
+	if report.Errors[0].Line != 3 || report.Errors[0].LicenseNumber != "A2" || report.Errors[0].Reason != "missing name" {
+		t.Errorf("first error = %+v", report.Errors[0])
+	}
+	if report.Errors[1].Line != 4 || report.Errors[1].LicenseNumber != "" {
+		t.Errorf("second error = %+v, want the short row on line 4", report.Errors[1])
+	}
+	if len(subjects) != 2 || subjects[0] != "A1" || subjects[1] != "A4" {
+		t.Errorf("accepted %q", subjects)
+	}
+}
+
+func TestParseRefused(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty file", ""},
+		{"no valid rows", "licencenumber,name\nA1,\n"},
+		{"too many rejected", "licencenumber,name\nA1,Smith\nA2,\nA3,\n"},
+		{"malformed quoting", "licencenumber,name\nA1,\"Smith\nA2,Jones\n"},
+	}
+
+	for _, test := range tests {
+		report, err := Parse("test.csv", "hash", []byte(test.content), testFormat,
+			func(value func(string) string) (string, string) {
+				if value("name") == "" {
+					return "", "missing name"
+				}
+				return "", ""
+			})
+		if !errors.Is(err, DatasetRefused) {
+			t.Errorf("%v: Parse = %v, want DatasetRefused", test.name, err)
+		}
+		if report.Reason == "" {
+			t.Errorf("%v: report has no reason", test.name)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package data
 
 import (
+	"carHiringWebsite/roles"
 	"database/sql"
+	"encoding/json"
 	"strconv"
 	"time"
 )
@@ -43,8 +45,9 @@ type BookingStatusType struct {
 }
 
 type AdminBooking struct {
-	Booking *Booking    `json:"booking"`
-	User    *OutputUser `json:"user"`
+	Booking    *Booking    `json:"booking"`
+	User       *OutputUser `json:"user"`
+	RiskReport *RiskReport `json:"riskReport"`
 }
 
 type ExtensionResponse struct {
@@ -82,6 +85,12 @@ type ImageBundle struct {
 	Document2 string `json:"document2"`
 }
 
+// DocumentURL is a time limited link to a driver's document
+type DocumentURL struct {
+	URL     string     `json:"url"`
+	Expires *timestamp `json:"expires"`
+}
+
 type Driver struct {
 	ID            int
 	LastName      string
@@ -100,6 +109,7 @@ type InsurerColumn struct {
 	FisrtName   string
 	DOB         timestamp
 	Address     string
+	PostCode    string
 	DOC         timestamp
 	InsurerCode string
 }
@@ -182,8 +192,30 @@ type Car struct {
 	Image        string     `json:"Image"`
 	Seats        int        `json:"Seats"`
 	Disabled     bool
-	BookingCount int  `json:"BookingCount"`
-	Over25       bool `json:"Over25"`
+	BookingCount int            `json:"BookingCount"`
+	Over25       bool           `json:"Over25"`
+	Images       *ImageVariants `json:"Images"`
+	Photos       []*CarImage    `json:"Photos"`
+}
+
+// ImageVariants are the URLs a car's image can be loaded from at each size
+type ImageVariants struct {
+	Full      string `json:"full"`
+	Medium    string `json:"medium"`
+	Thumbnail string `json:"thumbnail"`
+}
+
+// CarImage is one of a car's photos, shown in Position order. The primary photo is the car's Image
+type CarImage struct {
+	ID        int            `json:"ID"`
+	CarID     int            `json:"CarID"`
+	FileName  string         `json:"FileName"`
+	Caption   string         `json:"Caption"`
+	Position  int            `json:"Position"`
+	Primary   bool           `json:"Primary"`
+	CreatedBy int            `json:"CreatedBy"`
+	Created   timestamp      `json:"Created"`
+	Images    *ImageVariants `json:"Images"`
 }
 
 func NewCar() *Car {
@@ -229,9 +261,18 @@ type User struct {
 	Verified     bool
 	Repeat       bool
 	SessionToken string
-	Admin        bool
+	Role         roles.Role
 	BookingCount int
 	Disabled     bool
+	RemoteAddr   string
+	// E.164 mobile number used for SMS, empty when not given
+	Phone string
+	// Set when an admin is viewing the site as this user, see session.NewImpersonation
+	ImpersonatorID int
+	ReadOnly       bool
+	// Set when the request was authenticated with an API key, which limits the user to Scopes
+	APIKeyID int
+	Scopes   []roles.Permission
 }
 
 type timestamp struct {
@@ -244,19 +285,25 @@ func ConvertDate(d time.Time) *timestamp {
 
 //OutputUser used for serialisation
 type OutputUser struct {
-	ID           int       `json:"ID,omitempty"`
-	FirstName    string    `json:"FirstName"`
-	Names        string    `json:"Names"`
-	Email        string    `json:"Email"`
-	CreatedAt    timestamp `json:"CreatedAt"`
-	Blacklisted  bool      `json:"Blacklisted"`
-	DOB          timestamp `json:"DOB"`
-	Verified     bool      `json:"Verified"`
-	Repeat       bool      `json:"Repeat"`
-	SessionToken string    `json:"SessionToken"`
-	Admin        bool      `json:"Admin"`
-	BookingCount int       `json:"BookingCount"`
-	Disabled     bool      `json:"Disabled"`
+	ID           int                `json:"ID,omitempty"`
+	FirstName    string             `json:"FirstName"`
+	Names        string             `json:"Names"`
+	Email        string             `json:"Email"`
+	CreatedAt    timestamp          `json:"CreatedAt"`
+	Blacklisted  bool               `json:"Blacklisted"`
+	DOB          timestamp          `json:"DOB"`
+	Verified     bool               `json:"Verified"`
+	Repeat       bool               `json:"Repeat"`
+	SessionToken string             `json:"SessionToken"`
+	Admin        bool               `json:"Admin"`
+	Role         roles.Role         `json:"Role"`
+	Permissions  []roles.Permission `json:"Permissions"`
+	BookingCount int                `json:"BookingCount"`
+	Disabled     bool               `json:"Disabled"`
+	Phone        string             `json:"Phone"`
+	// Set when an admin is viewing the site as this user
+	ImpersonatedBy int  `json:"ImpersonatedBy,omitempty"`
+	ReadOnly       bool `json:"ReadOnly,omitempty"`
 }
 
 type BookingStatus struct {
@@ -274,6 +321,314 @@ type BookingStatus struct {
 	Extra              float64   `json:"Extra"`
 }
 
+type AuditEntry struct {
+	ID             int       `json:"ID"`
+	ActorID        int       `json:"ActorID"`
+	ActorEmail     string    `json:"ActorEmail"`
+	ImpersonatorID int       `json:"ImpersonatorID"`
+	Action         string    `json:"Action"`
+	EntityType     string    `json:"EntityType"`
+	EntityID       int       `json:"EntityID"`
+	Before         string    `json:"Before"`
+	After          string    `json:"After"`
+	IP             string    `json:"IP"`
+	Redacted       bool      `json:"Redacted"`
+	Created        timestamp `json:"Created"`
+}
+
+type AuditFilter struct {
+	ActorID    int
+	Action     string
+	EntityType string
+	EntityID   int
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+type APIKey struct {
+	ID          int                `json:"ID"`
+	Name        string             `json:"Name"`
+	Prefix      string             `json:"Prefix"`
+	KeyHash     string             `json:"-"`
+	Scopes      []roles.Permission `json:"Scopes"`
+	CreatedBy   int                `json:"CreatedBy"`
+	CreatorName string             `json:"CreatorName"`
+	Created     timestamp          `json:"Created"`
+	Expires     timestamp          `json:"Expires"`
+	LastUsed    timestamp          `json:"LastUsed"`
+	Revoked     timestamp          `json:"Revoked"`
+	// Only set in the response to creating a key, it is never stored
+	Key string `json:"Key,omitempty"`
+}
+
+type NotificationPreferences struct {
+	UserID int  `json:"UserID"`
+	Email  bool `json:"Email"`
+	SMS    bool `json:"SMS"`
+	// NonEssential is false once the user has unsubscribed from messages they don't need
+	NonEssential     bool   `json:"NonEssential"`
+	UnsubscribeToken string `json:"-"`
+}
+
+type OutboxMessage struct {
+	ID             int       `json:"ID"`
+	IdempotencyKey string    `json:"IdempotencyKey"`
+	Channel        string    `json:"Channel"`
+	Template       string    `json:"Template"`
+	Reference      string    `json:"Reference"`
+	From           string    `json:"From"`
+	To             []string  `json:"To"`
+	Subject        string    `json:"Subject"`
+	Text           string    `json:"-"`
+	HTML           string    `json:"-"`
+	Attachments    string    `json:"-"`
+	Status         string    `json:"Status"`
+	Attempts       int       `json:"Attempts"`
+	LastError      string    `json:"LastError"`
+	NextAttempt    timestamp `json:"NextAttempt"`
+	Created        timestamp `json:"Created"`
+	Sent           timestamp `json:"Sent"`
+}
+
+type OutboxStatus struct {
+	Counts   map[string]int   `json:"Counts"`
+	Messages []*OutboxMessage `json:"Messages"`
+}
+
+// AlertReport is the machine readable copy of a regulatory alert, sent as JSON and CSV alongside the email
+type AlertReport struct {
+	AlertID          int       `json:"AlertID"`
+	Authority        string    `json:"Authority"`
+	Offence          string    `json:"Offence"`
+	Company          string    `json:"Company"`
+	CompanyReference string    `json:"CompanyReference"`
+	Branch           string    `json:"Branch"`
+	BranchAddress    string    `json:"BranchAddress"`
+	BranchPhone      string    `json:"BranchPhone"`
+	DriverID         int       `json:"DriverID"`
+	LicenseNumber    string    `json:"LicenseNumber"`
+	LastName         string    `json:"LastName"`
+	Names            string    `json:"Names"`
+	DOB              string    `json:"DOB"`
+	Address          string    `json:"Address"`
+	PostCode         string    `json:"PostCode"`
+	BookingID        int       `json:"BookingID"`
+	Occurred         time.Time `json:"Occurred"`
+}
+
+// DatasetStatus describes the regulator data currently loaded
+type DatasetStatus struct {
+	File      string    `json:"File"`
+	Hash      string    `json:"Hash"`
+	Rows      int       `json:"Rows"`
+	Modified  timestamp `json:"Modified"`
+	Loaded    timestamp `json:"Loaded"`
+	Checked   timestamp `json:"Checked"`
+	LastError string    `json:"LastError"`
+
+	LastImport *ImportReport `json:"LastImport"`
+}
+
+// ImportReport is the result of validating a dataset file, Activated is false when the file was refused
+type ImportReport struct {
+	File      string         `json:"File"`
+	Hash      string         `json:"Hash"`
+	Rows      int            `json:"Rows"`
+	Accepted  int            `json:"Accepted"`
+	Rejected  int            `json:"Rejected"`
+	Errors    []*ImportError `json:"Errors"`
+	Activated bool           `json:"Activated"`
+	Reason    string         `json:"Reason"`
+	Imported  timestamp      `json:"Imported"`
+}
+
+type ImportError struct {
+	Line          int    `json:"Line"`
+	LicenseNumber string `json:"LicenseNumber"`
+	Reason        string `json:"Reason"`
+}
+
+// DatasetImport is a DVLA or ABI file uploaded by an admin
+type DatasetImport struct {
+	ID          int           `json:"ID"`
+	Dataset     string        `json:"Dataset"`
+	FileName    string        `json:"FileName"`
+	StoredFile  string        `json:"-"`
+	Hash        string        `json:"Hash"`
+	Size        int64         `json:"Size"`
+	Status      string        `json:"Status"`
+	Report      *ImportReport `json:"Report"`
+	UploadedBy  int           `json:"UploadedBy"`
+	Uploaded    timestamp     `json:"Uploaded"`
+	ActivatedBy int           `json:"ActivatedBy"`
+	Activated   timestamp     `json:"Activated"`
+}
+
+// DatasetPreview is an import with the first records accepted from the file
+type DatasetPreview struct {
+	Import  *DatasetImport `json:"Import"`
+	Preview interface{}    `json:"Preview"`
+}
+
+// ClaimMatch is an ABI claim scored against a driver, each part and the weighted Score from 0 to 1
+type ClaimMatch struct {
+	Claim      *InsurerColumn `json:"Claim"`
+	Score      float64        `json:"Score"`
+	FamilyName float64        `json:"FamilyName"`
+	Forenames  float64        `json:"Forenames"`
+	DOB        float64        `json:"DOB"`
+	PostCode   float64        `json:"PostCode"`
+	Address    float64        `json:"Address"`
+}
+
+// ClaimMatchResult is the outcome of checking a driver against the ABI register, Decision is clear, review or match
+type ClaimMatchResult struct {
+	Score           float64       `json:"Score"`
+	Decision        string        `json:"Decision"`
+	MatchThreshold  float64       `json:"MatchThreshold"`
+	ReviewThreshold float64       `json:"ReviewThreshold"`
+	Matches         []*ClaimMatch `json:"Matches"`
+}
+
+// DriverReview is a driver check held for an admin to decide, Evidence is the JSON the check produced
+type DriverReview struct {
+	ID         int             `json:"ID"`
+	Kind       string          `json:"Kind"`
+	Subject    string          `json:"-"`
+	BookingID  int             `json:"BookingID"`
+	DriverID   int             `json:"DriverID"`
+	LastName   string          `json:"LastName"`
+	Names      string          `json:"Names"`
+	DOB        timestamp       `json:"DOB"`
+	Address    string          `json:"Address"`
+	PostCode   string          `json:"PostCode"`
+	License    string          `json:"License"`
+	Score      float64         `json:"Score"`
+	Evidence   json.RawMessage `json:"Evidence"`
+	Status     string          `json:"Status"`
+	RaisedBy   int             `json:"RaisedBy"`
+	Created    timestamp       `json:"Created"`
+	ReviewedBy int             `json:"ReviewedBy"`
+	Reviewed   timestamp       `json:"Reviewed"`
+	Reason     string          `json:"Reason"`
+}
+
+// RiskSubject is the driver presented for a booking, as entered by the admin verifying them
+type RiskSubject struct {
+	LastName string    `json:"LastName"`
+	Names    string    `json:"Names"`
+	DOB      time.Time `json:"DOB"`
+	Address  string    `json:"Address"`
+	PostCode string    `json:"PostCode"`
+	License  string    `json:"License"`
+}
+
+// RiskCheck is the result of one driver check, Error names what was found when it didn't pass
+type RiskCheck struct {
+	Name     string      `json:"Name"`
+	Result   string      `json:"Result"`
+	Score    float64     `json:"Score"`
+	Error    string      `json:"Error"`
+	Evidence interface{} `json:"Evidence"`
+}
+
+// RiskReport is every check made on a driver for a booking, Decision is the most severe result.
+// ReviewID is the admin review a borderline or failed result was sent to, Overridden is set when an
+// admin allowed the driver despite a failed check
+type RiskReport struct {
+	ID         int                `json:"ID"`
+	BookingID  int                `json:"BookingID"`
+	DriverID   int                `json:"DriverID"`
+	Subject    *RiskSubject       `json:"Subject"`
+	Decision   string             `json:"Decision"`
+	Error      string             `json:"Error"`
+	ReviewID   int                `json:"ReviewID"`
+	Overridden bool               `json:"Overridden"`
+	Checks     []*RiskCheck       `json:"Checks"`
+	Thresholds map[string]float64 `json:"Thresholds"`
+	AssessedBy int                `json:"AssessedBy"`
+	Assessed   timestamp          `json:"Assessed"`
+}
+
+// LegalHold stops retention purges removing the files of a user, booking or driver until it's released
+type LegalHold struct {
+	ID            int       `json:"ID"`
+	EntityType    string    `json:"EntityType"`
+	EntityID      int       `json:"EntityID"`
+	Reason        string    `json:"Reason"`
+	PlacedBy      int       `json:"PlacedBy"`
+	Placed        timestamp `json:"Placed"`
+	ReleasedBy    int       `json:"ReleasedBy"`
+	Released      timestamp `json:"Released"`
+	ReleaseReason string    `json:"ReleaseReason"`
+}
+
+// FinishedBooking is a completed or cancelled booking, Finished is when it reached that status
+type FinishedBooking struct {
+	ID       int
+	UserID   int
+	DriverID int
+	Finished time.Time
+}
+
+// PurgedFile is a file a retention purge removed, or would have removed on a dry run. Retained is when the
+// retention period started, the booking finishing or for files not linked to a booking when they were written
+type PurgedFile struct {
+	Type      string `json:"Type"`
+	Key       string `json:"Key"`
+	BookingID int    `json:"BookingID"`
+	DriverID  int    `json:"DriverID"`
+	Size      int64  `json:"Size"`
+	Retained  string `json:"Retained"`
+}
+
+// PurgeReport is the outcome of a retention purge run, Held counts expired files kept for a legal hold
+type PurgeReport struct {
+	ID       int           `json:"ID"`
+	DryRun   bool          `json:"DryRun"`
+	RanBy    int           `json:"RanBy"`
+	Started  timestamp     `json:"Started"`
+	Finished timestamp     `json:"Finished"`
+	Removed  []*PurgedFile `json:"Removed"`
+	Bytes    int64         `json:"Bytes"`
+	Held     int           `json:"Held"`
+	Errors   []string      `json:"Errors"`
+}
+
+// DriverReviewDetail is a review with the evidence an admin needs to decide it, the driver's other reviews are
+// every earlier decision about them
+type DriverReviewDetail struct {
+	Review     *DriverReview   `json:"Review"`
+	Driver     *Driver         `json:"Driver"`
+	RiskReport *RiskReport     `json:"RiskReport"`
+	History    []*DriverReview `json:"History"`
+}
+
+type RegulatoryAlert struct {
+	ID           int          `json:"ID"`
+	Authority    string       `json:"Authority"`
+	Offence      string       `json:"Offence"`
+	DriverID     int          `json:"DriverID"`
+	BookingID    int          `json:"BookingID"`
+	RaisedBy     int          `json:"RaisedBy"`
+	OutboxID     int          `json:"OutboxID"`
+	OutboxStatus string       `json:"OutboxStatus"`
+	Report       *AlertReport `json:"Report"`
+	Created      timestamp    `json:"Created"`
+}
+
+type ErasureRequest struct {
+	ID        int       `json:"ID"`
+	UserID    int       `json:"UserID"`
+	UserEmail string    `json:"UserEmail"`
+	Requested timestamp `json:"Requested"`
+	Status    string    `json:"Status"`
+	AdminID   int       `json:"AdminID"`
+	Processed timestamp `json:"Processed"`
+	Reason    string    `json:"Reason"`
+}
+
 type Response struct {
 	ID string `json:"ID"`
 }
@@ -297,9 +652,15 @@ func NewOutputUser(u *User) *OutputUser {
 		Verified:     u.Verified,
 		Repeat:       u.Repeat,
 		SessionToken: u.SessionToken,
-		Admin:        u.Admin,
+		Admin:        roles.IsStaff(u.Role),
+		Role:         u.Role,
+		Permissions:  roles.Permissions(u.Role),
 		BookingCount: u.BookingCount,
 		Disabled:     u.Disabled,
+		Phone:        u.Phone,
 		ID:           u.ID,
+
+		ImpersonatedBy: u.ImpersonatorID,
+		ReadOnly:       u.ReadOnly,
 	}
 }
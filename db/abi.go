@@ -0,0 +1,149 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"database/sql"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Database ABI Claims Logic
+//
+// abifraudclaims rows belong to the abidatasets row with the same hash, one dataset is active at a time
+
+const abiInsertBatch = 500
+
+//GetActiveABIDataset returns the hash of the active dataset, or "" if none has been imported
+func GetActiveABIDataset() (string, error) {
+
+	hash := ""
+
+	rows, err := conn.Query(`SELECT hash FROM abidatasets WHERE active = 1`)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		err = rows.Scan(&hash)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hash, nil
+}
+
+//ImportABIDataset replaces the active claims with claims in a single transaction, so checks see the
+//old or the new dataset and never a partial one. Claims from older datasets are deleted
+func ImportABIDataset(hash, fileName string, claims []*data.InsurerColumn) error {
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM abifraudclaims WHERE dataset = ?`, hash)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(claims); start += abiInsertBatch {
+		end := start + abiInsertBatch
+		if end > len(claims) {
+			end = len(claims)
+		}
+
+		placeholders := make([]string, 0, end-start)
+		values := make([]interface{}, 0, (end-start)*9)
+		for _, claim := range claims[start:end] {
+
+			var claimDate interface{}
+			if !claim.DOC.IsZero() {
+				claimDate = claim.DOC.Time
+			}
+
+			placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?, ?)")
+			values = append(values, hash, claim.LastName, claim.FisrtName, claim.DOB.Time, claim.Address, claim.PostCode,
+				postcodeKey(claim.PostCode), claimDate, claim.InsurerCode)
+		}
+
+		_, err = tx.Exec(`INSERT INTO abifraudclaims(dataset, familyName, forenames, dob, address, postcode, postcodeKey, claimDate, insurerCode)
+							VALUES `+strings.Join(placeholders, ", "), values...)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO abidatasets(hash, fileName, rowCount, loaded, active) VALUES(?, ?, ?, ?, 0)
+							ON DUPLICATE KEY UPDATE fileName = VALUES(fileName), rowCount = VALUES(rowCount), loaded = VALUES(loaded)`,
+		hash, fileName, len(claims), time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE abidatasets SET active = (hash = ?)`, hash)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM abifraudclaims WHERE dataset <> ?`, hash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//GetABICandidates returns the claims in the active dataset with the date of birth or postcode, postcode is
+//upper case without spaces
+func GetABICandidates(dob time.Time, postcode string) ([]*data.InsurerColumn, error) {
+
+	rows, err := conn.Query(`SELECT c.id, c.familyName, c.forenames, c.dob, c.address, c.postcode, c.claimDate, c.insurerCode
+								FROM abifraudclaims c
+								JOIN abidatasets d ON d.hash = c.dataset AND d.active = 1
+								WHERE c.dob = ? OR c.postcodeKey = ?`,
+		dob.UTC().Format("2006-01-02"), postcode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := make([]*data.InsurerColumn, 0)
+	for rows.Next() {
+
+		var (
+			claimDOB  time.Time
+			claimDate sql.NullTime
+		)
+
+		claim := &data.InsurerColumn{}
+		err = rows.Scan(&claim.ID, &claim.LastName, &claim.FisrtName, &claimDOB, &claim.Address, &claim.PostCode,
+			&claimDate, &claim.InsurerCode)
+		if err != nil {
+			return nil, err
+		}
+
+		claim.DOB = *data.ConvertDate(claimDOB)
+		if claimDate.Valid {
+			claim.DOC = *data.ConvertDate(claimDate.Time)
+		}
+
+		claims = append(claims, claim)
+	}
+
+	return claims, rows.Err()
+}
+
+// postcodeKey is the postcode as GetABICandidates searches for it, upper case letters and digits only
+func postcodeKey(postcode string) string {
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, postcode)
+}
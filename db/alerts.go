@@ -0,0 +1,130 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Database Regulatory Alert Logic
+//
+// report holds the JSON AlertReport sent to the authority, outboxID is 0 until the email is queued
+
+const alertColumns = `a.id, a.authority, a.offence, a.driverID, a.bookingID, a.raisedBy, a.outboxID,
+	COALESCE(o.status, ''), a.report, a.created`
+
+//InsertRegulatoryAlert records an alert, returning the ID of the existing alert if the idempotency key has already been used
+func InsertRegulatoryAlert(key string, alert *data.RegulatoryAlert) (int, error) {
+
+	report, err := json.Marshal(alert.Report)
+	if err != nil {
+		return 0, err
+	}
+
+	//Prepared statements
+	insertAlert, err := conn.Prepare(`INSERT INTO regulatoryalerts(idempotencyKey, authority, offence, driverID, bookingID, raisedBy, report, created)
+											VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+											ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertAlert.Close()
+
+	res, err := insertAlert.Exec(key, alert.Authority, alert.Offence, alert.DriverID, alert.BookingID, alert.RaisedBy, string(report), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	alertID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if alertID == 0 {
+		return 0, errors.New("no alert inserted")
+	}
+
+	return int(alertID), nil
+}
+
+//SetRegulatoryAlertSent stores the final report and the outbox message it was queued as
+func SetRegulatoryAlertSent(id, outboxID int, report *data.AlertReport) error {
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Exec(`UPDATE regulatoryalerts SET outboxID = ?, report = ? WHERE (id = ?)`, outboxID, string(reportJSON), id)
+
+	return err
+}
+
+func GetRegulatoryAlert(id int) (*data.RegulatoryAlert, error) {
+
+	rows, err := conn.Query(`SELECT `+alertColumns+` FROM regulatoryalerts a
+								LEFT JOIN notificationoutbox o ON o.id = a.outboxID
+								WHERE (a.id = ?)`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts, err := readAlertRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(alerts) == 0 {
+		return nil, nil
+	}
+
+	return alerts[0], nil
+}
+
+//GetRegulatoryAlerts returns the latest alerts, newest first, optionally for one authority
+func GetRegulatoryAlerts(authority string, limit int) ([]*data.RegulatoryAlert, error) {
+
+	rows, err := conn.Query(`SELECT `+alertColumns+` FROM regulatoryalerts a
+								LEFT JOIN notificationoutbox o ON o.id = a.outboxID
+								WHERE (? = '' OR a.authority = ?)
+								ORDER BY a.created DESC, a.id DESC LIMIT ?`, authority, authority, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readAlertRows(rows)
+}
+
+func readAlertRows(rows *sql.Rows) ([]*data.RegulatoryAlert, error) {
+	var (
+		report  string
+		created time.Time
+	)
+
+	alerts := make([]*data.RegulatoryAlert, 0)
+	for rows.Next() {
+
+		alert := &data.RegulatoryAlert{Report: &data.AlertReport{}}
+
+		err := rows.Scan(&alert.ID, &alert.Authority, &alert.Offence, &alert.DriverID, &alert.BookingID, &alert.RaisedBy,
+			&alert.OutboxID, &alert.OutboxStatus, &report, &created)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(report), alert.Report)
+		if err != nil {
+			return nil, err
+		}
+
+		alert.Created = *data.ConvertDate(created)
+
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, nil
+}
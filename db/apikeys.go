@@ -0,0 +1,160 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"carHiringWebsite/roles"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Database API Key Logic
+//
+// scopes are stored as a comma separated list of permissions
+
+func InsertAPIKey(name, prefix, keyHash string, scopes []roles.Permission, createdBy int, expires time.Time) (int, error) {
+
+	//Prepared statements
+	insertKey, err := conn.Prepare(`INSERT INTO apikeys(name, prefix, keyHash, scopes, createdBy, created, expires)
+												VALUES(?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertKey.Close()
+
+	res, err := insertKey.Exec(name, prefix, keyHash, joinScopes(scopes), createdBy, time.Now(), expires)
+	if err != nil {
+		return 0, err
+	}
+
+	keyID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if keyID == 0 {
+		return 0, errors.New("no api key inserted")
+	}
+
+	return int(keyID), nil
+}
+
+func GetAPIKeyByPrefix(prefix string) (*data.APIKey, error) {
+
+	row := conn.QueryRow(`SELECT k.id, k.name, k.prefix, k.keyHash, k.scopes, k.createdBy, IFNULL(users.email, ''), k.created, k.expires, k.lastUsed, k.revoked
+								FROM apikeys as k
+								LEFT JOIN users ON k.createdBy = users.id
+								WHERE k.prefix = ?`, prefix)
+
+	return readAPIKey(row)
+}
+
+func GetAPIKey(id int) (*data.APIKey, error) {
+
+	row := conn.QueryRow(`SELECT k.id, k.name, k.prefix, k.keyHash, k.scopes, k.createdBy, IFNULL(users.email, ''), k.created, k.expires, k.lastUsed, k.revoked
+								FROM apikeys as k
+								LEFT JOIN users ON k.createdBy = users.id
+								WHERE k.id = ?`, id)
+
+	return readAPIKey(row)
+}
+
+func GetAPIKeys() ([]*data.APIKey, error) {
+
+	rows, err := conn.Query(`SELECT k.id, k.name, k.prefix, k.keyHash, k.scopes, k.createdBy, IFNULL(users.email, ''), k.created, k.expires, k.lastUsed, k.revoked
+								FROM apikeys as k
+								LEFT JOIN users ON k.createdBy = users.id
+								ORDER BY k.created DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*data.APIKey, 0)
+	for rows.Next() {
+
+		key, err := readAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func readAPIKey(row scanner) (*data.APIKey, error) {
+	var (
+		scopes   string
+		created  time.Time
+		expires  time.Time
+		lastUsed sql.NullTime
+		revoked  sql.NullTime
+	)
+
+	key := &data.APIKey{}
+
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedBy, &key.CreatorName, &created, &expires, &lastUsed, &revoked)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = splitScopes(scopes)
+	key.Created = *data.ConvertDate(created)
+	key.Expires = *data.ConvertDate(expires)
+	key.LastUsed = *data.ConvertDate(lastUsed.Time)
+	key.Revoked = *data.ConvertDate(revoked.Time)
+
+	return key, nil
+}
+
+func RevokeAPIKey(id int) error {
+
+	result, err := conn.Exec(`UPDATE apikeys SET revoked = ? WHERE (id = ?) AND revoked IS NULL`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("no rows affected")
+	}
+
+	return nil
+}
+
+func SetAPIKeyLastUsed(id int, lastUsed time.Time) error {
+
+	_, err := conn.Exec(`UPDATE apikeys SET lastUsed = ? WHERE (id = ?)`, lastUsed, id)
+
+	return err
+}
+
+func joinScopes(scopes []roles.Permission) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+
+	return strings.Join(names, ",")
+}
+
+func splitScopes(scopes string) []roles.Permission {
+	permissions := make([]roles.Permission, 0)
+	for _, name := range strings.Split(scopes, ",") {
+		if name != "" {
+			permissions = append(permissions, roles.Permission(name))
+		}
+	}
+
+	return permissions
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"errors"
+	"time"
+)
+
+// Database Audit Logic
+//
+// auditlog is append-only, rows are never updated or deleted (see migrations/002_audit_log.sql). Entries about an
+// erased user are masked by a row in auditredactions, so they're read through the auditlog_redacted view
+
+func InsertAuditEntry(actorID, impersonatorID int, action, entityType string, entityID int, before, after, ip string) (int, error) {
+
+	//Prepared statements
+	insertEntry, err := conn.Prepare("INSERT INTO auditlog(actorID, impersonatorID, action, entityType, entityID, `before`, `after`, ip, created) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, err
+	}
+	defer insertEntry.Close()
+
+	res, err := insertEntry.Exec(actorID, impersonatorID, action, entityType, entityID, before, after, ip, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	entryID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if entryID == 0 {
+		return 0, errors.New("no audit entry inserted")
+	}
+
+	return int(entryID), nil
+}
+
+func GetAuditEntries(filter *data.AuditFilter) ([]*data.AuditEntry, error) {
+	var created time.Time
+
+	args := []interface{}{}
+
+	sql := `SELECT a.id, a.actorID, IFNULL(users.email, ''), a.impersonatorID, a.action, a.entityType, a.entityID, a.before, a.after, a.ip, a.redacted, a.created
+	FROM auditlog_redacted as a
+	LEFT JOIN users ON a.actorID = users.id
+	WHERE 1 = 1 `
+
+	if filter.ActorID != 0 {
+		sql += `AND a.actorID = ? `
+		args = append(args, filter.ActorID)
+	}
+	if filter.Action != "" {
+		sql += `AND a.action = ? `
+		args = append(args, filter.Action)
+	}
+	if filter.EntityType != "" {
+		sql += `AND a.entityType = ? `
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID != 0 {
+		sql += `AND a.entityID = ? `
+		args = append(args, filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		sql += `AND a.created >= ? `
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		sql += `AND a.created <= ? `
+		args = append(args, filter.To)
+	}
+
+	sql += `ORDER BY a.created DESC, a.id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := conn.Query(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*data.AuditEntry, 0, filter.Limit)
+	for rows.Next() {
+
+		entry := &data.AuditEntry{}
+
+		err := rows.Scan(&entry.ID, &entry.ActorID, &entry.ActorEmail, &entry.ImpersonatorID, &entry.Action, &entry.EntityType, &entry.EntityID, &entry.Before, &entry.After, &entry.IP, &entry.Redacted, &created)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Created = *data.ConvertDate(created)
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
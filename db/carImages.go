@@ -0,0 +1,257 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Database Car Image Logic
+//
+// A car with photos has exactly one primary photo, cars.image is kept as its file name
+
+const carImageColumns = `id, carID, fileName, caption, position, isPrimary, createdBy, created`
+
+//InsertCarImage adds a photo after the car's others. The car's first photo is always its primary one
+func InsertCarImage(carID int, fileName, caption string, primary bool, createdBy int) (int, error) {
+	var (
+		position int
+		count    int
+	)
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`SELECT COALESCE(MAX(position) + 1, 0), COUNT(*) FROM car_images WHERE carID = ? FOR UPDATE`,
+		carID).Scan(&position, &count)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`INSERT INTO car_images(carID, fileName, caption, position, isPrimary, createdBy, created)
+							VALUES(?, ?, ?, ?, 0, ?, ?)`, carID, fileName, caption, position, createdBy, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	imageID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if imageID == 0 {
+		return 0, errors.New("no car image inserted")
+	}
+
+	if primary || count == 0 {
+		err = setPrimaryCarImage(tx, carID, int(imageID))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int(imageID), tx.Commit()
+}
+
+//GetCarImage returns nil if there's no photo with the ID
+func GetCarImage(id int) (*data.CarImage, error) {
+
+	rows, err := conn.Query(`SELECT `+carImageColumns+` FROM car_images WHERE (id = ?)`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images, err := readCarImageRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(images) == 0 {
+		return nil, nil
+	}
+
+	return images[0], nil
+}
+
+//GetCarImages returns the car's photos in the order they're shown
+func GetCarImages(carID int) ([]*data.CarImage, error) {
+
+	rows, err := conn.Query(`SELECT `+carImageColumns+` FROM car_images WHERE carID = ? ORDER BY position, id`, carID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readCarImageRows(rows)
+}
+
+func readCarImageRows(rows *sql.Rows) ([]*data.CarImage, error) {
+	var created time.Time
+
+	images := make([]*data.CarImage, 0)
+	for rows.Next() {
+
+		image := &data.CarImage{}
+
+		err := rows.Scan(&image.ID, &image.CarID, &image.FileName, &image.Caption, &image.Position, &image.Primary,
+			&image.CreatedBy, &created)
+		if err != nil {
+			return nil, err
+		}
+
+		image.Created = *data.ConvertDate(created)
+
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
+
+//UpdateCarImage sets the photo's caption, making it the car's primary photo if primary is set. A primary photo
+//stops being one only when another is made primary or it's deleted
+func UpdateCarImage(id int, caption string, primary bool) error {
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	carID := 0
+	err = tx.QueryRow(`SELECT carID FROM car_images WHERE (id = ?) FOR UPDATE`, id).Scan(&carID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE car_images SET caption = ? WHERE (id = ?)`, caption, id)
+	if err != nil {
+		return err
+	}
+
+	if primary {
+		err = setPrimaryCarImage(tx, carID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+//ReorderCarImages sets the position of each of the car's photos to its index in imageIDs
+func ReorderCarImages(carID int, imageIDs []int) error {
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for position, imageID := range imageIDs {
+		_, err = tx.Exec(`UPDATE car_images SET position = ? WHERE (id = ?) AND carID = ?`, position, imageID, carID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+//DeleteCarImage removes the photo. If it was the primary photo the next one in order takes its place, the car
+//is left with no image when it was the last
+func DeleteCarImage(id int) error {
+	var (
+		carID   int
+		primary bool
+	)
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`SELECT carID, isPrimary FROM car_images WHERE (id = ?) FOR UPDATE`, id).Scan(&carID, &primary)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM car_images WHERE (id = ?)`, id)
+	if err != nil {
+		return err
+	}
+
+	if primary {
+		nextID := 0
+		err = tx.QueryRow(`SELECT id FROM car_images WHERE carID = ? ORDER BY position, id LIMIT 1`, carID).Scan(&nextID)
+		if err == sql.ErrNoRows {
+			_, err = tx.Exec(`UPDATE cars SET image = '' WHERE (id = ?)`, carID)
+		} else if err == nil {
+			err = setPrimaryCarImage(tx, carID, nextID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+//ReplaceCarImageFile points the photo at a new file, keeping its place in the car's order
+func ReplaceCarImageFile(id int, fileName string) error {
+	var (
+		carID   int
+		primary bool
+	)
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`SELECT carID, isPrimary FROM car_images WHERE (id = ?) FOR UPDATE`, id).Scan(&carID, &primary)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE car_images SET fileName = ? WHERE (id = ?)`, fileName, id)
+	if err != nil {
+		return err
+	}
+
+	if primary {
+		_, err = tx.Exec(`UPDATE cars SET image = ? WHERE (id = ?)`, fileName, carID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func setPrimaryCarImage(tx *sql.Tx, carID, id int) error {
+
+	_, err := tx.Exec(`UPDATE car_images SET isPrimary = (id = ?) WHERE carID = ?`, id, carID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE cars SET image = (SELECT fileName FROM car_images WHERE (id = ?)) WHERE (id = ?)`, id, carID)
+
+	return err
+}
+
+//CountCarImageFile returns how many photos use the file, images named from the description before car_images can be shared
+func CountCarImageFile(fileName string) (int, error) {
+
+	count := 0
+	err := conn.QueryRow(`SELECT COUNT(*) FROM car_images WHERE fileName = ?`, fileName).Scan(&count)
+
+	return count, err
+}
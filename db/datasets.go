@@ -0,0 +1,167 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Database Dataset Import Logic
+//
+// One active import per dataset at most, activating another moves the previous one to superseded
+
+const datasetImportColumns = `id, dataset, fileName, storedFile, hash, size, status, report, uploadedBy, uploaded, activatedBy, activated`
+
+func InsertDatasetImport(datasetImport *data.DatasetImport) (int, error) {
+
+	report, err := json.Marshal(datasetImport.Report)
+	if err != nil {
+		return 0, err
+	}
+
+	//Prepared statements
+	insertImport, err := conn.Prepare(`INSERT INTO datasetimports(dataset, fileName, storedFile, hash, size, status, report, uploadedBy, uploaded)
+											VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertImport.Close()
+
+	res, err := insertImport.Exec(datasetImport.Dataset, datasetImport.FileName, datasetImport.StoredFile, datasetImport.Hash,
+		datasetImport.Size, datasetImport.Status, string(report), datasetImport.UploadedBy, datasetImport.Uploaded.Time)
+	if err != nil {
+		return 0, err
+	}
+
+	importID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if importID == 0 {
+		return 0, errors.New("no dataset import inserted")
+	}
+
+	return int(importID), nil
+}
+
+//SetStoredFile records where the uploaded file was saved, named after the import ID
+func SetStoredFile(id int, storedFile string) error {
+
+	_, err := conn.Exec(`UPDATE datasetimports SET storedFile = ? WHERE (id = ?)`, storedFile, id)
+
+	return err
+}
+
+func GetDatasetImport(id int) (*data.DatasetImport, error) {
+
+	rows, err := conn.Query(`SELECT `+datasetImportColumns+` FROM datasetimports WHERE (id = ?)`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	imports, err := readDatasetImportRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(imports) == 0 {
+		return nil, nil
+	}
+
+	return imports[0], nil
+}
+
+//GetDatasetImports returns the latest uploads of a dataset, newest first
+func GetDatasetImports(dataset string, limit int) ([]*data.DatasetImport, error) {
+
+	rows, err := conn.Query(`SELECT `+datasetImportColumns+` FROM datasetimports WHERE dataset = ?
+								ORDER BY uploaded DESC, id DESC LIMIT ?`, dataset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readDatasetImportRows(rows)
+}
+
+//GetPreviousDatasetImport returns the import active before the current one, or nil if there is none
+func GetPreviousDatasetImport(dataset string) (*data.DatasetImport, error) {
+
+	rows, err := conn.Query(`SELECT `+datasetImportColumns+` FROM datasetimports WHERE dataset = ? AND status = 'superseded'
+								ORDER BY activated DESC, id DESC LIMIT 1`, dataset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	imports, err := readDatasetImportRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(imports) == 0 {
+		return nil, nil
+	}
+
+	return imports[0], nil
+}
+
+func readDatasetImportRows(rows *sql.Rows) ([]*data.DatasetImport, error) {
+	var (
+		report    string
+		uploaded  time.Time
+		activated sql.NullTime
+	)
+
+	imports := make([]*data.DatasetImport, 0)
+	for rows.Next() {
+
+		datasetImport := &data.DatasetImport{Report: &data.ImportReport{}}
+
+		err := rows.Scan(&datasetImport.ID, &datasetImport.Dataset, &datasetImport.FileName, &datasetImport.StoredFile,
+			&datasetImport.Hash, &datasetImport.Size, &datasetImport.Status, &report, &datasetImport.UploadedBy, &uploaded,
+			&datasetImport.ActivatedBy, &activated)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(report), datasetImport.Report)
+		if err != nil {
+			return nil, err
+		}
+
+		datasetImport.Uploaded = *data.ConvertDate(uploaded)
+		datasetImport.Activated = *data.ConvertDate(activated.Time)
+
+		imports = append(imports, datasetImport)
+	}
+
+	return imports, nil
+}
+
+//ActivateDatasetImport marks the import active and the previously active import of the dataset superseded
+func ActivateDatasetImport(id, activatedBy int, dataset string) error {
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE datasetimports SET status = 'superseded' WHERE dataset = ? AND status = 'active'`, dataset)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE datasetimports SET status = 'active', activatedBy = ?, activated = ? WHERE (id = ?)`,
+		activatedBy, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"carHiringWebsite/data"
+	"carHiringWebsite/roles"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -19,6 +20,9 @@ var (
 	Pass    *string
 	Address *string
 	Schema  *string
+
+	// BookingStatusListener is called after every booking status is inserted, see notificationService
+	BookingStatusListener func(statusID, bookingID, processID int, extra float64, description string)
 )
 
 func InitDB() error {
@@ -43,18 +47,19 @@ func CloseDB() error {
 //
 //
 
-func CreateCar(fuelType, gearType, carType, size, colour, seats, price int, disabled, over25 bool, fileName, description string) (int, error) {
+//CreateCar inserts a car with no image, photos are added to car_images after
+func CreateCar(fuelType, gearType, carType, size, colour, seats, price int, disabled, over25 bool, description string) (int, error) {
 
 	//Prepared statements
 	createCar, err := conn.Prepare(`INSERT INTO cars
 							(fuelType, gearType, carType, size, colour, cost, description, image, seats, disabled, over25)
-							VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`)
+							VALUES (?, ?, ?, ?, ?, ?, ?, '', ?, ?, ?);`)
 	if err != nil {
 		return 0, err
 	}
 	defer createCar.Close()
 
-	res, err := createCar.Exec(fuelType, gearType, carType, size, colour, price, description, fileName, seats, disabled, over25)
+	res, err := createCar.Exec(fuelType, gearType, carType, size, colour, price, description, seats, disabled, over25)
 	if err != nil {
 		return 0, err
 	}
@@ -71,13 +76,14 @@ func CreateCar(fuelType, gearType, carType, size, colour, seats, price int, disa
 	return int(carID), nil
 }
 
-func UpdateCar(fuelType, gearType, carType, size, colour, seats, price int, disabled, over25 bool, fileName, description string, id int) (bool, error) {
+//UpdateCar leaves the image alone, it follows the car's primary photo
+func UpdateCar(fuelType, gearType, carType, size, colour, seats, price int, disabled, over25 bool, description string, id int) (bool, error) {
 
 	//Prepared statements
 	result, err := conn.Exec(`UPDATE cars SET fuelType = ?, gearType = ?, carType = ?,
  									size = ?, colour = ?, cost = ?, description = ?,
-									image = ?, seats = ?, disabled = ?, over25 = ? WHERE (id = ?);`,
-		fuelType, gearType, carType, size, colour, price, description, fileName, seats, disabled, over25, id)
+									seats = ?, disabled = ?, over25 = ? WHERE (id = ?);`,
+		fuelType, gearType, carType, size, colour, price, description, seats, disabled, over25, id)
 	if err != nil {
 		return false, err
 	}
@@ -159,7 +165,7 @@ func GetUsers(userSearch string) ([]*data.OutputUser, error) {
 		dob       time.Time
 	)
 
-	rows, err := conn.Query(`SELECT u.id, u.firstname, u.names, u.email, u.createdAt, u.blackListed, u.DOB, u.repeat, u.admin, u.disabled, 
+	rows, err := conn.Query(`SELECT u.id, u.firstname, u.names, u.email, u.createdAt, u.blackListed, u.DOB, u.repeat, u.role, u.disabled, 
 										(select count(*) from bookings as b where b.userID = u.id) as bookingCount
 										FROM USERS as u 
 										WHERE u.firstname like ? OR u.names like ? OR u.email like ? LIMIT 32`,
@@ -175,13 +181,15 @@ func GetUsers(userSearch string) ([]*data.OutputUser, error) {
 		newUser := &data.OutputUser{}
 		users[count] = newUser
 
-		err := rows.Scan(&newUser.ID, &newUser.FirstName, &newUser.Names, &newUser.Email, &createdAt, &newUser.Blacklisted, &dob, &newUser.Repeat, &newUser.Admin, &newUser.Disabled, &newUser.BookingCount)
+		err := rows.Scan(&newUser.ID, &newUser.FirstName, &newUser.Names, &newUser.Email, &createdAt, &newUser.Blacklisted, &dob, &newUser.Repeat, &newUser.Role, &newUser.Disabled, &newUser.BookingCount)
 		if err != nil {
 			return nil, err
 		}
 
 		newUser.CreatedAt = *data.ConvertDate(createdAt)
 		newUser.DOB = *data.ConvertDate(dob)
+		newUser.Admin = roles.IsStaff(newUser.Role)
+		newUser.Permissions = roles.Permissions(newUser.Role)
 
 		count++
 	}
@@ -222,8 +230,15 @@ func SetDisableUser(userID int, value bool) error {
 
 	return nil
 }
-func SetAdminUser(userID int, value bool) error {
-	result, err := conn.Exec("UPDATE users SET `admin` = ? WHERE (id = ?);", value, userID)
+func SetUserPhone(userID int, phone string) error {
+
+	_, err := conn.Exec(`UPDATE users SET phone = ? WHERE (id = ?)`, phone, userID)
+
+	return err
+}
+
+func SetUserRole(userID int, role roles.Role) error {
+	result, err := conn.Exec("UPDATE users SET `role` = ? WHERE (id = ?);", role, userID)
 	if err != nil {
 		return err
 	}
@@ -258,7 +273,7 @@ func SetBlackListUser(userID int, value bool) error {
 func readUserRow(row *sql.Row) (*data.User, error) {
 	newUser := data.User{}
 
-	err := row.Scan(&newUser.ID, &newUser.FirstName, &newUser.Names, &newUser.Email, &newUser.CreatedAt, &newUser.AuthHash, &newUser.AuthSalt, &newUser.Blacklisted, &newUser.DOB, &newUser.Verified, &newUser.Repeat, &newUser.Admin, &newUser.Disabled, &newUser.BookingCount)
+	err := row.Scan(&newUser.ID, &newUser.FirstName, &newUser.Names, &newUser.Email, &newUser.CreatedAt, &newUser.AuthHash, &newUser.AuthSalt, &newUser.Blacklisted, &newUser.DOB, &newUser.Verified, &newUser.Repeat, &newUser.Disabled, &newUser.Role, &newUser.Phone, &newUser.BookingCount)
 	if err != nil {
 		return &newUser, err
 	}
@@ -393,6 +408,30 @@ func GetCar(id string) (*data.Car, error) {
 	return car, nil
 }
 
+//GetCarImageFiles returns the file name of every car photo, disabled cars included
+func GetCarImageFiles() ([]string, error) {
+
+	rows, err := conn.Query(`SELECT fileName FROM car_images UNION SELECT image FROM cars WHERE image <> ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := make([]string, 0)
+	for rows.Next() {
+		image := ""
+
+		err := rows.Scan(&image)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
 func AdminGetCars(fuelTypes, gearTypes, carTypes, carSizes, colourTypes, search string) ([]*data.Car, error) {
 
 	search = space.ReplaceAllString(search, " ")
@@ -1046,6 +1085,14 @@ func BlackListedDriver(id int) error {
 	return nil
 }
 
+//RemoveDriverBlacklist clears the blacklist flag and the reason it was set
+func RemoveDriverBlacklist(id int) error {
+	_, err := conn.Exec("update drivers set blackListed = ?, reason = '' where id = ?",
+		false, id)
+
+	return err
+}
+
 func UpdateDriver(id int, licenseNumber, address, postcode string, blackListed bool, dob time.Time) error {
 
 	result, err := conn.Exec(`update drivers set licenseNumber = ?, address = ?, postcode = ?, blackListed = ?, dob = ? WHERE id  = ?`,
@@ -1116,6 +1163,10 @@ func InsertBookingStatus(bookingID, processID, adminID, active int, extra float6
 		return 0, errors.New("no status inserted")
 	}
 
+	if BookingStatusListener != nil {
+		BookingStatusListener(int(statusID), bookingID, processID, extra, description)
+	}
+
 	return int(statusID), nil
 }
 
@@ -1394,7 +1445,7 @@ func GetBookingStatuses() ([]*data.BookingStatusType, error) {
 func GetUserStats() (*data.UserStat, error) {
 
 	row := conn.QueryRow(`SELECT 
-sum(case users.admin when 1 then 1 else 0 end) as adminCount,
+sum(case users.role when 'customer' then 0 else 1 end) as adminCount,
 sum(case users.blackListed when 1 then 1 else 0 end) as blackListedCount,
 sum(case users.repeat when 1 then 1 else 0 end) as repeatCount,
 count(*) as userCount,
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"errors"
+	"time"
+)
+
+// Database Identity Logic
+//
+// useridentities links a user to the subject an OIDC issuer knows them by
+
+//GetUserIDByIdentity returns sql.ErrNoRows if the subject has not been linked to a user
+func GetUserIDByIdentity(issuer, subject string) (int, error) {
+
+	row := conn.QueryRow(`SELECT userID FROM useridentities WHERE issuer = ? AND subject = ?`, issuer, subject)
+	userID := 0
+
+	err := row.Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+func InsertUserIdentity(userID int, issuer, subject string) (int, error) {
+
+	//Prepared statements
+	insertIdentity, err := conn.Prepare(`INSERT INTO useridentities(userID, issuer, subject, created) VALUES(?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertIdentity.Close()
+
+	res, err := insertIdentity.Exec(userID, issuer, subject, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	identityID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if identityID == 0 {
+		return 0, errors.New("no identity inserted")
+	}
+
+	return int(identityID), nil
+}
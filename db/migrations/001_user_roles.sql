@@ -0,0 +1,8 @@
+-- Replaces the users.admin flag with a named role.
+-- Existing admins become superadmins so they keep every permission they had.
+
+ALTER TABLE carrental.users ADD COLUMN `role` VARCHAR(32) NOT NULL DEFAULT 'customer';
+
+UPDATE carrental.users SET `role` = 'superadmin' WHERE `admin` = 1;
+
+ALTER TABLE carrental.users DROP COLUMN `admin`;
@@ -0,0 +1,24 @@
+-- Append-only audit log of admin and customer actions.
+-- The triggers reject any attempt to change or remove an entry once written.
+
+CREATE TABLE carrental.auditlog (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `actorID` INT NOT NULL,
+  `action` VARCHAR(64) NOT NULL,
+  `entityType` VARCHAR(32) NOT NULL,
+  `entityID` INT NOT NULL,
+  `before` TEXT NOT NULL,
+  `after` TEXT NOT NULL,
+  `ip` VARCHAR(45) NOT NULL,
+  `created` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `auditlog_actor` (`actorID`),
+  INDEX `auditlog_entity` (`entityType`, `entityID`),
+  INDEX `auditlog_created` (`created`)
+);
+
+CREATE TRIGGER carrental.auditlog_no_update BEFORE UPDATE ON carrental.auditlog
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'auditlog is append-only';
+
+CREATE TRIGGER carrental.auditlog_no_delete BEFORE DELETE ON carrental.auditlog
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'auditlog is append-only';
@@ -0,0 +1,14 @@
+-- Customer requests to have their personal data erased, processed by an admin.
+
+CREATE TABLE carrental.erasurerequests (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `userID` INT NOT NULL,
+  `requested` DATETIME NOT NULL,
+  `status` VARCHAR(16) NOT NULL DEFAULT 'pending',
+  `adminID` INT NOT NULL DEFAULT 0,
+  `processed` DATETIME NULL,
+  `reason` VARCHAR(255) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  INDEX `erasurerequests_user` (`userID`),
+  INDEX `erasurerequests_status` (`status`)
+);
@@ -0,0 +1,5 @@
+-- Records the admin behind an action taken during an impersonation session (0 when none).
+
+ALTER TABLE carrental.auditlog
+  ADD COLUMN `impersonatorID` INT NOT NULL DEFAULT 0 AFTER `actorID`,
+  ADD INDEX `auditlog_impersonator` (`impersonatorID`);
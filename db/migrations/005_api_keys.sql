@@ -0,0 +1,16 @@
+-- Admin issued API keys for scripts. Only a hash of the secret is stored, keys are looked up by prefix.
+
+CREATE TABLE carrental.apikeys (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `name` VARCHAR(64) NOT NULL,
+  `prefix` VARCHAR(16) NOT NULL,
+  `keyHash` VARCHAR(64) NOT NULL,
+  `scopes` TEXT NOT NULL,
+  `createdBy` INT NOT NULL,
+  `created` DATETIME NOT NULL,
+  `expires` DATETIME NOT NULL,
+  `lastUsed` DATETIME NULL,
+  `revoked` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `apikeys_prefix` (`prefix`)
+);
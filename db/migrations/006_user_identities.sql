@@ -0,0 +1,12 @@
+-- Links users to accounts at an external OpenID Connect identity provider.
+
+CREATE TABLE carrental.useridentities (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `userID` INT NOT NULL,
+  `issuer` VARCHAR(255) NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `created` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `useridentities_subject` (`issuer`, `subject`),
+  INDEX `useridentities_user` (`userID`)
+);
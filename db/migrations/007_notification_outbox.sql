@@ -0,0 +1,23 @@
+-- Rendered notifications waiting to be delivered by the outbox worker.
+-- idempotencyKey stops the same notification being queued twice.
+
+CREATE TABLE carrental.notificationoutbox (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `idempotencyKey` VARCHAR(128) NOT NULL,
+  `template` VARCHAR(64) NOT NULL,
+  `reference` VARCHAR(64) NOT NULL DEFAULT '',
+  `sender` VARCHAR(255) NOT NULL,
+  `recipients` TEXT NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `textBody` TEXT NOT NULL,
+  `htmlBody` TEXT NOT NULL,
+  `status` VARCHAR(16) NOT NULL DEFAULT 'pending',
+  `attempts` INT NOT NULL DEFAULT 0,
+  `lastError` VARCHAR(1024) NOT NULL DEFAULT '',
+  `nextAttempt` DATETIME NOT NULL,
+  `created` DATETIME NOT NULL,
+  `sent` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `notificationoutbox_key` (`idempotencyKey`),
+  INDEX `notificationoutbox_due` (`status`, `nextAttempt`)
+);
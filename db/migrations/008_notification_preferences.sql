@@ -0,0 +1,12 @@
+-- How each customer wants to hear about their bookings. Users without a row get the defaults.
+-- unsubscribeToken identifies the user in unsubscribe links so they work without signing in.
+
+CREATE TABLE carrental.notificationpreferences (
+  `userID` INT NOT NULL,
+  `email` TINYINT NOT NULL DEFAULT 1,
+  `sms` TINYINT NOT NULL DEFAULT 0,
+  `nonEssential` TINYINT NOT NULL DEFAULT 1,
+  `unsubscribeToken` VARCHAR(64) NOT NULL,
+  PRIMARY KEY (`userID`),
+  UNIQUE INDEX `notificationpreferences_token` (`unsubscribeToken`)
+);
@@ -0,0 +1,5 @@
+-- Mobile numbers for SMS notifications, stored in E.164 form, and the channel each outbox message is sent on.
+
+ALTER TABLE carrental.users ADD COLUMN `phone` VARCHAR(16) NOT NULL DEFAULT '';
+
+ALTER TABLE carrental.notificationoutbox ADD COLUMN `channel` VARCHAR(8) NOT NULL DEFAULT 'email' AFTER `idempotencyKey`;
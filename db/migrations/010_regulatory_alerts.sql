@@ -0,0 +1,21 @@
+-- Alerts sent to regulators such as the DVLA and ABI. report is the JSON copy of what was sent,
+-- outboxID links to the queued email. Attachments hold the machine readable copies sent with an email.
+
+CREATE TABLE carrental.regulatoryalerts (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `idempotencyKey` VARCHAR(128) NOT NULL,
+  `authority` VARCHAR(16) NOT NULL,
+  `offence` VARCHAR(64) NOT NULL,
+  `driverID` INT NOT NULL,
+  `bookingID` INT NOT NULL DEFAULT 0,
+  `raisedBy` INT NOT NULL DEFAULT 0,
+  `outboxID` INT NOT NULL DEFAULT 0,
+  `report` TEXT NOT NULL,
+  `created` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `regulatoryalerts_key` (`idempotencyKey`),
+  INDEX `regulatoryalerts_authority` (`authority`, `created`),
+  INDEX `regulatoryalerts_driver` (`driverID`)
+);
+
+ALTER TABLE carrental.notificationoutbox ADD COLUMN `attachments` MEDIUMTEXT NULL AFTER `htmlBody`;
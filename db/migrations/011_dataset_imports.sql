@@ -0,0 +1,19 @@
+-- Every DVLA and ABI dataset uploaded by an admin. status is validated, refused, active or superseded,
+-- report is the JSON ImportReport from validation. The uploaded file is kept to allow rolling back.
+
+CREATE TABLE carrental.datasetimports (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `dataset` VARCHAR(16) NOT NULL,
+  `fileName` VARCHAR(255) NOT NULL,
+  `storedFile` VARCHAR(255) NOT NULL,
+  `hash` VARCHAR(64) NOT NULL,
+  `size` BIGINT NOT NULL,
+  `status` VARCHAR(16) NOT NULL,
+  `report` MEDIUMTEXT NOT NULL,
+  `uploadedBy` INT NOT NULL,
+  `uploaded` DATETIME NOT NULL,
+  `activatedBy` INT NOT NULL DEFAULT 0,
+  `activated` DATETIME NULL,
+  PRIMARY KEY (`id`),
+  INDEX `datasetimports_dataset` (`dataset`, `uploaded`)
+);
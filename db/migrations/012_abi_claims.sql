@@ -0,0 +1,25 @@
+-- ABI fraudulent claims imported from CSV, replacing queries against the Access database.
+-- Claims are kept per dataset, identified by the hash of the imported file, only the active dataset is checked.
+
+CREATE TABLE carrental.abidatasets (
+  `hash` VARCHAR(64) NOT NULL,
+  `fileName` VARCHAR(255) NOT NULL,
+  `rowCount` INT NOT NULL,
+  `loaded` DATETIME NOT NULL,
+  `active` TINYINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (`hash`)
+);
+
+CREATE TABLE carrental.abifraudclaims (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `dataset` VARCHAR(64) NOT NULL,
+  `familyName` VARCHAR(128) NOT NULL,
+  `forenames` VARCHAR(128) NOT NULL,
+  `dob` DATE NOT NULL,
+  `address` VARCHAR(255) NOT NULL,
+  `postcode` VARCHAR(16) NOT NULL,
+  `claimDate` DATE NULL,
+  `insurerCode` VARCHAR(32) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  INDEX `abifraudclaims_match` (`dataset`, `familyName`, `dob`)
+);
@@ -0,0 +1,30 @@
+-- Borderline ABI matches are held in driverreviews for an admin to decide, the booking waits under the
+-- Awaiting Driver Review process, which isn't shown as a booking page.
+
+CREATE TABLE carrental.driverreviews (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `kind` VARCHAR(32) NOT NULL,
+  `subject` VARCHAR(64) NOT NULL,
+  `bookingID` INT NOT NULL,
+  `driverID` INT NOT NULL DEFAULT 0,
+  `lastName` VARCHAR(128) NOT NULL,
+  `names` VARCHAR(128) NOT NULL,
+  `dob` DATE NOT NULL,
+  `address` VARCHAR(255) NOT NULL,
+  `postcode` VARCHAR(16) NOT NULL,
+  `license` VARCHAR(32) NOT NULL DEFAULT '',
+  `score` DOUBLE NOT NULL DEFAULT 0,
+  `evidence` MEDIUMTEXT NOT NULL,
+  `status` VARCHAR(16) NOT NULL DEFAULT 'pending',
+  `raisedBy` INT NOT NULL DEFAULT 0,
+  `created` DATETIME NOT NULL,
+  `reviewedBy` INT NOT NULL DEFAULT 0,
+  `reviewed` DATETIME NULL,
+  `reason` TEXT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `driverreviews_status` (`status`, `created`),
+  INDEX `driverreviews_booking` (`bookingID`, `kind`, `subject`)
+);
+
+INSERT INTO carrental.processtype(id, description, adminRequired, `order`, bookingPage)
+  SELECT 20, 'Awaiting Driver Review', 1, `order`, 0 FROM carrental.processtype WHERE id = 19;
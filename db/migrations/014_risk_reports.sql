@@ -0,0 +1,19 @@
+-- Driver risk assessments, one row each time a driver is checked for a booking. subject, checks and
+-- thresholds are JSON, the latest row for a booking is shown with it.
+
+CREATE TABLE carrental.driverriskreports (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `bookingID` INT NOT NULL,
+  `driverID` INT NOT NULL DEFAULT 0,
+  `decision` VARCHAR(16) NOT NULL,
+  `error` VARCHAR(64) NOT NULL DEFAULT '',
+  `reviewID` INT NOT NULL DEFAULT 0,
+  `subject` TEXT NOT NULL,
+  `checks` MEDIUMTEXT NOT NULL,
+  `thresholds` TEXT NOT NULL,
+  `assessedBy` INT NOT NULL DEFAULT 0,
+  `assessed` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `driverriskreports_booking` (`bookingID`, `id`),
+  INDEX `driverriskreports_driver` (`driverID`)
+);
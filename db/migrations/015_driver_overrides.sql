@@ -0,0 +1,6 @@
+-- Failed driver checks are sent to driverreviews for a senior admin to uphold or override, and blacklist
+-- removals are recorded there too. overridden marks risk reports passed because of an override.
+
+ALTER TABLE carrental.driverriskreports ADD COLUMN `overridden` TINYINT NOT NULL DEFAULT 0 AFTER `reviewID`;
+
+ALTER TABLE carrental.driverreviews ADD INDEX `driverreviews_driver` (`driverID`, `created`);
@@ -0,0 +1,32 @@
+-- Document retention. Legal holds stop the purge job removing files for a user, booking or driver until
+-- released. Each purge run, dry runs included, keeps its report with the files it removed as JSON.
+
+CREATE TABLE carrental.legalholds (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `entityType` VARCHAR(16) NOT NULL,
+  `entityID` INT NOT NULL,
+  `reason` VARCHAR(1024) NOT NULL,
+  `placedBy` INT NOT NULL DEFAULT 0,
+  `placed` DATETIME NOT NULL,
+  `releasedBy` INT NOT NULL DEFAULT 0,
+  `released` DATETIME NULL,
+  `releaseReason` VARCHAR(1024) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `legalholds_entity` (`entityType`, `entityID`),
+  INDEX `legalholds_released` (`released`)
+);
+
+CREATE TABLE carrental.purgereports (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `dryRun` TINYINT NOT NULL DEFAULT 0,
+  `ranBy` INT NOT NULL DEFAULT 0,
+  `started` DATETIME NOT NULL,
+  `finished` DATETIME NOT NULL,
+  `removed` INT NOT NULL DEFAULT 0,
+  `bytes` BIGINT NOT NULL DEFAULT 0,
+  `held` INT NOT NULL DEFAULT 0,
+  `files` MEDIUMTEXT NOT NULL,
+  `errors` TEXT NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `purgereports_started` (`started`)
+);
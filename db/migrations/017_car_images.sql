@@ -0,0 +1,20 @@
+-- Several photos per car, shown in position order. Files are named from the car and a random ID rather than
+-- the description, cars.image keeps the file name of the primary photo so car listings don't need a join.
+-- Existing car images become each car's primary photo.
+
+CREATE TABLE carrental.car_images (
+  `id` INT NOT NULL AUTO_INCREMENT,
+  `carID` INT NOT NULL,
+  `fileName` VARCHAR(255) NOT NULL,
+  `caption` VARCHAR(255) NOT NULL DEFAULT '',
+  `position` INT NOT NULL DEFAULT 0,
+  `isPrimary` TINYINT NOT NULL DEFAULT 0,
+  `createdBy` INT NOT NULL DEFAULT 0,
+  `created` DATETIME NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `car_images_car` (`carID`, `position`),
+  INDEX `car_images_file` (`fileName`)
+);
+
+INSERT INTO carrental.car_images(carID, fileName, caption, position, isPrimary, createdBy, created)
+SELECT id, image, '', 0, 1, 0, NOW() FROM carrental.cars WHERE image <> '';
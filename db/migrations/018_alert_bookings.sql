@@ -0,0 +1,4 @@
+-- Regulatory alerts are raised once per driver and booking rather than once per driver, existing alerts
+-- take the booking they were raised for into their idempotency key.
+
+UPDATE carrental.regulatoryalerts SET idempotencyKey = CONCAT(idempotencyKey, ':', bookingID);
@@ -0,0 +1,46 @@
+-- Erasing a user redacts their personal details from the audit log without changing it. Each entry about the
+-- user gets a row in auditredactions, which is append-only like the log, and entries are read through
+-- auditlog_redacted, which blanks the values and address of redacted entries.
+
+CREATE TABLE carrental.auditredactions (
+  `auditID` INT NOT NULL,
+  `erasureRequestID` INT NOT NULL,
+  `created` DATETIME NOT NULL,
+  PRIMARY KEY (`auditID`),
+  INDEX `auditredactions_request` (`erasureRequestID`)
+);
+
+CREATE TRIGGER carrental.auditredactions_no_update BEFORE UPDATE ON carrental.auditredactions
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'auditredactions is append-only';
+
+CREATE TRIGGER carrental.auditredactions_no_delete BEFORE DELETE ON carrental.auditredactions
+FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'auditredactions is append-only';
+
+CREATE VIEW carrental.auditlog_redacted AS
+SELECT a.id, a.actorID, a.impersonatorID, a.action, a.entityType, a.entityID,
+  IF(r.auditID IS NULL, a.`before`, '') AS `before`,
+  IF(r.auditID IS NULL, a.`after`, '') AS `after`,
+  IF(r.auditID IS NULL, a.ip, '') AS ip,
+  r.auditID IS NOT NULL AS redacted,
+  a.created
+FROM carrental.auditlog AS a
+LEFT JOIN carrental.auditredactions AS r ON r.auditID = a.id;
+
+-- Users erased before now are redacted the same way, drivers only they used were left without a name.
+INSERT IGNORE INTO carrental.auditredactions(auditID, erasureRequestID, created)
+SELECT a.id, e.id, NOW()
+FROM carrental.erasurerequests AS e
+INNER JOIN carrental.auditlog AS a ON a.actorID = e.userID
+  OR (a.entityType = 'user' AND a.entityID = e.userID)
+  OR (a.entityType = 'booking' AND a.entityID IN (SELECT id FROM carrental.bookings WHERE userID = e.userID))
+  OR (a.entityType = 'driverReview' AND a.entityID IN (SELECT r.id FROM carrental.driverreviews AS r
+    INNER JOIN carrental.bookings AS b ON r.bookingID = b.id WHERE b.userID = e.userID))
+  OR (a.entityType = 'driver' AND a.entityID IN (SELECT b.driverID FROM carrental.bookings AS b
+    INNER JOIN carrental.drivers AS d ON b.driverID = d.id WHERE b.userID = e.userID AND d.lastName = '' AND d.names = ''))
+WHERE e.status = 'completed';
+
+INSERT INTO carrental.auditlog(actorID, impersonatorID, action, entityType, entityID, `before`, `after`, ip, created)
+SELECT 0, 0, 'audit.redact', 'user', e.userID, '', JSON_OBJECT('ErasureRequestID', e.id, 'Entries', COUNT(*)), '', NOW()
+FROM carrental.erasurerequests AS e
+INNER JOIN carrental.auditredactions AS r ON r.erasureRequestID = e.id
+GROUP BY e.id, e.userID;
@@ -0,0 +1,10 @@
+-- Fuzzy ABI matching looks claims up by date of birth or by postcodeKey, then scores them in the site.
+-- postcodeKey is the postcode upper case with everything but letters and digits removed, as db.postcodeKey
+-- makes it for imported claims and lookups.
+
+ALTER TABLE carrental.abifraudclaims
+  ADD COLUMN `postcodeKey` VARCHAR(16) NOT NULL DEFAULT '' AFTER `postcode`,
+  ADD INDEX `abifraudclaims_dob` (`dataset`, `dob`),
+  ADD INDEX `abifraudclaims_postcode` (`dataset`, `postcodeKey`);
+
+UPDATE carrental.abifraudclaims SET postcodeKey = UPPER(REGEXP_REPLACE(postcode, '[^[:alnum:]]', ''));
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"time"
+)
+
+// Database Notification Preference Logic
+//
+//
+
+func GetNotificationPreferences(userID int) (*data.NotificationPreferences, error) {
+
+	row := conn.QueryRow(`SELECT userID, email, sms, nonEssential, unsubscribeToken FROM notificationpreferences WHERE userID = ?`, userID)
+
+	preferences := &data.NotificationPreferences{}
+
+	err := row.Scan(&preferences.UserID, &preferences.Email, &preferences.SMS, &preferences.NonEssential, &preferences.UnsubscribeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return preferences, nil
+}
+
+//SetNotificationPreferences creates or replaces the users preferences, the unsubscribe token is kept once set
+func SetNotificationPreferences(preferences *data.NotificationPreferences) error {
+
+	_, err := conn.Exec(`INSERT INTO notificationpreferences(userID, email, sms, nonEssential, unsubscribeToken) VALUES(?, ?, ?, ?, ?)
+							ON DUPLICATE KEY UPDATE email = VALUES(email), sms = VALUES(sms), nonEssential = VALUES(nonEssential)`,
+		preferences.UserID, preferences.Email, preferences.SMS, preferences.NonEssential, preferences.UnsubscribeToken)
+
+	return err
+}
+
+//UnsubscribeNonEssential turns off non-essential messages for the user with the token, returning their ID
+func UnsubscribeNonEssential(token string) (int, error) {
+
+	userID := 0
+
+	row := conn.QueryRow(`SELECT userID FROM notificationpreferences WHERE unsubscribeToken = ?`, token)
+	err := row.Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = conn.Exec(`UPDATE notificationpreferences SET nonEssential = 0 WHERE (userID = ?)`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+//GetBookingSummary reads the fields of a booking used in notifications, without the status joins of GetSingleBooking
+func GetBookingSummary(bookingID int) (*data.Booking, error) {
+	var (
+		start   time.Time
+		end     time.Time
+		finish  time.Time
+		created time.Time
+	)
+
+	row := conn.QueryRow(`SELECT id, carID, userID, start, end, finish, totalCost, amountPaid, lateReturn, fullDay, created, bookingLength
+								FROM bookings WHERE id = ?`, bookingID)
+
+	booking := &data.Booking{}
+
+	err := row.Scan(&booking.ID, &booking.CarID, &booking.UserID, &start, &end, &finish, &booking.TotalCost, &booking.AmountPaid,
+		&booking.LateReturn, &booking.FullDay, &created, &booking.BookingLength)
+	if err != nil {
+		return nil, err
+	}
+
+	booking.Start = *data.ConvertDate(start)
+	booking.End = *data.ConvertDate(end)
+	booking.Finish = *data.ConvertDate(finish)
+	booking.Created = *data.ConvertDate(created)
+
+	return booking, nil
+}
+
+//GetActiveProcessBookings returns summaries of the bookings currently at the process, such as every collected booking
+func GetActiveProcessBookings(processID int) ([]*data.Booking, error) {
+	var (
+		start   time.Time
+		end     time.Time
+		finish  time.Time
+		created time.Time
+	)
+
+	rows, err := conn.Query(`SELECT b.id, b.carID, b.userID, b.start, b.end, b.finish, b.totalCost, b.amountPaid, b.lateReturn, b.fullDay, b.created, b.bookingLength
+								FROM bookings as b
+								INNER JOIN bookingstatus as s ON s.bookingID = b.id
+								WHERE s.processID = ? AND s.active = 1`, processID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := make([]*data.Booking, 0)
+	for rows.Next() {
+
+		booking := &data.Booking{ProcessID: processID}
+
+		err := rows.Scan(&booking.ID, &booking.CarID, &booking.UserID, &start, &end, &finish, &booking.TotalCost, &booking.AmountPaid,
+			&booking.LateReturn, &booking.FullDay, &created, &booking.BookingLength)
+		if err != nil {
+			return nil, err
+		}
+
+		booking.Start = *data.ConvertDate(start)
+		booking.End = *data.ConvertDate(end)
+		booking.Finish = *data.ConvertDate(finish)
+		booking.Created = *data.ConvertDate(created)
+
+		bookings = append(bookings, booking)
+	}
+
+	return bookings, nil
+}
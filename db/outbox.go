@@ -0,0 +1,221 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Database Outbox Logic
+//
+// notificationoutbox rows move from pending to sending to sent, or back to pending to be retried,
+// or to failed once the worker gives up. recipients are stored comma separated and
+// attachments as JSON
+
+const outboxColumns = `id, idempotencyKey, channel, template, reference, sender, recipients, subject, textBody, htmlBody,
+	COALESCE(attachments, ''), status, attempts, lastError, nextAttempt, created, sent`
+
+//InsertOutboxMessage queues a message, returning the ID of the existing message and false if the
+//idempotency key has already been used
+func InsertOutboxMessage(message *data.OutboxMessage) (int, bool, error) {
+
+	//Prepared statements
+	insertMessage, err := conn.Prepare(`INSERT INTO notificationoutbox(idempotencyKey, channel, template, reference, sender, recipients,
+											subject, textBody, htmlBody, attachments, status, nextAttempt, created)
+											VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?, ?)
+											ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`)
+	if err != nil {
+		return 0, false, err
+	}
+	defer insertMessage.Close()
+
+	now := time.Now()
+
+	res, err := insertMessage.Exec(message.IdempotencyKey, message.Channel, message.Template, message.Reference, message.From,
+		strings.Join(message.To, ","), message.Subject, message.Text, message.HTML, message.Attachments, now, now)
+	if err != nil {
+		return 0, false, err
+	}
+
+	messageID, err := res.LastInsertId()
+	if err != nil {
+		return 0, false, err
+	}
+
+	if messageID == 0 {
+		return 0, false, errors.New("no outbox message inserted")
+	}
+
+	//Rows affected is 1 for an insert and 0 when the duplicate key update changed nothing
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, false, err
+	}
+
+	return int(messageID), count == 1, nil
+}
+
+func GetDueOutboxMessages(limit int) ([]*data.OutboxMessage, error) {
+
+	rows, err := conn.Query(`SELECT `+outboxColumns+` FROM notificationoutbox
+								WHERE status = 'pending' AND nextAttempt <= ?
+								ORDER BY nextAttempt ASC LIMIT ?`, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readOutboxRows(rows)
+}
+
+func GetOutboxMessages(status string, limit int) ([]*data.OutboxMessage, error) {
+
+	rows, err := conn.Query(`SELECT `+outboxColumns+` FROM notificationoutbox
+								WHERE (? = '' OR status = ?)
+								ORDER BY created DESC LIMIT ?`, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readOutboxRows(rows)
+}
+
+func GetOutboxCounts() (map[string]int, error) {
+
+	rows, err := conn.Query(`SELECT status, count(*) FROM notificationoutbox GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		status := ""
+		count := 0
+
+		err := rows.Scan(&status, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		counts[status] = count
+	}
+
+	return counts, nil
+}
+
+func readOutboxRows(rows *sql.Rows) ([]*data.OutboxMessage, error) {
+	var (
+		recipients  string
+		nextAttempt time.Time
+		created     time.Time
+		sent        sql.NullTime
+	)
+
+	messages := make([]*data.OutboxMessage, 0)
+	for rows.Next() {
+
+		message := &data.OutboxMessage{}
+
+		err := rows.Scan(&message.ID, &message.IdempotencyKey, &message.Channel, &message.Template, &message.Reference, &message.From, &recipients,
+			&message.Subject, &message.Text, &message.HTML, &message.Attachments, &message.Status, &message.Attempts, &message.LastError,
+			&nextAttempt, &created, &sent)
+		if err != nil {
+			return nil, err
+		}
+
+		message.To = strings.Split(recipients, ",")
+		message.NextAttempt = *data.ConvertDate(nextAttempt)
+		message.Created = *data.ConvertDate(created)
+		message.Sent = *data.ConvertDate(sent.Time)
+
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+//ClaimOutboxMessage moves a pending message to sending, returning false if another worker got there first.
+//While it's sending nextAttempt holds when the claim lapses
+func ClaimOutboxMessage(id int, leaseUntil time.Time) (bool, error) {
+
+	result, err := conn.Exec(`UPDATE notificationoutbox SET status = 'sending', nextAttempt = ? WHERE (id = ?) AND status = 'pending'`,
+		leaseUntil, id)
+	if err != nil {
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return count == 1, nil
+}
+
+func SetOutboxMessageSent(id, attempts int) error {
+
+	_, err := conn.Exec(`UPDATE notificationoutbox SET status = 'sent', attempts = ?, lastError = '', sent = ? WHERE (id = ?)`,
+		attempts, time.Now(), id)
+
+	return err
+}
+
+//SetOutboxMessageFailed records a failed attempt, status is pending to retry at nextAttempt or failed to give up
+func SetOutboxMessageFailed(id, attempts int, status, lastError string, nextAttempt time.Time) error {
+
+	if len(lastError) > 1024 {
+		lastError = lastError[:1024]
+	}
+
+	_, err := conn.Exec(`UPDATE notificationoutbox SET status = ?, attempts = ?, lastError = ?, nextAttempt = ? WHERE (id = ?)`,
+		status, attempts, lastError, nextAttempt, id)
+
+	return err
+}
+
+//ResetSendingOutboxMessages returns messages left sending by a stopped worker to the queue
+func ResetSendingOutboxMessages() error {
+
+	_, err := conn.Exec(`UPDATE notificationoutbox SET status = 'pending' WHERE status = 'sending'`)
+
+	return err
+}
+
+//RequeueExpiredOutboxMessages puts messages back to pending whose claim lapsed without the send being recorded
+func RequeueExpiredOutboxMessages() (int, error) {
+
+	result, err := conn.Exec(`UPDATE notificationoutbox SET status = 'pending' WHERE status = 'sending' AND nextAttempt <= ?`,
+		time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+
+	return int(count), err
+}
+
+//RetryOutboxMessage queues a failed message to be sent straight away, with its attempts reset so it gets the
+//full retry schedule again
+func RetryOutboxMessage(id int) error {
+
+	result, err := conn.Exec(`UPDATE notificationoutbox SET status = 'pending', attempts = 0, lastError = '', nextAttempt = ?
+								WHERE (id = ?) AND status = 'failed'`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("no rows affected")
+	}
+
+	return nil
+}
@@ -0,0 +1,266 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Database Privacy Logic
+//
+//
+
+func GetUserBookingIDs(userID int) ([]int, error) {
+
+	rows, err := conn.Query(`SELECT id FROM bookings WHERE userID = ? ORDER BY created ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		id := 0
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func CreateErasureRequest(userID int) (int, error) {
+
+	//Prepared statements
+	createRequest, err := conn.Prepare(`INSERT INTO erasurerequests(userID, requested, status)
+												VALUES(?, ?, 'pending')`)
+	if err != nil {
+		return 0, err
+	}
+	defer createRequest.Close()
+
+	res, err := createRequest.Exec(userID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	requestID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if requestID == 0 {
+		return 0, errors.New("no erasure request inserted")
+	}
+
+	return int(requestID), nil
+}
+
+//GetPendingErasureRequest returns the users open erasure request, or nil if they have none
+func GetPendingErasureRequest(userID int) (*data.ErasureRequest, error) {
+
+	row := conn.QueryRow(`SELECT e.id, e.userID, users.email, e.requested, e.status, e.adminID, e.processed, e.reason
+								FROM erasurerequests as e
+								INNER JOIN users ON e.userID = users.id
+								WHERE e.userID = ? AND e.status = 'pending' LIMIT 1`, userID)
+
+	request, err := readErasureRequest(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return request, err
+}
+
+func GetErasureRequest(id int) (*data.ErasureRequest, error) {
+
+	row := conn.QueryRow(`SELECT e.id, e.userID, users.email, e.requested, e.status, e.adminID, e.processed, e.reason
+								FROM erasurerequests as e
+								INNER JOIN users ON e.userID = users.id
+								WHERE e.id = ?`, id)
+
+	return readErasureRequest(row)
+}
+
+func GetErasureRequests(status string) ([]*data.ErasureRequest, error) {
+	var (
+		requested time.Time
+		processed sql.NullTime
+	)
+
+	rows, err := conn.Query(`SELECT e.id, e.userID, users.email, e.requested, e.status, e.adminID, e.processed, e.reason
+								FROM erasurerequests as e
+								INNER JOIN users ON e.userID = users.id
+								WHERE e.status = ?
+								ORDER BY e.requested ASC LIMIT 64`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := make([]*data.ErasureRequest, 0)
+	for rows.Next() {
+
+		request := &data.ErasureRequest{}
+
+		err := rows.Scan(&request.ID, &request.UserID, &request.UserEmail, &requested, &request.Status, &request.AdminID, &processed, &request.Reason)
+		if err != nil {
+			return nil, err
+		}
+
+		request.Requested = *data.ConvertDate(requested)
+		request.Processed = *data.ConvertDate(processed.Time)
+
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
+
+func readErasureRequest(row *sql.Row) (*data.ErasureRequest, error) {
+	var (
+		requested time.Time
+		processed sql.NullTime
+	)
+
+	request := &data.ErasureRequest{}
+
+	err := row.Scan(&request.ID, &request.UserID, &request.UserEmail, &requested, &request.Status, &request.AdminID, &processed, &request.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Requested = *data.ConvertDate(requested)
+	request.Processed = *data.ConvertDate(processed.Time)
+
+	return request, nil
+}
+
+func UpdateErasureRequest(id int, status string, adminID int, reason string) error {
+
+	result, err := conn.Exec(`UPDATE erasurerequests SET status = ?, adminID = ?, processed = ?, reason = ? WHERE (id = ?)`,
+		status, adminID, time.Now(), reason, id)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("no rows affected")
+	}
+
+	return nil
+}
+
+//DriverUsedByOtherUsers reports whether the driver is attached to a booking belonging to anyone but userID
+func DriverUsedByOtherUsers(driverID, userID int) (bool, error) {
+
+	row := conn.QueryRow(`SELECT count(*) FROM bookings WHERE driverID = ? AND userID != ?`, driverID, userID)
+	relations := 0
+
+	err := row.Scan(&relations)
+	if err != nil {
+		return false, err
+	}
+
+	return relations > 0, nil
+}
+
+//EraseUser strips every personal field from the user, blanks the identity of drivers only they used, redacts the
+//audit entries about them and completes the erasure request, all or none of it. It returns how many audit entries
+//were redacted. The user row is kept disabled so the users bookings still have an owner for accounting. Empty
+//driver names can never be matched by GetDriverByName as verifyDriver requires both to be set
+func EraseUser(requestID, userID, adminID int, email, salt, hash, reason string, driverIDs []int) (int, error) {
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE users SET firstname = 'Erased', names = 'User', email = ?, authHash = ?, authSalt = ?, DOB = ?, phone = '', `verified` = 0, `disabled` = 1 WHERE (id = ?)",
+		email, hash, salt, time.Unix(0, 0), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, errors.New("no rows affected")
+	}
+
+	_, err = tx.Exec(`DELETE FROM useridentities WHERE userID = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, driverID := range driverIDs {
+		_, err = tx.Exec(`UPDATE drivers SET lastName = '', names = '', licenseNumber = '', address = '', postcode = '', dob = ? WHERE id = ?`,
+			time.Unix(0, 0), driverID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	redacted, err := redactAuditEntries(tx, requestID, userID, driverIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err = tx.Exec(`UPDATE erasurerequests SET status = 'completed', adminID = ?, processed = ?, reason = ?
+								WHERE (id = ?) AND status = 'pending'`, adminID, time.Now(), reason, requestID)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err = result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, errors.New("erasure request already processed")
+	}
+
+	return redacted, tx.Commit()
+}
+
+//redactAuditEntries masks the entries the user made and those about them, their bookings, the reviews of those
+//and the drivers only they used. Entity types are those of auditService, which can't be imported here
+func redactAuditEntries(tx *sql.Tx, requestID, userID int, driverIDs []int) (int, error) {
+
+	query := `INSERT IGNORE INTO auditredactions(auditID, erasureRequestID, created)
+				SELECT id, ?, ? FROM auditlog
+				WHERE actorID = ? OR (entityType = 'user' AND entityID = ?)
+					OR (entityType = 'booking' AND entityID IN (SELECT id FROM bookings WHERE userID = ?))
+					OR (entityType = 'driverReview' AND entityID IN (SELECT r.id FROM driverreviews AS r
+						INNER JOIN bookings AS b ON r.bookingID = b.id WHERE b.userID = ?))`
+	args := []interface{}{requestID, time.Now(), userID, userID, userID, userID}
+
+	if len(driverIDs) > 0 {
+		query += ` OR (entityType = 'driver' AND entityID IN (?` + strings.Repeat(", ?", len(driverIDs)-1) + `))`
+		for _, driverID := range driverIDs {
+			args = append(args, driverID)
+		}
+	}
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+
+	return int(count), err
+}
@@ -0,0 +1,265 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Database Retention Logic
+//
+// A hold is active until released is set
+
+const legalHoldColumns = `id, entityType, entityID, reason, placedBy, placed, releasedBy, released, COALESCE(releaseReason, '')`
+
+func InsertLegalHold(entityType string, entityID int, reason string, placedBy int) (int, error) {
+
+	//Prepared statements
+	insertHold, err := conn.Prepare(`INSERT INTO legalholds(entityType, entityID, reason, placedBy, placed)
+										VALUES(?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertHold.Close()
+
+	res, err := insertHold.Exec(entityType, entityID, reason, placedBy, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	holdID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if holdID == 0 {
+		return 0, errors.New("no legal hold inserted")
+	}
+
+	return int(holdID), nil
+}
+
+func GetLegalHold(id int) (*data.LegalHold, error) {
+
+	rows, err := conn.Query(`SELECT `+legalHoldColumns+` FROM legalholds WHERE (id = ?)`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds, err := readLegalHoldRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(holds) == 0 {
+		return nil, nil
+	}
+
+	return holds[0], nil
+}
+
+//GetLegalHolds returns holds newest first, only those still active unless all is set
+func GetLegalHolds(all bool, limit int) ([]*data.LegalHold, error) {
+
+	rows, err := conn.Query(`SELECT `+legalHoldColumns+` FROM legalholds
+								WHERE (? OR released IS NULL)
+								ORDER BY placed DESC, id DESC LIMIT ?`, all, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readLegalHoldRows(rows)
+}
+
+//GetActiveLegalHold returns the active hold on the entity, nil if there isn't one
+func GetActiveLegalHold(entityType string, entityID int) (*data.LegalHold, error) {
+
+	rows, err := conn.Query(`SELECT `+legalHoldColumns+` FROM legalholds
+								WHERE entityType = ? AND entityID = ? AND released IS NULL
+								ORDER BY id LIMIT 1`, entityType, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holds, err := readLegalHoldRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(holds) == 0 {
+		return nil, nil
+	}
+
+	return holds[0], nil
+}
+
+//ReleaseLegalHold releases an active hold, returning false if it had already been released
+func ReleaseLegalHold(id, releasedBy int, reason string) (bool, error) {
+
+	res, err := conn.Exec(`UPDATE legalholds SET releasedBy = ?, released = ?, releaseReason = ?
+								WHERE (id = ?) AND released IS NULL`, releasedBy, time.Now(), reason, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func readLegalHoldRows(rows *sql.Rows) ([]*data.LegalHold, error) {
+	var (
+		placed   time.Time
+		released sql.NullTime
+	)
+
+	holds := make([]*data.LegalHold, 0)
+	for rows.Next() {
+
+		hold := &data.LegalHold{}
+
+		err := rows.Scan(&hold.ID, &hold.EntityType, &hold.EntityID, &hold.Reason, &hold.PlacedBy, &placed,
+			&hold.ReleasedBy, &released, &hold.ReleaseReason)
+		if err != nil {
+			return nil, err
+		}
+
+		hold.Placed = *data.ConvertDate(placed)
+		if released.Valid {
+			hold.Released = *data.ConvertDate(released.Time)
+		}
+
+		holds = append(holds, hold)
+	}
+
+	return holds, nil
+}
+
+//GetFinishedBookings returns every booking whose active status is one of processIDs, keyed by booking ID
+func GetFinishedBookings(processIDs ...int) (map[int]*data.FinishedBooking, error) {
+
+	finished := make(map[int]*data.FinishedBooking)
+	for _, processID := range processIDs {
+
+		rows, err := conn.Query(`SELECT b.id, b.userID, COALESCE(b.driverID, 0), MAX(s.completed) FROM bookings b
+									INNER JOIN bookingstatus s ON s.bookingID = b.id
+									WHERE s.active = 1 AND s.processID = ?
+									GROUP BY b.id, b.userID, b.driverID`, processID)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+
+			booking := &data.FinishedBooking{}
+
+			err := rows.Scan(&booking.ID, &booking.UserID, &booking.DriverID, &booking.Finished)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			if earlier, ok := finished[booking.ID]; !ok || earlier.Finished.Before(booking.Finished) {
+				finished[booking.ID] = booking
+			}
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return finished, nil
+}
+
+func InsertPurgeReport(report *data.PurgeReport) (int, error) {
+
+	filesJSON, err := json.Marshal(report.Removed)
+	if err != nil {
+		return 0, err
+	}
+	errorsJSON, err := json.Marshal(report.Errors)
+	if err != nil {
+		return 0, err
+	}
+
+	//Prepared statements
+	insertReport, err := conn.Prepare(`INSERT INTO purgereports(dryRun, ranBy, started, finished, removed, bytes, held, files, errors)
+										VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertReport.Close()
+
+	res, err := insertReport.Exec(report.DryRun, report.RanBy, report.Started.Time, report.Finished.Time, len(report.Removed),
+		report.Bytes, report.Held, string(filesJSON), string(errorsJSON))
+	if err != nil {
+		return 0, err
+	}
+
+	reportID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if reportID == 0 {
+		return 0, errors.New("no purge report inserted")
+	}
+
+	return int(reportID), nil
+}
+
+//GetPurgeReports returns the latest purge runs, newest first
+func GetPurgeReports(limit int) ([]*data.PurgeReport, error) {
+	var (
+		started    time.Time
+		finished   time.Time
+		filesJSON  string
+		errorsJSON string
+	)
+
+	rows, err := conn.Query(`SELECT id, dryRun, ranBy, started, finished, bytes, held, files, errors FROM purgereports
+								ORDER BY started DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]*data.PurgeReport, 0)
+	for rows.Next() {
+
+		report := &data.PurgeReport{}
+
+		err := rows.Scan(&report.ID, &report.DryRun, &report.RanBy, &started, &finished, &report.Bytes, &report.Held,
+			&filesJSON, &errorsJSON)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(filesJSON), &report.Removed)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(errorsJSON), &report.Errors)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Started = *data.ConvertDate(started)
+		report.Finished = *data.ConvertDate(finished)
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
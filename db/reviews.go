@@ -0,0 +1,164 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Database Driver Review Logic
+//
+// subject identifies the driver details a review was raised for, so changed details are checked again
+
+const driverReviewColumns = `id, kind, subject, bookingID, driverID, lastName, names, dob, address, postcode, license,
+	score, evidence, status, raisedBy, created, reviewedBy, reviewed, COALESCE(reason, '')`
+
+func InsertDriverReview(review *data.DriverReview) (int, error) {
+
+	//Prepared statements
+	insertReview, err := conn.Prepare(`INSERT INTO driverreviews(kind, subject, bookingID, driverID, lastName, names, dob, address,
+											postcode, license, score, evidence, status, raisedBy, created)
+											VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertReview.Close()
+
+	res, err := insertReview.Exec(review.Kind, review.Subject, review.BookingID, review.DriverID, review.LastName, review.Names,
+		review.DOB.UTC().Format("2006-01-02"), review.Address, review.PostCode, review.License, review.Score, string(review.Evidence),
+		review.Status, review.RaisedBy, review.Created.Time)
+	if err != nil {
+		return 0, err
+	}
+
+	reviewID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if reviewID == 0 {
+		return 0, errors.New("no driver review inserted")
+	}
+
+	return int(reviewID), nil
+}
+
+func GetDriverReview(id int) (*data.DriverReview, error) {
+
+	rows, err := conn.Query(`SELECT `+driverReviewColumns+` FROM driverreviews WHERE (id = ?)`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews, err := readDriverReviewRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reviews) == 0 {
+		return nil, nil
+	}
+
+	return reviews[0], nil
+}
+
+//GetDriverReviews returns reviews oldest first so the queue is worked in order, optionally with one status
+//or for one driver when driverID isn't 0
+func GetDriverReviews(status string, driverID, limit int) ([]*data.DriverReview, error) {
+
+	rows, err := conn.Query(`SELECT `+driverReviewColumns+` FROM driverreviews
+								WHERE (? = '' OR status = ?) AND (? = 0 OR driverID = ?)
+								ORDER BY created, id LIMIT ?`, status, status, driverID, driverID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readDriverReviewRows(rows)
+}
+
+//GetBookingDriverReview returns the latest review of the kind raised for the booking and subject, nil if there isn't one
+func GetBookingDriverReview(bookingID int, kind, subject string) (*data.DriverReview, error) {
+
+	rows, err := conn.Query(`SELECT `+driverReviewColumns+` FROM driverreviews
+								WHERE bookingID = ? AND kind = ? AND subject = ?
+								ORDER BY id DESC LIMIT 1`, bookingID, kind, subject)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews, err := readDriverReviewRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reviews) == 0 {
+		return nil, nil
+	}
+
+	return reviews[0], nil
+}
+
+//SetDriverReviewDriver links a review to the driver created after it was opened
+func SetDriverReviewDriver(id, driverID int) error {
+
+	_, err := conn.Exec(`UPDATE driverreviews SET driverID = ? WHERE (id = ?)`, driverID, id)
+
+	return err
+}
+
+//ResolveDriverReview records the decision on a pending review, returning false if it had already been decided
+func ResolveDriverReview(id int, status string, driverID, reviewedBy int, reason string) (bool, error) {
+
+	res, err := conn.Exec(`UPDATE driverreviews SET status = ?, driverID = ?, reviewedBy = ?, reviewed = ?, reason = ?
+								WHERE (id = ?) AND status = 'pending'`, status, driverID, reviewedBy, time.Now(), reason, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func readDriverReviewRows(rows *sql.Rows) ([]*data.DriverReview, error) {
+	var (
+		dob      time.Time
+		evidence string
+		created  time.Time
+		reviewed sql.NullTime
+	)
+
+	reviews := make([]*data.DriverReview, 0)
+	for rows.Next() {
+
+		review := &data.DriverReview{}
+
+		err := rows.Scan(&review.ID, &review.Kind, &review.Subject, &review.BookingID, &review.DriverID, &review.LastName,
+			&review.Names, &dob, &review.Address, &review.PostCode, &review.License, &review.Score, &evidence, &review.Status,
+			&review.RaisedBy, &created, &review.ReviewedBy, &reviewed, &review.Reason)
+		if err != nil {
+			return nil, err
+		}
+
+		review.DOB = *data.ConvertDate(dob)
+		review.Evidence = []byte(evidence)
+		if evidence == "" {
+			review.Evidence = []byte("null")
+		}
+		review.Created = *data.ConvertDate(created)
+		if reviewed.Valid {
+			review.Reviewed = *data.ConvertDate(reviewed.Time)
+		}
+
+		reviews = append(reviews, review)
+	}
+
+	return reviews, rows.Err()
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"carHiringWebsite/data"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Database Driver Risk Report Logic
+//
+// subject, checks and thresholds are stored as JSON, evidence in the checks is read back as generic JSON
+
+const riskReportColumns = `id, bookingID, driverID, decision, error, reviewID, overridden, subject, checks, thresholds, assessedBy, assessed`
+
+func InsertRiskReport(report *data.RiskReport) (int, error) {
+
+	subject, err := json.Marshal(report.Subject)
+	if err != nil {
+		return 0, err
+	}
+	checks, err := json.Marshal(report.Checks)
+	if err != nil {
+		return 0, err
+	}
+	thresholds, err := json.Marshal(report.Thresholds)
+	if err != nil {
+		return 0, err
+	}
+
+	//Prepared statements
+	insertReport, err := conn.Prepare(`INSERT INTO driverriskreports(bookingID, driverID, decision, error, reviewID, overridden, subject,
+											checks, thresholds, assessedBy, assessed)
+											VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer insertReport.Close()
+
+	res, err := insertReport.Exec(report.BookingID, report.DriverID, report.Decision, report.Error, report.ReviewID, report.Overridden, string(subject),
+		string(checks), string(thresholds), report.AssessedBy, report.Assessed.Time)
+	if err != nil {
+		return 0, err
+	}
+
+	reportID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if reportID == 0 {
+		return 0, errors.New("no risk report inserted")
+	}
+
+	return int(reportID), nil
+}
+
+func SetRiskReportDriver(id, driverID int) error {
+
+	_, err := conn.Exec(`UPDATE driverriskreports SET driverID = ? WHERE (id = ?)`, driverID, id)
+
+	return err
+}
+
+//GetBookingRiskReport returns the latest report for the booking, nil if there isn't one
+func GetBookingRiskReport(bookingID int) (*data.RiskReport, error) {
+	var (
+		subject    string
+		checks     string
+		thresholds string
+		assessed   time.Time
+	)
+
+	rows, err := conn.Query(`SELECT `+riskReportColumns+` FROM driverriskreports
+								WHERE (bookingID = ?) ORDER BY id DESC LIMIT 1`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	report := &data.RiskReport{Subject: &data.RiskSubject{}}
+
+	err = rows.Scan(&report.ID, &report.BookingID, &report.DriverID, &report.Decision, &report.Error, &report.ReviewID,
+		&report.Overridden, &subject, &checks, &thresholds, &report.AssessedBy, &assessed)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(subject), report.Subject)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(checks), &report.Checks)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(thresholds), &report.Thresholds)
+	if err != nil {
+		return nil, err
+	}
+	report.Assessed = *data.ConvertDate(assessed)
+
+	return report, nil
+}
@@ -0,0 +1,220 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// Limits and output settings, set from command line flags in main
+var (
+	// MaxUploadSize is the largest image accepted in bytes, before any base64 encoding
+	MaxUploadSize *int64
+	// MaxDimension is the largest width or height accepted in pixels, checked before the image is decoded
+	MaxDimension *int
+	// MaxPixels is the largest width times height accepted, a decoded image takes 4 bytes a pixel
+	MaxPixels *int64
+	// Quality is the JPEG quality, 1 to 100, images are stored at
+	Quality *int
+)
+
+var (
+	ImageTooLarge     = errors.New("image too large")
+	DimensionsTooBig  = errors.New("image dimensions too large")
+	UnsupportedFormat = errors.New("unsupported image format, images must be JPEG, PNG or WebP")
+	InvalidImage      = errors.New("invalid image")
+
+	formats = []struct {
+		name         string
+		magic        string
+		decode       func(io.Reader) (image.Image, error)
+		decodeConfig func(io.Reader) (image.Config, error)
+	}{
+		{"jpeg", "\xff\xd8\xff", jpeg.Decode, jpeg.DecodeConfig},
+		{"png", "\x89PNG\r\n\x1a\n", png.Decode, png.DecodeConfig},
+		{"webp", "RIFF????WEBP", webp.Decode, webp.DecodeConfig},
+	}
+)
+
+// Variant is a size images are stored at, no larger than MaxSize pixels on either side. Name is added to the
+// file name of every variant but the full size one
+type Variant struct {
+	Name    string
+	MaxSize int
+}
+
+var (
+	Full      = Variant{Name: "", MaxSize: 0}
+	Medium    = Variant{Name: "medium", MaxSize: 800}
+	Thumbnail = Variant{Name: "thumb", MaxSize: 240}
+
+	// CarVariants are the sizes car images are stored at
+	CarVariants = []Variant{Full, Medium, Thumbnail}
+)
+
+// VariantName is the file name, without extension, the variant of the image name is stored under
+func VariantName(name string, variant Variant) string {
+	if variant.Name == "" {
+		return name
+	}
+
+	return name + "_" + variant.Name
+}
+
+// Read decodes an uploaded JPEG, PNG or WebP image, sent as the file itself or base64 encoded as the site
+// has always sent them, optionally as a data URL. The image is turned the right way up using its EXIF
+// orientation, the metadata itself is dropped as images are only ever stored re-encoded
+func Read(r io.Reader) (image.Image, error) {
+
+	//Base64 takes 4 bytes for every 3, plus room for a data URL prefix
+	limit := *MaxUploadSize/3*4 + 1024
+
+	content, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, ImageTooLarge
+	}
+
+	if detect(content) == -1 {
+		content, err = decodeBase64(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if int64(len(content)) > *MaxUploadSize {
+		return nil, ImageTooLarge
+	}
+
+	return Decode(content)
+}
+
+// Decode checks the format and dimensions of an image before decoding it
+func Decode(content []byte) (image.Image, error) {
+
+	format := detect(content)
+	if format == -1 {
+		return nil, UnsupportedFormat
+	}
+
+	config, err := formats[format].decodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, InvalidImage
+	}
+	if config.Width < 1 || config.Height < 1 {
+		return nil, InvalidImage
+	}
+	if config.Width > *MaxDimension || config.Height > *MaxDimension {
+		return nil, DimensionsTooBig
+	}
+	if int64(config.Width)*int64(config.Height) > *MaxPixels {
+		return nil, DimensionsTooBig
+	}
+
+	img, err := formats[format].decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, InvalidImage
+	}
+
+	if formats[format].name == "jpeg" {
+		img = orient(img, jpegOrientation(content))
+	}
+
+	return img, nil
+}
+
+// detect returns the index in formats of the image's format, -1 if it isn't one accepted
+func detect(content []byte) int {
+	for i, format := range formats {
+		if len(content) < len(format.magic) {
+			continue
+		}
+
+		match := true
+		for j := 0; j < len(format.magic); j++ {
+			if format.magic[j] != '?' && format.magic[j] != content[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func decodeBase64(content []byte) ([]byte, error) {
+
+	text := strings.TrimSpace(string(content))
+	if strings.HasPrefix(text, "data:") {
+		comma := strings.Index(text, ",")
+		if comma == -1 {
+			return nil, InvalidImage
+		}
+		text = text[comma+1:]
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, UnsupportedFormat
+	}
+
+	return decoded, nil
+}
+
+// Resize scales img down to fit within maxSize pixels, keeping its aspect ratio. Smaller images, and any
+// image when maxSize is 0, are returned as they are
+func Resize(img image.Image, maxSize int) image.Image {
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxSize <= 0 || width <= maxSize && height <= maxSize {
+		return img
+	}
+
+	if width >= height {
+		width, height = maxSize, height*maxSize/width
+	} else {
+		width, height = width*maxSize/height, maxSize
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+
+	return resized
+}
+
+// EncodeJPEG encodes img at the configured quality, with no metadata
+func EncodeJPEG(img image.Image) ([]byte, error) {
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: *Quality})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// IsUserError reports whether err is a problem with the uploaded image rather than the server
+func IsUserError(err error) bool {
+	return err == ImageTooLarge || err == DimensionsTooBig || err == UnsupportedFormat || err == InvalidImage
+}
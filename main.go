@@ -5,27 +5,44 @@ import (
 	"carHiringWebsite/ABIDataProvider"
 	"carHiringWebsite/DVLADataProvider"
 	"carHiringWebsite/VehicleScanner"
+	"carHiringWebsite/authorisation"
 	"carHiringWebsite/data"
 	"carHiringWebsite/db"
+	"carHiringWebsite/imaging"
+	"carHiringWebsite/notification"
+	"carHiringWebsite/oidc"
 	"carHiringWebsite/response"
+	"carHiringWebsite/roles"
 	"carHiringWebsite/services/adminService"
+	"carHiringWebsite/services/alertService"
+	"carHiringWebsite/services/apiKeyService"
+	"carHiringWebsite/services/auditService"
 	"carHiringWebsite/services/bookingService"
 	"carHiringWebsite/services/carService"
+	"carHiringWebsite/services/datasetService"
+	"carHiringWebsite/services/notificationService"
+	"carHiringWebsite/services/retentionService"
+	"carHiringWebsite/services/reviewService"
 	"carHiringWebsite/services/userService"
+	"carHiringWebsite/storage"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var oidcLanding *string
+
 func main() {
 	var err error
 
@@ -38,6 +55,77 @@ func main() {
 
 	port := flag.String("port", "8080", "the port the server will run on")
 
+	oidc.Issuer = flag.String("oidc-issuer", "", "the OpenID Connect issuer staff sign in with, leave empty to disable")
+	oidc.ClientID = flag.String("oidc-client-id", "", "the client ID registered with the OpenID Connect issuer")
+	oidc.ClientSecret = flag.String("oidc-client-secret", "", "the client secret registered with the OpenID Connect issuer")
+	oidc.RedirectURL = flag.String("oidc-redirect-url", "http://localhost:8080/userService/oidcCallback", "the URL the OpenID Connect issuer returns users to")
+	oidc.GroupRoles = flag.String("oidc-groups", "", "comma separated group=role pairs mapping OpenID Connect groups to roles")
+	notification.Kind = flag.String("notifier", "file", "how notifications are sent: smtp, file or log")
+	notification.TemplateDir = flag.String("notify-templates", "./notificationTemplates/", "the directory notification templates are read from")
+	notification.DropDir = flag.String("notify-dir", "./emails/", "the directory the file notifier writes messages to")
+	notification.SMTPAddress = flag.String("smtp-address", "localhost:25", "the SMTP server host:port used by the smtp notifier")
+	notification.SMTPUser = flag.String("smtp-user", "", "the SMTP user, leave empty to send without authenticating")
+	notification.SMTPPassword = flag.String("smtp-pass", "", "the SMTP password")
+	notification.FromName = flag.String("mail-from-name", "Banger", "the name notifications are sent from")
+	notification.FromAddress = flag.String("mail-from", "noreply@banger.example", "the address notifications are sent from")
+	notification.CompanyName = flag.String("company-name", "Banger", "the company name shown in notifications")
+	notification.CompanyReference = flag.String("company-reference", "4Uv5axPVhqkdTeC", "the company reference number given to regulators")
+	notification.Branch = flag.String("branch", "Stoke-On-Trent", "the office branch location shown in notifications")
+	notification.BranchAddress = flag.String("branch-address", "", "the postal address of the branch given in regulatory alerts")
+	notification.BranchPhone = flag.String("branch-phone", "", "the telephone number of the branch given in regulatory alerts")
+	notification.SMSKind = flag.String("sms-provider", "none", "how SMS are sent: gateway, fake or none")
+	notification.SMSGatewayURL = flag.String("sms-gateway-url", "", "the HTTP SMS gateway messages are posted to")
+	notification.SMSGatewayKey = flag.String("sms-gateway-key", "", "the bearer token sent to the SMS gateway")
+	notification.SMSFrom = flag.String("sms-from", "Banger", "the sender ID SMS are sent from")
+	notification.SMSRecipientLimit = flag.Int("sms-limit-recipient", 5, "the most SMS sent to one number per hour, 0 for no limit")
+	notification.SMSGlobalLimit = flag.Int("sms-limit-global", 60, "the most SMS sent per minute, 0 for no limit")
+	notification.SiteURL = flag.String("site-url", "http://localhost:8080", "the public address of the site, used for links in notifications")
+	notification.OutboxInterval = flag.Duration("outbox-interval", 15*time.Second, "how often queued notifications are checked for delivery")
+	notificationService.CollectionReminders = flag.String("collection-reminders", "48h,24h", "comma separated times before a booking starts to remind the customer to collect")
+	notificationService.ReturnReminders = flag.String("return-reminders", "24h,2h", "comma separated times before a booking is due back to remind the customer to return")
+	notificationService.ReminderInterval = flag.Duration("reminder-interval", 5*time.Minute, "how often bookings are checked for reminders and overdue returns")
+	notificationService.ReturnTime = flag.Duration("return-time", 13*time.Hour, "time of day standard bookings must be returned by on their last day")
+	notificationService.StaffAlertAddress = flag.String("staff-alert-address", "bookings@banger.example", "where overdue return alerts are sent")
+	ABIDataProvider.Kind = flag.String("abi-provider", "db", "how ABI checks are made: db, or access on Windows")
+	ABIDataProvider.MatchThreshold = flag.Float64("abi-match-threshold", 0.97, "the ABI claim score, from 0 to 1, at which a driver is refused")
+	ABIDataProvider.ReviewThreshold = flag.Float64("abi-review-threshold", 0.85, "the ABI claim score, from 0 to 1, at which a driver is sent for admin review")
+	ABIDataProvider.PrefixScale = flag.Float64("abi-prefix-scale", 0.1, "the Jaro-Winkler weight, up to 0.25, given to names sharing a prefix")
+	ABIDataProvider.MaxRejected = flag.Float64("abi-max-rejected", 0.1, "the fraction of rows in an ABI file that may be invalid before the file is refused")
+	DVLADataProvider.MaxRejected = flag.Float64("dvla-max-rejected", 0.1, "the fraction of rows in a DVLA file that may be invalid before the file is refused")
+	DVLADataProvider.ReloadInterval = flag.Duration("dvla-reload-interval", 5*time.Second, "how often DVLAfiles is checked for a changed dataset")
+	datasetService.MaxUploadSize = flag.Int64("dataset-max-size", 256<<20, "the largest DVLA or ABI file admins can upload in bytes")
+	alertService.DVLAAddress = flag.String("dvla-alert-address", "offences@dvla.example", "where DVLA offence alerts are sent")
+	alertService.DVLAReference = flag.String("dvla-reference", "", "the company reference given to the DVLA, defaults to company-reference")
+	alertService.ABIAddress = flag.String("abi-alert-address", "fraud@abi.example", "where ABI fraud alerts are sent")
+	alertService.ABIReference = flag.String("abi-reference", "", "the company reference given to the ABI, defaults to company-reference")
+
+	retentionService.LicenseRetention = flag.Int("retention-license", 1095, "days driving licence scans are kept after a booking finishes, 0 to keep forever")
+	retentionService.IdentityRetention = flag.Int("retention-identity", 1095, "days identity document scans are kept after a booking finishes, 0 to keep forever")
+	retentionService.EmailRetention = flag.Int("retention-email", 730, "days emails in notify-dir are kept after their booking finishes, 0 to keep forever")
+	retentionService.AlertRetention = flag.Int("retention-alert", 2190, "days regulatory alert emails in notify-dir are kept after their booking finishes, 0 to keep forever")
+	retentionService.PurgeInterval = flag.Duration("purge-interval", 24*time.Hour, "how often files past their retention period are purged, 0 to only purge when an admin asks")
+	retentionService.PurgeDryRun = flag.Bool("purge-dry-run", false, "report what the scheduled purge would remove without removing anything")
+	imaging.MaxUploadSize = flag.Int64("image-max-size", 10<<20, "the largest image, car photo or document scan, accepted in bytes")
+	imaging.MaxDimension = flag.Int("image-max-dimension", 8000, "the largest width or height of an uploaded image in pixels")
+	imaging.MaxPixels = flag.Int64("image-max-pixels", 40000000, "the largest width times height of an uploaded image, bounding the memory decoding it takes")
+	imaging.Quality = flag.Int("image-quality", 85, "the JPEG quality, 1 to 100, images are stored at")
+	buildVariants := flag.Bool("build-image-variants", false, "store the medium and thumbnail sizes of car images uploaded before they were made, then exit")
+	storage.Kind = flag.String("storage", "local", "where documents and car images are stored: local or s3")
+	storage.LocalRoot = flag.String("storage-root", ".", "the directory the local store keeps documents and car images in")
+	storage.S3Endpoint = flag.String("storage-s3-endpoint", "", "the URL of the S3 compatible object store, such as http://localhost:9000")
+	storage.S3Region = flag.String("storage-s3-region", "us-east-1", "the region requests to the object store are signed for")
+	storage.S3Bucket = flag.String("storage-s3-bucket", "", "the bucket documents and car images are kept in")
+	storage.S3AccessKey = flag.String("storage-s3-access-key", "", "the access key for the object store")
+	storage.S3SecretKey = flag.String("storage-s3-secret-key", "", "the secret key for the object store")
+	storage.SigningKey = flag.String("storage-signing-key", "", "the key download URLs from the local store are signed with, random when empty")
+	storage.URLExpiry = flag.Duration("storage-url-expiry", 15*time.Minute, "how long document download URLs are valid for")
+	storage.DocumentKeys = flag.String("document-keys", "", "comma separated id=base64 32 byte keys identity documents are encrypted with, the first encrypts new documents")
+	storage.AllowUnencrypted = flag.Bool("allow-unencrypted-documents", false, "store identity documents unencrypted when no document keys are set, and serve documents stored before they were until rotate-document-keys has run")
+	rotateKeys := flag.Bool("rotate-document-keys", false, "re-encrypt stored identity documents with the first document key, then exit")
+	migrateFrom := flag.String("storage-migrate-from", "", "move documents and car images from this directory into the configured store, then exit")
+
+	oidcLanding = flag.String("oidc-landing", "/", "where users are sent after signing in with OpenID Connect")
+
 	flag.Parse()
 
 	// Build front-end if param specified
@@ -54,30 +142,108 @@ func main() {
 		fmt.Println("Finished building")
 	}
 
+	err = storage.InitStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(*migrateFrom) > 0 {
+		report, err := storage.MigrateLocal(*migrateFrom)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Moved %d files (%d bytes), %d already stored, %d conflicts\n", report.Moved, report.Bytes, report.Existing, len(report.Conflicts))
+		for _, key := range report.Conflicts {
+			fmt.Println("Conflict: " + key)
+		}
+		return
+	}
+
+	if *rotateKeys {
+		report, err := storage.RotateKeys()
+		if report != nil {
+			fmt.Printf("Rotated %d documents, encrypted %d unencrypted documents, %d already current\n", report.Rotated, report.Encrypted, report.Current)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Initiate db connection
 	err = db.InitDB()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if *buildVariants {
+		built, err := carService.BuildImageVariants()
+		fmt.Printf("Built sizes for %d car images\n", built)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	err = ABIDataProvider.InitProvider()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	DVLADataProvider.InitProvider()
+	err = DVLADataProvider.InitProvider()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = notification.InitNotifier()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db.BookingStatusListener = notificationService.BookingStatusChanged
+
+	err = notification.StartWorker()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = notificationService.StartReminders()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = retentionService.StartPurge()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = oidc.InitProvider()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	//Serve the website files generated from the build-job in public
 
 	http.HandleFunc("/", SiteHandler)
+	http.HandleFunc("/storage/", storageHandler)
 
 	//Service endpoints
 	http.HandleFunc("/userService/register", registrationHandler)
 	http.HandleFunc("/userService/login", loginHandler)
 	http.HandleFunc("/userService/logout", logoutHandler)
+	http.HandleFunc("/userService/oidcLogin", oidcLoginHandler)
+	http.HandleFunc("/userService/oidcCallback", oidcCallbackHandler)
+	http.HandleFunc("/userService/oidcLink", authorisation.Authenticated(oidcLinkHandler))
 	http.HandleFunc("/userService/sessionCheck", sessionCheckHandler)
 	http.HandleFunc("/userService/get", getUserHandler)
-	http.HandleFunc("/userService/edit", editUserHandler)
+	http.HandleFunc("/userService/edit", authorisation.Authenticated(editUserHandler))
+	http.HandleFunc("/userService/exportData", authorisation.Authenticated(exportUserDataHandler))
+	http.HandleFunc("/userService/requestErasure", authorisation.Authenticated(requestErasureHandler))
+	http.HandleFunc("/userService/setPhone", authorisation.Authenticated(setPhoneHandler))
+	http.HandleFunc("/userService/getNotificationPreferences", authorisation.AuthenticatedRead(getNotificationPreferencesHandler))
+	http.HandleFunc("/userService/setNotificationPreferences", authorisation.Authenticated(setNotificationPreferencesHandler))
+	http.HandleFunc("/notificationService/unsubscribe", unsubscribeHandler)
 
 	http.HandleFunc("/carService/getAll", getAllCarsHandler)
 	http.HandleFunc("/carService/get", getCarHandler)
@@ -89,37 +255,70 @@ func main() {
 	http.HandleFunc("/carService/testInsure", testInsure)
 	http.HandleFunc("/carService/testDVLA", testDVLA)
 
-	http.HandleFunc("/bookingService/create", createBookingHandler)
-	http.HandleFunc("/bookingService/makePayment", makePaymentHandler)
-	http.HandleFunc("/bookingService/getUserBookings", getUsersBookingsHandler)
-	http.HandleFunc("/bookingService/getExtensionDays", getExtensionDaysHandler)
-	http.HandleFunc("/bookingService/cancelBooking", cancelBookingHandler)
-	http.HandleFunc("/bookingService/history", historyBookingHandler)
-	http.HandleFunc("/bookingService/editBooking", editBookingHandler)
-	http.HandleFunc("/bookingService/extendBooking", extendBookingHandler)
-	http.HandleFunc("/bookingService/payExtension", payExtensionHandler)
-	http.HandleFunc("/bookingService/getDriver", getDriverHandler)
-
-	http.HandleFunc("/adminService/getBookingStats", getBookingStatsHandler)
-	http.HandleFunc("/adminService/getUserStats", getUserStatsHandler)
-	http.HandleFunc("/adminService/getUsers", getUsersHandler)
-	http.HandleFunc("/adminService/getCarStats", getCarStatsHandler)
-	http.HandleFunc("/adminService/getAccessoryStats", getAccessoryStatsHandler)
-	http.HandleFunc("/adminService/getSearchedBookings", getSearchedBookingsHandler)
-	http.HandleFunc("/adminService/getAwaitingBookings", getAwaitingBookingsHandler)
-	http.HandleFunc("/adminService/getQueryingRefundBookings", getQueryingRefundBookings)
-	http.HandleFunc("/adminService/getBookingStatuses", getBookingStatusesHandler)
-	http.HandleFunc("/adminService/getBooking", getAdminBookingHandler)
-	http.HandleFunc("/adminService/getUser", getAdminUserHandler)
-	http.HandleFunc("/adminService/progressBooking", progressBookingHandler)
-	http.HandleFunc("/adminService/processExtraPayment", processExtraPaymentHandler)
-	http.HandleFunc("/adminService/processRefund", processRefundHandler)
-	http.HandleFunc("/adminService/getCars", adminGetCarsHandler)
-	http.HandleFunc("/adminService/createCar", createCarHandler)
-	http.HandleFunc("/adminService/updateCar", updateCarHandler)
-	http.HandleFunc("/adminService/setUser", setUserHandler)
-	http.HandleFunc("/adminService/createUser", adminCreateUserHandler)
-	http.HandleFunc("/adminService/verifyDriver", verifyDriverUserHandler)
+	http.HandleFunc("/bookingService/create", authorisation.Authenticated(createBookingHandler))
+	http.HandleFunc("/bookingService/makePayment", authorisation.Authenticated(makePaymentHandler))
+	http.HandleFunc("/bookingService/getUserBookings", authorisation.AuthenticatedRead(getUsersBookingsHandler))
+	http.HandleFunc("/bookingService/getExtensionDays", authorisation.AuthenticatedRead(getExtensionDaysHandler))
+	http.HandleFunc("/bookingService/cancelBooking", authorisation.Authenticated(cancelBookingHandler))
+	http.HandleFunc("/bookingService/history", authorisation.AuthenticatedRead(historyBookingHandler))
+	http.HandleFunc("/bookingService/editBooking", authorisation.Authenticated(editBookingHandler))
+	http.HandleFunc("/bookingService/extendBooking", authorisation.Authenticated(extendBookingHandler))
+	http.HandleFunc("/bookingService/payExtension", authorisation.Authenticated(payExtensionHandler))
+	http.HandleFunc("/bookingService/getDriver", authorisation.AuthenticatedRead(getDriverHandler))
+
+	http.HandleFunc("/adminService/getBookingStats", authorisation.Require(roles.StatsView, getBookingStatsHandler))
+	http.HandleFunc("/adminService/getUserStats", authorisation.Require(roles.StatsView, getUserStatsHandler))
+	http.HandleFunc("/adminService/getUsers", authorisation.Require(roles.UserView, getUsersHandler))
+	http.HandleFunc("/adminService/getCarStats", authorisation.Require(roles.StatsView, getCarStatsHandler))
+	http.HandleFunc("/adminService/getAccessoryStats", authorisation.Require(roles.StatsView, getAccessoryStatsHandler))
+	http.HandleFunc("/adminService/getSearchedBookings", authorisation.Require(roles.BookingView, getSearchedBookingsHandler))
+	http.HandleFunc("/adminService/getAwaitingBookings", authorisation.Require(roles.BookingView, getAwaitingBookingsHandler))
+	http.HandleFunc("/adminService/getQueryingRefundBookings", authorisation.Require(roles.BookingView, getQueryingRefundBookings))
+	http.HandleFunc("/adminService/getBookingStatuses", authorisation.Require(roles.BookingView, getBookingStatusesHandler))
+	http.HandleFunc("/adminService/getBooking", authorisation.Require(roles.BookingView, getAdminBookingHandler))
+	http.HandleFunc("/adminService/getUser", authorisation.Require(roles.UserView, getAdminUserHandler))
+	http.HandleFunc("/adminService/progressBooking", authorisation.Require(roles.BookingProgress, progressBookingHandler))
+	http.HandleFunc("/adminService/processExtraPayment", authorisation.Require(roles.PaymentProcess, processExtraPaymentHandler))
+	http.HandleFunc("/adminService/processRefund", authorisation.Require(roles.RefundProcess, processRefundHandler))
+	http.HandleFunc("/adminService/getCars", authorisation.Require(roles.CarView, adminGetCarsHandler))
+	http.HandleFunc("/adminService/createCar", authorisation.Require(roles.CarEdit, createCarHandler))
+	http.HandleFunc("/adminService/updateCar", authorisation.Require(roles.CarEdit, updateCarHandler))
+	http.HandleFunc("/adminService/getCarImages", authorisation.Require(roles.CarView, getCarImagesHandler))
+	http.HandleFunc("/adminService/addCarImage", authorisation.Require(roles.CarEdit, addCarImageHandler))
+	http.HandleFunc("/adminService/updateCarImage", authorisation.Require(roles.CarEdit, updateCarImageHandler))
+	http.HandleFunc("/adminService/reorderCarImages", authorisation.Require(roles.CarEdit, reorderCarImagesHandler))
+	http.HandleFunc("/adminService/deleteCarImage", authorisation.Require(roles.CarEdit, deleteCarImageHandler))
+	http.HandleFunc("/adminService/setUser", authorisation.RequireParameter("mode", adminService.SetUserPermissions, setUserHandler))
+	http.HandleFunc("/adminService/createUser", authorisation.Require(roles.UserCreate, adminCreateUserHandler))
+	http.HandleFunc("/adminService/verifyDriver", authorisation.Require(roles.DriverVerify, verifyDriverUserHandler))
+	http.HandleFunc("/adminService/getAuditLog", authorisation.Require(roles.AuditView, getAuditLogHandler))
+	http.HandleFunc("/adminService/exportAuditLog", authorisation.Require(roles.AuditView, exportAuditLogHandler))
+	http.HandleFunc("/adminService/getErasureRequests", authorisation.Require(roles.UserErase, getErasureRequestsHandler))
+	http.HandleFunc("/adminService/processErasure", authorisation.Require(roles.UserErase, processErasureHandler))
+	http.HandleFunc("/adminService/startImpersonation", authorisation.Require(roles.UserImpersonate, startImpersonationHandler))
+	http.HandleFunc("/adminService/createAPIKey", authorisation.Require(roles.APIKeyManage, createAPIKeyHandler))
+	http.HandleFunc("/adminService/getAPIKeys", authorisation.Require(roles.APIKeyManage, getAPIKeysHandler))
+	http.HandleFunc("/adminService/revokeAPIKey", authorisation.Require(roles.APIKeyManage, revokeAPIKeyHandler))
+	http.HandleFunc("/adminService/getOutboxStatus", authorisation.Require(roles.NotificationView, getOutboxStatusHandler))
+	http.HandleFunc("/adminService/retryNotification", authorisation.Require(roles.NotificationRetry, retryNotificationHandler))
+	http.HandleFunc("/adminService/getRegulatoryAlerts", authorisation.Require(roles.RegulatoryAlertView, getRegulatoryAlertsHandler))
+	http.HandleFunc("/adminService/getRegulatoryAlert", authorisation.Require(roles.RegulatoryAlertView, getRegulatoryAlertHandler))
+	http.HandleFunc("/adminService/getDVLAStatus", authorisation.Require(roles.DatasetView, getDVLAStatusHandler))
+	http.HandleFunc("/adminService/uploadDataset", authorisation.Require(roles.DatasetManage, uploadDatasetHandler))
+	http.HandleFunc("/adminService/getDatasetImports", authorisation.Require(roles.DatasetView, getDatasetImportsHandler))
+	http.HandleFunc("/adminService/previewDataset", authorisation.Require(roles.DatasetView, previewDatasetHandler))
+	http.HandleFunc("/adminService/activateDataset", authorisation.Require(roles.DatasetManage, activateDatasetHandler))
+	http.HandleFunc("/adminService/rollbackDataset", authorisation.Require(roles.DatasetManage, rollbackDatasetHandler))
+	http.HandleFunc("/adminService/getDriverReviews", authorisation.Require(roles.DriverReview, getDriverReviewsHandler))
+	http.HandleFunc("/adminService/getDriverReview", authorisation.Require(roles.DriverReview, getDriverReviewHandler))
+	http.HandleFunc("/adminService/resolveDriverReview", authorisation.Require(roles.DriverReview, resolveDriverReviewHandler))
+	http.HandleFunc("/adminService/removeDriverBlacklist", authorisation.Require(roles.DriverReview, removeDriverBlacklistHandler))
+	http.HandleFunc("/adminService/getDocumentURL", authorisation.Require(roles.DocumentView, getDocumentURLHandler))
+	http.HandleFunc("/adminService/getLegalHolds", authorisation.Require(roles.RetentionManage, getLegalHoldsHandler))
+	http.HandleFunc("/adminService/placeLegalHold", authorisation.Require(roles.RetentionManage, placeLegalHoldHandler))
+	http.HandleFunc("/adminService/releaseLegalHold", authorisation.Require(roles.RetentionManage, releaseLegalHoldHandler))
+	http.HandleFunc("/adminService/purgeDocuments", authorisation.Require(roles.RetentionManage, purgeDocumentsHandler))
+	http.HandleFunc("/adminService/getPurgeReports", authorisation.Require(roles.RetentionManage, getPurgeReportsHandler))
 
 	fmt.Printf("\nDB settings - User: %s, Pass: %s, Address: %s, Schema: %s\n\n", *db.User, *db.Pass, *db.Address, *db.Schema)
 	fmt.Printf("Server Start Listening on port %s\n\n", *port)
@@ -150,30 +349,19 @@ func SiteHandler(w http.ResponseWriter, r *http.Request) {
 	paths := strings.Split(r.RequestURI, "/")
 	if len(paths) >= 0 {
 		if strings.Compare(paths[1], "cars") == 0 {
-			r.RequestURI = paths[2]
-			r.URL.Path = paths[2]
 			enableCors(&w)
-			carFileServe := http.FileServer(http.Dir("./cars"))
-			carFileServe.ServeHTTP(w, r)
+			err = serveStored(w, storage.Cars+strings.TrimPrefix(r.URL.Path, "/cars/"))
 			return
 		}
 		if strings.Compare(paths[1], "documents") == 0 {
 
-			var (
-				token *http.Cookie
-				user  *data.User
-			)
-			token, err = r.Cookie("session-token")
-			if err != nil {
-				return
-			}
-
-			user, err = userService.GetUserFromSession(token.Value)
+			var user *data.User
+			user, err = authorisation.Authenticate(r)
 			if err != nil {
 				return
 			}
 
-			if !user.Admin {
+			if !authorisation.Can(user, roles.DocumentView) {
 				var (
 					driverID  int
 					related   bool
@@ -215,11 +403,8 @@ func SiteHandler(w http.ResponseWriter, r *http.Request) {
 
 			}
 
-			r.RequestURI = strings.Join(paths[2:], "/")
-			r.URL.Path = strings.Join(paths[2:], "/")
 			enableCors(&w)
-			carFileServe := http.FileServer(http.Dir("./documents"))
-			carFileServe.ServeHTTP(w, r)
+			err = serveStored(w, storage.Documents+strings.TrimPrefix(r.URL.Path, "/documents/"))
 			return
 		}
 	}
@@ -232,12 +417,62 @@ func SiteHandler(w http.ResponseWriter, r *http.Request) {
 	fileServe.ServeHTTP(w, r)
 }
 
+// serveStored streams a stored file, typed by its extension
+func serveStored(w http.ResponseWriter, key string) error {
+
+	reader, err := storage.Get(key)
+	if err == storage.NotFound || err == storage.InvalidKey {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+
+	_, err = io.Copy(w, reader)
+	if err != nil {
+		log.Printf("serveStored error - err: %v\nkey:%v\n", err, key)
+	}
+
+	return nil
+}
+
+// storageHandler serves files from the local store to holders of a signed URL, see storage.URL
+func storageHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("storageHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/storage/")
+
+	if storage.Verify(key, r.FormValue("expires"), r.FormValue("signature")) != nil {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	err = serveStored(w, key)
+}
+
 func verifyDriverUserHandler(w http.ResponseWriter, r *http.Request) {
 	enableCors(&w)
 	var err error
 
 	defer func() {
-		if err == adminService.BlackListedDriver || err == DVLADataProvider.InvalidLicense || err == ABIDataProvider.FraudulentClaim {
+		if adminService.IsVerifyFailure(err) {
 			return
 		} else if err != nil {
 			log.Printf("verifyDriverUserHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
@@ -263,15 +498,10 @@ func verifyDriverUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	if len(token.Value) == 0 {
-		err = errors.New("incorrect session")
-		return
-	}
+	//Room for three base64 images and the JSON around them
+	r.Body = http.MaxBytesReader(w, r.Body, 3*(*imaging.MaxUploadSize/3*4+1024)+1024)
 
 	var images data.ImageBundle
 	err = json.NewDecoder(r.Body).Decode(&images)
@@ -279,8 +509,8 @@ func verifyDriverUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = adminService.VerifyDriver(token.Value, dob, lastname, names, address, postcode, license, bookingID, images)
-	if err == adminService.BlackListedDriver || err == DVLADataProvider.InvalidLicense || err == ABIDataProvider.FraudulentClaim {
+	err = adminService.VerifyDriver(user, dob, lastname, names, address, postcode, license, bookingID, images)
+	if adminService.IsVerifyFailure(err) {
 		w.Write([]byte(`"` + err.Error() + `"`))
 		return
 	}
@@ -289,7 +519,7 @@ func verifyDriverUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := adminService.GetBooking(token.Value, bookingID)
+	data, err := adminService.GetBooking(user, bookingID)
 	if err != nil {
 		return
 	}
@@ -326,17 +556,9 @@ func adminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
-
-	if len(token.Value) == 0 {
-		err = errors.New("incorrect session")
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	created, newUser, err := adminService.CreateUser(token.Value, email, password, firstname, names, dobString)
+	created, newUser, err := adminService.CreateUser(user, email, password, firstname, names, dobString)
 	if err != nil {
 		return
 	}
@@ -382,17 +604,9 @@ func editUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
-
-	if len(token.Value) == 0 {
-		err = errors.New("incorrect session")
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	newUser, err := userService.EditUser(token.Value, userID, email, oldPassword, password, firstname, names, dobString)
+	newUser, err := userService.EditUser(user, userID, email, oldPassword, password, firstname, names, dobString)
 	var buffer bytes.Buffer
 	encoder := json.NewEncoder(&buffer)
 	if err == userService.UsernameAlreadyExists {
@@ -412,6 +626,69 @@ func editUserHandler(w http.ResponseWriter, r *http.Request) {
 	encoder.Encode(&newUser)
 	w.Write(buffer.Bytes())
 }
+func exportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("exportUserDataHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	var buffer bytes.Buffer
+	err = userService.ExportData(user, &buffer)
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"mydata_"+strconv.FormatInt(time.Now().Unix(), 10)+".zip\"")
+	w.Write(buffer.Bytes())
+}
+
+func requestErasureHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("requestErasureHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	err = userService.RequestErasure(user)
+	if err == userService.ErasureAlreadyPending {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
 func registrationHandler(w http.ResponseWriter, r *http.Request) {
 	enableCors(&w)
 	var err error
@@ -532,6 +809,130 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("oidcLoginHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	authURL, state, err := oidc.AuthCodeURL(0)
+	if err != nil {
+		return
+	}
+
+	setOIDCState(w, state)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcLinkHandler sends the signed in user to the identity provider to link the identity they sign in with to
+// their account
+func oidcLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("oidcLinkHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	authURL, state, err := userService.OIDCLinkURL(user)
+	if err != nil {
+		return
+	}
+
+	setOIDCState(w, state)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// setOIDCState keeps the login state in the browser starting the login, the callback only completes it there
+func setOIDCState(w http.ResponseWriter, state string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidc.StateCookie,
+		Value:    state,
+		Path:     "/userService/oidcCallback",
+		MaxAge:   int(oidc.LoginExpiry / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("oidcCallbackHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	if providerError := r.FormValue("error"); providerError != "" {
+		err = errors.New("identity provider error: " + providerError + " " + r.FormValue("error_description"))
+		return
+	}
+
+	state := r.FormValue("state")
+	code := r.FormValue("code")
+	if state == "" || code == "" {
+		err = errors.New("incorrect parameters")
+		return
+	}
+
+	cookieState := ""
+	if cookie, cookieErr := r.Cookie(oidc.StateCookie); cookieErr == nil {
+		cookieState = cookie.Value
+	}
+
+	//The state is single use, so the cookie is cleared whether or not the login completes
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidc.StateCookie,
+		Path:     "/userService/oidcCallback",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authUser, err := userService.OIDCLogin(state, cookieState, code, authorisation.RemoteAddr(r))
+	if err != nil {
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session-token",
+		Value:    authUser.SessionToken,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, *oidcLanding, http.StatusFound)
+}
+
 func getUserHandler(w http.ResponseWriter, r *http.Request) {
 	enableCors(&w)
 	var err error
@@ -889,10 +1290,7 @@ func createBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	start := r.FormValue("start")
 	end := r.FormValue("end")
@@ -902,12 +1300,12 @@ func createBookingHandler(w http.ResponseWriter, r *http.Request) {
 	accessories := r.FormValue("accessories")
 	days := r.FormValue("days")
 
-	if start == "" || end == "" || carID == "" || late == "" || days == "" || len(token.Value) == 0 {
+	if start == "" || end == "" || carID == "" || late == "" || days == "" {
 		err = errors.New("incorrect parameters")
 		return
 	}
 
-	booking, err := bookingService.Create(token.Value, start, end, carID, late, fullDay, accessories, days)
+	booking, err := bookingService.Create(user, start, end, carID, late, fullDay, accessories, days)
 	if err != nil {
 		return
 	}
@@ -934,10 +1332,7 @@ func payExtensionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	bookingID := r.FormValue("bookingID")
 
@@ -946,7 +1341,7 @@ func payExtensionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = bookingService.MakeExtensionPayment(token.Value, bookingID)
+	err = bookingService.MakeExtensionPayment(user, bookingID)
 	if err != nil {
 		return
 	}
@@ -970,10 +1365,7 @@ func makePaymentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	bookingID := r.FormValue("bookingID")
 
@@ -982,7 +1374,7 @@ func makePaymentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = bookingService.MakePayment(token.Value, bookingID)
+	err = bookingService.MakePayment(user, bookingID)
 	if err != nil {
 		return
 	}
@@ -1006,10 +1398,7 @@ func cancelBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	bookingID := r.FormValue("bookingID")
 
@@ -1018,7 +1407,7 @@ func cancelBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = bookingService.CancelBooking(token.Value, bookingID)
+	err = bookingService.CancelBooking(user, bookingID)
 	if err != nil {
 		return
 	}
@@ -1042,10 +1431,7 @@ func historyBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	bookingID := r.FormValue("bookingID")
 
@@ -1054,7 +1440,7 @@ func historyBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	history, err := bookingService.GetHistory(token.Value, bookingID)
+	history, err := bookingService.GetHistory(user, bookingID)
 	if err != nil {
 		return
 	}
@@ -1081,10 +1467,7 @@ func extendBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	bookingID := r.FormValue("bookingID")
 	lateReturn := r.FormValue("lateReturn")
@@ -1096,7 +1479,7 @@ func extendBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = bookingService.ExtendBooking(token.Value, bookingID, lateReturn, fullDay, days)
+	err = bookingService.ExtendBooking(user, bookingID, lateReturn, fullDay, days)
 	if err != nil {
 		return
 	}
@@ -1120,10 +1503,7 @@ func editBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	bookingID := r.FormValue("bookingID")
 	remove := r.FormValue("remove")
@@ -1136,7 +1516,7 @@ func editBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = bookingService.EditBooking(token.Value, bookingID, remove, add, lateReturn, fullDay)
+	err = bookingService.EditBooking(user, bookingID, remove, add, lateReturn, fullDay)
 	if err != nil {
 		return
 	}
@@ -1166,16 +1546,9 @@ func getDriverHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	if len(token.Value) == 0 {
-		err = errors.New("incorrect parameters")
-		return
-	}
-	response, err := bookingService.GetDriver(token.Value, driverID)
+	response, err := bookingService.GetDriver(user, driverID)
 	if err != nil {
 		return
 	}
@@ -1208,16 +1581,9 @@ func getExtensionDaysHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	if len(token.Value) == 0 {
-		err = errors.New("incorrect parameters")
-		return
-	}
-	response, err := bookingService.CountExtensionDays(token.Value, bookingID)
+	response, err := bookingService.CountExtensionDays(user, bookingID)
 	if err != nil {
 		return
 	}
@@ -1244,16 +1610,9 @@ func getUsersBookingsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	if len(token.Value) == 0 {
-		err = errors.New("incorrect parameters")
-		return
-	}
-	bookings, err := bookingService.GetUsersBookings(token.Value)
+	bookings, err := bookingService.GetUsersBookings(user)
 	if err != nil {
 		return
 	}
@@ -1280,12 +1639,9 @@ func getBookingStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	stats, err := adminService.GetBookingStats(token.Value)
+	stats, err := adminService.GetBookingStats(user)
 	if err != nil {
 		return
 	}
@@ -1312,14 +1668,11 @@ func getUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	search := r.FormValue("search")
 
-	users, err := adminService.GetUsers(token.Value, search)
+	users, err := adminService.GetUsers(user, search)
 	if err != nil {
 		return
 	}
@@ -1346,12 +1699,9 @@ func getUserStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	stats, err := adminService.GetUserStats(token.Value)
+	stats, err := adminService.GetUserStats(user)
 	if err != nil {
 		return
 	}
@@ -1378,12 +1728,9 @@ func getBookingStatusesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	status, err := adminService.GetBookingStatuses(token.Value)
+	status, err := adminService.GetBookingStatuses(user)
 	if err != nil {
 		return
 	}
@@ -1410,12 +1757,9 @@ func getQueryingRefundBookings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	bookings, err := adminService.GetQueryingRefundBookings(token.Value)
+	bookings, err := adminService.GetQueryingRefundBookings(user)
 	if err != nil {
 		return
 	}
@@ -1442,10 +1786,7 @@ func getAwaitingBookingsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	status := r.FormValue("status")
 	limit := r.FormValue("limit")
@@ -1454,7 +1795,7 @@ func getAwaitingBookingsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bookings, err := adminService.GetAwaitingBookings(token.Value, status, limit)
+	bookings, err := adminService.GetAwaitingBookings(user, status, limit)
 	if err != nil {
 		return
 	}
@@ -1481,10 +1822,7 @@ func processRefundHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	accept := r.FormValue("accept")
 	bookingID := r.FormValue("bookingID")
@@ -1494,7 +1832,7 @@ func processRefundHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = adminService.ProcessRefundHandler(token.Value, bookingID, accept, reason)
+	err = adminService.ProcessRefundHandler(user, bookingID, accept, reason)
 	if err != nil {
 		return
 	}
@@ -1518,10 +1856,7 @@ func processExtraPaymentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	bookingID := r.FormValue("bookingID")
 	if bookingID == "" {
@@ -1529,7 +1864,7 @@ func processExtraPaymentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = adminService.ProcessExtraPayment(token.Value, bookingID)
+	err = adminService.ProcessExtraPayment(user, bookingID)
 	if err != nil {
 		return
 	}
@@ -1553,10 +1888,7 @@ func progressBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	bookingID := r.FormValue("bookingID")
 	failed := r.FormValue("failed")
@@ -1565,7 +1897,7 @@ func progressBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = adminService.ProgressBooking(token.Value, bookingID, failed)
+	err = adminService.ProgressBooking(user, bookingID, failed)
 	if err != nil {
 		return
 	}
@@ -1588,10 +1920,7 @@ func getAdminUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	userID := r.FormValue("userID")
 	if userID == "" {
@@ -1599,7 +1928,7 @@ func getAdminUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userBundle, err := adminService.GetUser(token.Value, userID)
+	userBundle, err := adminService.GetUser(user, userID)
 	if err != nil {
 		return
 	}
@@ -1626,10 +1955,7 @@ func getAdminBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	bookingID := r.FormValue("bookingID")
 	if bookingID == "" {
@@ -1637,7 +1963,7 @@ func getAdminBookingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	adminBooking, err := adminService.GetBooking(token.Value, bookingID)
+	adminBooking, err := adminService.GetBooking(user, bookingID)
 	if err != nil {
 		return
 	}
@@ -1664,16 +1990,13 @@ func getSearchedBookingsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	userSearch := r.FormValue("userSearch")
 	bookingSearch := r.FormValue("bookingSearch")
 	statusFilter := r.FormValue("statusFilter")
 
-	stats, err := adminService.GetSearchedBookings(token.Value, userSearch, bookingSearch, statusFilter)
+	stats, err := adminService.GetSearchedBookings(user, userSearch, bookingSearch, statusFilter)
 	if err != nil {
 		return
 	}
@@ -1700,10 +2023,7 @@ func setUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	mode := r.FormValue("mode")
 	value := r.FormValue("value")
@@ -1714,7 +2034,7 @@ func setUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = adminService.SetUser(token.Value, userID, mode, value)
+	err = adminService.SetUser(user, userID, mode, value)
 	if err != nil {
 		return
 	}
@@ -1738,12 +2058,9 @@ func getAccessoryStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	stats, err := adminService.GetAccessoryStats(token.Value)
+	stats, err := adminService.GetAccessoryStats(user)
 	if err != nil {
 		return
 	}
@@ -1770,10 +2087,7 @@ func createCarHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	fuelType := r.FormValue("fuelType")
 	gearType := r.FormValue("gearType")
@@ -1791,7 +2105,15 @@ func createCarHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = adminService.CreateCar(token.Value, fuelType, gearType, carType, size, colour, seats, price, disabled, over25, description, r.Body)
+	err = adminService.CreateCar(user, fuelType, gearType, carType, size, colour, seats, price, disabled, over25, description, r.Body)
+	if imaging.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
 	if err != nil {
 		return
 	}
@@ -1815,10 +2137,7 @@ func updateCarHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
 	fuelType := r.FormValue("fuelType")
 	gearType := r.FormValue("gearType")
@@ -1845,7 +2164,15 @@ func updateCarHandler(w http.ResponseWriter, r *http.Request) {
 		body = r.Body
 	}
 
-	err = adminService.UpdateCar(token.Value, carID, fuelType, gearType, carType, size, colour, seats, price, disabled, description, over25, body)
+	err = adminService.UpdateCar(user, carID, fuelType, gearType, carType, size, colour, seats, price, disabled, description, over25, body)
+	if imaging.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
 	if err != nil {
 		return
 	}
@@ -1853,13 +2180,13 @@ func updateCarHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
 
-func adminGetCarsHandler(w http.ResponseWriter, r *http.Request) {
+func getCarImagesHandler(w http.ResponseWriter, r *http.Request) {
 	enableCors(&w)
 	var err error
 
 	defer func() {
 		if err != nil {
-			log.Printf("adminGetCarsHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			log.Printf("getCarImagesHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
 			w.WriteHeader(http.StatusInternalServerError)
 		}
 	}()
@@ -1869,11 +2196,201 @@ func adminGetCarsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
+	user := authorisation.GetUser(r)
+
+	carID := r.FormValue("carID")
+
+	photos, err := adminService.GetCarImages(user, carID)
+	if adminService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&photos)
+	w.Write(buffer.Bytes())
+}
+
+// addCarImageHandler adds the image sent as the body as a photo of the car
+func addCarImageHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("addCarImageHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodPost {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	carID := r.FormValue("carID")
+	caption := r.FormValue("caption")
+	primary := r.FormValue("primary")
+
+	photo, err := adminService.AddCarImage(user, carID, caption, primary, r.Body)
+	if adminService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&photo)
+	w.Write(buffer.Bytes())
+}
+
+func updateCarImageHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("updateCarImageHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	imageID := r.FormValue("imageID")
+	caption := r.FormValue("caption")
+	primary := r.FormValue("primary")
+
+	err = adminService.UpdateCarImage(user, imageID, caption, primary)
+	if adminService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+// reorderCarImagesHandler orders the car's photos as listed in imageIDs, comma separated
+func reorderCarImagesHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("reorderCarImagesHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	carID := r.FormValue("carID")
+	imageIDs := r.FormValue("imageIDs")
+
+	err = adminService.ReorderCarImages(user, carID, imageIDs)
+	if adminService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func deleteCarImageHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("deleteCarImageHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	imageID := r.FormValue("imageID")
+
+	err = adminService.DeleteCarImage(user, imageID)
+	if adminService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
 	if err != nil {
 		return
 	}
 
+	w.WriteHeader(200)
+}
+
+func adminGetCarsHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("adminGetCarsHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
 	fuelTypes := r.FormValue("fuelTypes")
 	gearTypes := r.FormValue("gearTypes")
 	carTypes := r.FormValue("carTypes")
@@ -1881,7 +2398,7 @@ func adminGetCarsHandler(w http.ResponseWriter, r *http.Request) {
 	colours := r.FormValue("colours")
 	search := r.FormValue("search")
 
-	stats, err := adminService.GetCars(token.Value, fuelTypes, gearTypes, carTypes, carSizes, colours, search)
+	stats, err := adminService.GetCars(user, fuelTypes, gearTypes, carTypes, carSizes, colours, search)
 	if err != nil {
 		return
 	}
@@ -1908,12 +2425,9 @@ func getCarStatsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := r.Cookie("session-token")
-	if err != nil {
-		return
-	}
+	user := authorisation.GetUser(r)
 
-	stats, err := adminService.GetCarStats(token.Value)
+	stats, err := adminService.GetCarStats(user)
 	if err != nil {
 		return
 	}
@@ -1924,8 +2438,1205 @@ func getCarStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(buffer.Bytes())
 }
 
-func enableCors(w *http.ResponseWriter) {
-	//(*w).Header().Set("Access-Control-Allow-Origin", "*")
-	(*w).Header().Set("Access-Control-Allow-Credentials", "true")
-	(*w).Header().Set("Access-Control-Allow-Origin", "http://localhost:4200")
+func getAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getAuditLogHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	actorID := r.FormValue("actorID")
+	action := r.FormValue("action")
+	entityType := r.FormValue("entityType")
+	entityID := r.FormValue("entityID")
+	from := r.FormValue("from")
+	to := r.FormValue("to")
+	limit := r.FormValue("limit")
+
+	entries, err := auditService.GetEntries(user, actorID, action, entityType, entityID, from, to, limit)
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&entries)
+	w.Write(buffer.Bytes())
+}
+
+func exportAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("exportAuditLogHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	actorID := r.FormValue("actorID")
+	action := r.FormValue("action")
+	entityType := r.FormValue("entityType")
+	entityID := r.FormValue("entityID")
+	from := r.FormValue("from")
+	to := r.FormValue("to")
+
+	var buffer bytes.Buffer
+	err = auditService.ExportCSV(user, &buffer, actorID, action, entityType, entityID, from, to)
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"auditlog_"+strconv.FormatInt(time.Now().Unix(), 10)+".csv\"")
+	w.Write(buffer.Bytes())
+}
+
+func getErasureRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getErasureRequestsHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	status := r.FormValue("status")
+
+	requests, err := adminService.GetErasureRequests(user, status)
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&requests)
+	w.Write(buffer.Bytes())
+}
+
+func processErasureHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("processErasureHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	requestID := r.FormValue("requestID")
+	accept := r.FormValue("accept")
+	reason := r.FormValue("reason")
+	if requestID == "" || accept == "" {
+		err = errors.New("incorrect parameters")
+		return
+	}
+
+	err = adminService.ProcessErasure(user, requestID, accept, reason)
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func startImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("startImpersonationHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	userID := r.FormValue("userID")
+	minutes := r.FormValue("minutes")
+	readOnly := r.FormValue("readOnly")
+	if userID == "" {
+		err = errors.New("incorrect parameters")
+		return
+	}
+
+	impersonatedUser, err := adminService.StartImpersonation(user, userID, minutes, readOnly)
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&impersonatedUser)
+	w.Write(buffer.Bytes())
+}
+
+func createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("createAPIKeyHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	name := r.FormValue("name")
+	scopes := r.FormValue("scopes")
+	expiryDays := r.FormValue("expiryDays")
+	if name == "" || scopes == "" {
+		err = errors.New("incorrect parameters")
+		return
+	}
+
+	key, err := apiKeyService.Create(user, name, scopes, expiryDays)
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&key)
+	w.Write(buffer.Bytes())
+}
+
+func getAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getAPIKeysHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	keys, err := apiKeyService.GetAll(user)
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&keys)
+	w.Write(buffer.Bytes())
+}
+
+func revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("revokeAPIKeyHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	keyID := r.FormValue("keyID")
+	if keyID == "" {
+		err = errors.New("incorrect parameters")
+		return
+	}
+
+	err = apiKeyService.Revoke(user, keyID)
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func getOutboxStatusHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getOutboxStatusHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	status := r.FormValue("status")
+	limit := r.FormValue("limit")
+
+	outboxStatus, err := adminService.GetOutboxStatus(user, status, limit)
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&outboxStatus)
+	w.Write(buffer.Bytes())
+}
+
+func retryNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("retryNotificationHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	messageID := r.FormValue("messageID")
+	if messageID == "" {
+		err = errors.New("incorrect parameters")
+		return
+	}
+
+	err = adminService.RetryNotification(user, messageID)
+	if err != nil {
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+// getRegulatoryAlertsHandler lists alerts sent to regulators as JSON, or exports their reports with format=csv
+func getRegulatoryAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getRegulatoryAlertsHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	authority := r.FormValue("authority")
+	limit := r.FormValue("limit")
+
+	var buffer bytes.Buffer
+
+	if r.FormValue("format") == "csv" {
+		err = alertService.ExportCSV(user, &buffer, authority)
+		if err != nil {
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"alerts_"+strconv.FormatInt(time.Now().Unix(), 10)+".csv\"")
+		w.Write(buffer.Bytes())
+		return
+	}
+
+	alerts, err := alertService.GetAlerts(user, authority, limit)
+	if err != nil {
+		return
+	}
+
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&alerts)
+	w.Write(buffer.Bytes())
+}
+
+// getRegulatoryAlertHandler returns one alert as JSON, or its report as sent to the authority with format=csv
+func getRegulatoryAlertHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getRegulatoryAlertHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	alertID := r.FormValue("alertID")
+
+	var buffer bytes.Buffer
+
+	if r.FormValue("format") == "csv" {
+		err = alertService.ExportAlertCSV(user, &buffer, alertID)
+		if err != nil {
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"alert_"+alertID+".csv\"")
+		w.Write(buffer.Bytes())
+		return
+	}
+
+	alert, err := alertService.GetAlert(user, alertID)
+	if err != nil {
+		return
+	}
+
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&alert)
+	w.Write(buffer.Bytes())
+}
+
+func getDVLAStatusHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getDVLAStatusHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	status := adminService.GetDVLAStatus(user)
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&status)
+	w.Write(buffer.Bytes())
+}
+
+// uploadDatasetHandler validates the file in the request body as a new version of the dataset, without activating it
+func uploadDatasetHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("uploadDatasetHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodPost {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	dataset := r.FormValue("dataset")
+	name := r.FormValue("name")
+
+	datasetPreview, err := datasetService.Upload(user, dataset, name, r.Body)
+	if datasetService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&datasetPreview)
+	w.Write(buffer.Bytes())
+}
+
+func getDatasetImportsHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getDatasetImportsHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	dataset := r.FormValue("dataset")
+	limit := r.FormValue("limit")
+
+	datasetImports, err := datasetService.GetImports(user, dataset, limit)
+	if datasetService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&datasetImports)
+	w.Write(buffer.Bytes())
+}
+
+func previewDatasetHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("previewDatasetHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	importID := r.FormValue("importID")
+
+	datasetPreview, err := datasetService.Preview(user, importID)
+	if datasetService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&datasetPreview)
+	w.Write(buffer.Bytes())
+}
+
+func activateDatasetHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("activateDatasetHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	importID := r.FormValue("importID")
+
+	datasetImport, err := datasetService.Activate(user, importID)
+	if datasetService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&datasetImport)
+	w.Write(buffer.Bytes())
+}
+
+func rollbackDatasetHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("rollbackDatasetHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	dataset := r.FormValue("dataset")
+
+	datasetImport, err := datasetService.Rollback(user, dataset)
+	if datasetService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&datasetImport)
+	w.Write(buffer.Bytes())
+}
+
+func getDriverReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getDriverReviewsHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	status := r.FormValue("status")
+	driverID := r.FormValue("driverID")
+	limit := r.FormValue("limit")
+
+	reviews, err := reviewService.GetReviews(user, status, driverID, limit)
+	if reviewService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&reviews)
+	w.Write(buffer.Bytes())
+}
+
+func getDriverReviewHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getDriverReviewHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	reviewID := r.FormValue("reviewID")
+
+	review, err := reviewService.GetReview(user, reviewID)
+	if reviewService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&review)
+	w.Write(buffer.Bytes())
+}
+
+func resolveDriverReviewHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("resolveDriverReviewHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	reviewID := r.FormValue("reviewID")
+	decision := r.FormValue("decision")
+	reason := r.FormValue("reason")
+
+	review, err := reviewService.Resolve(user, reviewID, decision, reason)
+	if reviewService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&review)
+	w.Write(buffer.Bytes())
+}
+
+func removeDriverBlacklistHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("removeDriverBlacklistHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	driverID := r.FormValue("driverID")
+	reason := r.FormValue("reason")
+
+	review, err := reviewService.RemoveBlacklist(user, driverID, reason)
+	if reviewService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&review)
+	w.Write(buffer.Bytes())
+}
+
+func setPhoneHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("setPhoneHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	phone := r.FormValue("phone")
+
+	outputUser, err := userService.SetPhone(user, phone)
+	if err == userService.InvalidPhone {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&outputUser)
+	w.Write(buffer.Bytes())
+}
+
+func getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getNotificationPreferencesHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	preferences, err := notificationService.GetPreferences(user)
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&preferences)
+	w.Write(buffer.Bytes())
+}
+
+func setNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("setNotificationPreferencesHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	email := r.FormValue("email")
+	sms := r.FormValue("sms")
+	nonEssential := r.FormValue("nonEssential")
+	if email == "" || sms == "" || nonEssential == "" {
+		err = errors.New("incorrect parameters")
+		return
+	}
+
+	preferences, err := notificationService.SetPreferences(user, email, sms, nonEssential)
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&preferences)
+	w.Write(buffer.Bytes())
+}
+
+func unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("unsubscribeHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		err = errors.New("incorrect parameters")
+		return
+	}
+
+	err = notificationService.Unsubscribe(token)
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("You have been unsubscribed from optional messages. You will still receive messages needed for your bookings."))
+}
+
+func enableCors(w *http.ResponseWriter) {
+	//(*w).Header().Set("Access-Control-Allow-Origin", "*")
+	(*w).Header().Set("Access-Control-Allow-Credentials", "true")
+	(*w).Header().Set("Access-Control-Allow-Origin", "http://localhost:4200")
+}
+
+func getDocumentURLHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getDocumentURLHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	driverID := r.FormValue("driverID")
+	bookingID := r.FormValue("bookingID")
+	document := r.FormValue("document")
+
+	documentURL, err := adminService.GetDocumentURL(user, driverID, bookingID, document)
+	if err == adminService.UnknownDocument {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&documentURL)
+	w.Write(buffer.Bytes())
+}
+
+func getLegalHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getLegalHoldsHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	all := r.FormValue("all")
+	limit := r.FormValue("limit")
+
+	result, err := retentionService.GetHolds(user, all, limit)
+	if retentionService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&result)
+	w.Write(buffer.Bytes())
+}
+
+// placeLegalHoldHandler holds a user's, booking's or driver's files from retention purges, entityType is user, booking or driver
+func placeLegalHoldHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("placeLegalHoldHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	entityType := r.FormValue("entityType")
+	entityID := r.FormValue("entityID")
+	reason := r.FormValue("reason")
+
+	result, err := retentionService.PlaceHold(user, entityType, entityID, reason)
+	if retentionService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&result)
+	w.Write(buffer.Bytes())
+}
+
+func releaseLegalHoldHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("releaseLegalHoldHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	holdID := r.FormValue("holdID")
+	reason := r.FormValue("reason")
+
+	result, err := retentionService.ReleaseHold(user, holdID, reason)
+	if retentionService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&result)
+	w.Write(buffer.Bytes())
+}
+
+// purgeDocumentsHandler runs the retention purge now, with dryRun=true only reporting what it would remove
+func purgeDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("purgeDocumentsHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	dryRun := false
+	if r.FormValue("dryRun") != "" {
+		dryRun, err = strconv.ParseBool(r.FormValue("dryRun"))
+		if err != nil {
+			return
+		}
+	}
+
+	result, err := retentionService.Purge(user, dryRun)
+	if retentionService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&result)
+	w.Write(buffer.Bytes())
+}
+
+func getPurgeReportsHandler(w http.ResponseWriter, r *http.Request) {
+	enableCors(&w)
+	var err error
+
+	defer func() {
+		if err != nil {
+			log.Printf("getPurgeReportsHandler error - err: %v\nurl:%v\ncookies: %+v\n", err, r.URL, r.Cookies())
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}()
+
+	if r.Method != http.MethodGet {
+		err = errors.New("incorrect http method")
+		return
+	}
+
+	user := authorisation.GetUser(r)
+
+	limit := r.FormValue("limit")
+
+	result, err := retentionService.GetPurgeReports(user, limit)
+	if retentionService.IsUserError(err) {
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.Encode(response.New(err.Error()))
+		w.Write(buffer.Bytes())
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.Encode(&result)
+	w.Write(buffer.Bytes())
 }
@@ -0,0 +1,304 @@
+// mockIdP is a minimal OpenID Connect provider for trying out staff login locally.
+// It signs in whichever configured user is picked on its login page, no password is asked for.
+//
+//	go run ./mockIdP -users "admin@example.com:superadmins,clerk@example.com:clerks|fleet"
+//	go run . -oidc-issuer http://localhost:9000 -oidc-client-id carhire -oidc-groups "superadmins=superadmin,clerks=deskClerk"
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	keyID      = "mock"
+	codeExpiry = time.Minute
+)
+
+type user struct {
+	Email  string
+	Groups []string
+}
+
+type authCode struct {
+	user        user
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	expires     time.Time
+}
+
+var (
+	issuer   *string
+	clientID *string
+
+	key   *rsa.PrivateKey
+	users []user
+
+	codesLock sync.Mutex
+	codes     = make(map[string]*authCode)
+
+	loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><body>
+<h1>Mock identity provider</h1>
+{{range .Users}}<form method="get" action="/authorize">
+{{range $name, $values := $.Query}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">{{end}}{{end}}
+<input type="hidden" name="login" value="{{.Email}}">
+<button type="submit">Sign in as {{.Email}} ({{range $i, $g := .Groups}}{{if $i}}, {{end}}{{$g}}{{end}})</button>
+</form>{{end}}
+</body></html>`))
+)
+
+func main() {
+	var err error
+
+	port := flag.String("port", "9000", "the port the mock provider will run on")
+	issuer = flag.String("issuer", "http://localhost:9000", "the issuer URL, must match how the site reaches this server")
+	clientID = flag.String("client-id", "carhire", "the only client ID accepted")
+	userList := flag.String("users", "admin@example.com:superadmins", "comma separated email:group|group users offered on the login page")
+
+	flag.Parse()
+
+	users, err = parseUsers(*userList)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.HandleFunc("/.well-known/openid-configuration", discoveryHandler)
+	http.HandleFunc("/jwks", jwksHandler)
+	http.HandleFunc("/authorize", authorizeHandler)
+	http.HandleFunc("/token", tokenHandler)
+
+	fmt.Println("Mock identity provider listening on " + *port)
+	log.Fatal(http.ListenAndServe(":"+*port, nil))
+}
+
+func parseUsers(list string) ([]user, error) {
+	parsed := make([]user, 0)
+
+	for _, entry := range strings.Split(list, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if parts[0] == "" {
+			continue
+		}
+
+		u := user{Email: parts[0], Groups: []string{}}
+		if len(parts) == 2 && parts[1] != "" {
+			u.Groups = strings.Split(parts[1], "|")
+		}
+
+		parsed = append(parsed, u)
+	}
+
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("no users configured")
+	}
+
+	return parsed, nil
+}
+
+func discoveryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                *issuer,
+		"authorization_endpoint":                *issuer + "/authorize",
+		"token_endpoint":                        *issuer + "/token",
+		"jwks_uri":                              *issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func jwksHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorizeHandler shows the login page, then once a user is picked redirects back to the client with a code
+func authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("response_type") != "code" || query.Get("client_id") != *clientID || query.Get("redirect_uri") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	login := query.Get("login")
+	if login == "" {
+		query.Del("login")
+		loginPage.Execute(w, map[string]interface{}{"Users": users, "Query": query})
+		return
+	}
+
+	var chosen *user
+	for i := range users {
+		if users[i].Email == login {
+			chosen = &users[i]
+		}
+	}
+	if chosen == nil {
+		http.Error(w, "unknown user", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+
+	codesLock.Lock()
+	codes[code] = &authCode{
+		user:        *chosen,
+		clientID:    query.Get("client_id"),
+		redirectURI: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		expires:     time.Now().Add(codeExpiry),
+	}
+	codesLock.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// tokenHandler exchanges a code for a signed ID token after checking the PKCE verifier
+func tokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost || r.FormValue("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	requestClientID := r.FormValue("client_id")
+	if basicID, _, ok := r.BasicAuth(); ok {
+		requestClientID, _ = url.QueryUnescape(basicID)
+	}
+
+	codesLock.Lock()
+	code, ok := codes[r.FormValue("code")]
+	delete(codes, r.FormValue("code"))
+	codesLock.Unlock()
+
+	if !ok || time.Now().After(code.expires) || code.clientID != requestClientID || code.redirectURI != r.FormValue("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != code.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	names := strings.SplitN(strings.Split(code.user.Email, "@")[0], ".", 2)
+	familyName := ""
+	if len(names) == 2 {
+		familyName = names[1]
+	}
+
+	idToken, err := sign(map[string]interface{}{
+		"iss":            *issuer,
+		"sub":            code.user.Email,
+		"aud":            code.clientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          code.nonce,
+		"email":          code.user.Email,
+		"email_verified": true,
+		"given_name":     names[0],
+		"family_name":    familyName,
+		"groups":         code.user.Groups,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func sign(claims map[string]interface{}) (string, error) {
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,282 @@
+// mockS3 is a local S3 stand-in for checking the s3 storage backend. It serves path style buckets from
+// directories, accepts any credentials without checking signatures, and refuses presigned URLs once expired.
+// Buckets are created on start. Object metadata is kept beside each file in a .meta file.
+//
+//	go run ./mockS3 -port 9000 -dir ./mockS3/data -bucket banger
+//	go run . -storage s3 -storage-s3-endpoint http://localhost:9000 -storage-s3-bucket banger
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const metaSuffix = ".meta"
+
+var dir *string
+
+type listResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	KeyCount              int            `xml:"KeyCount"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	Contents              []listContents `xml:"Contents"`
+}
+
+type listContents struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+func main() {
+
+	port := flag.String("port", "9000", "the port the mock S3 server will run on")
+	dir = flag.String("dir", "./data/", "the directory buckets are kept in")
+	buckets := flag.String("bucket", "banger", "comma separated buckets to create")
+
+	flag.Parse()
+
+	for _, bucket := range strings.Split(*buckets, ",") {
+		err := os.MkdirAll(filepath.Join(*dir, bucket), 0755)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	http.HandleFunc("/", handler)
+
+	fmt.Println("Mock S3 server listening on " + *port)
+
+	log.Fatal(http.ListenAndServe(":"+*port, nil))
+}
+
+func handler(w http.ResponseWriter, r *http.Request) {
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	key := ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+
+	if bucket == "" || strings.Contains(bucket, "..") || strings.Contains(key, "..") || strings.HasSuffix(key, metaSuffix) {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "invalid bucket or key")
+		return
+	}
+
+	bucketDir := filepath.Join(*dir, bucket)
+	if fi, err := os.Stat(bucketDir); err != nil || !fi.IsDir() {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "the bucket does not exist")
+		return
+	}
+
+	if expired(r) {
+		writeError(w, http.StatusForbidden, "AccessDenied", "request has expired")
+		return
+	}
+
+	log.Printf("%v /%v/%v", r.Method, bucket, key)
+
+	if key == "" {
+		switch r.Method {
+		case http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case http.MethodGet:
+			list(w, r, bucket, bucketDir)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "unsupported bucket method")
+		}
+		return
+	}
+
+	name := filepath.Join(bucketDir, filepath.FromSlash(key))
+
+	switch r.Method {
+	case http.MethodPut:
+		put(w, r, name)
+	case http.MethodGet, http.MethodHead:
+		get(w, r, name)
+	case http.MethodDelete:
+		os.Remove(name)
+		os.Remove(name + metaSuffix)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "unsupported object method")
+	}
+}
+
+// expired checks the X-Amz-Date and X-Amz-Expires of presigned URLs
+func expired(r *http.Request) bool {
+
+	query := r.URL.Query()
+	if query.Get("X-Amz-Expires") == "" {
+		return false
+	}
+
+	signed, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return true
+	}
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return true
+	}
+
+	return time.Now().After(signed.Add(time.Duration(seconds) * time.Second))
+}
+
+func put(w http.ResponseWriter, r *http.Request, name string) {
+
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	meta := make(map[string]string)
+	for header, values := range r.Header {
+		if strings.HasPrefix(strings.ToLower(header), "x-amz-meta-") {
+			meta[header] = values[0]
+		}
+	}
+	meta["Content-Type"] = r.Header.Get("Content-Type")
+
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	err = ioutil.WriteFile(name, content, 0644)
+	if err == nil {
+		err = ioutil.WriteFile(name+metaSuffix, metaJSON, 0644)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func get(w http.ResponseWriter, r *http.Request, name string) {
+
+	file, err := os.Open(name)
+	if err != nil {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeError(w, http.StatusNotFound, "NoSuchKey", "the key does not exist")
+		return
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil || fi.IsDir() {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "the key does not exist")
+		return
+	}
+
+	meta := make(map[string]string)
+	metaJSON, err := ioutil.ReadFile(name + metaSuffix)
+	if err == nil {
+		json.Unmarshal(metaJSON, &meta)
+	}
+	for header, value := range meta {
+		if value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	w.Header().Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodGet {
+		io.Copy(w, file)
+	}
+}
+
+// list implements ListObjectsV2, continuation tokens are the last key of the previous page
+func list(w http.ResponseWriter, r *http.Request, bucket, bucketDir string) {
+
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	after := query.Get("continuation-token")
+
+	maxKeys := 1000
+	if value, err := strconv.Atoi(query.Get("max-keys")); err == nil && value > 0 && value < maxKeys {
+		maxKeys = value
+	}
+
+	keys := make([]listContents, 0)
+	filepath.Walk(bucketDir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || strings.HasSuffix(name, metaSuffix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(bucketDir, name)
+		if err != nil {
+			return nil
+		}
+
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, listContents{Key: key, Size: fi.Size(), LastModified: fi.ModTime().UTC()})
+		}
+		return nil
+	})
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Key < keys[j].Key
+	})
+
+	result := listResult{Name: bucket, Prefix: prefix, MaxKeys: maxKeys}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1].Key
+	}
+	result.Contents = keys
+	result.KeyCount = len(keys)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(result)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
@@ -0,0 +1,142 @@
+// mockSMTP is a local SMTP stand-in for checking notification delivery. It accepts every message,
+// any credentials, and writes what it receives to a directory.
+//
+//	go run ./mockSMTP -port 2525 -dir ./mockSMTP/received
+//	go run . -notifier smtp -smtp-address localhost:2525
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func main() {
+
+	port := flag.String("port", "2525", "the port the mock SMTP server will run on")
+	dir := flag.String("dir", "./received/", "the directory received messages are written to")
+
+	flag.Parse()
+
+	err := os.MkdirAll(*dir, 0755)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", ":"+*port)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("Mock SMTP server listening on " + *port)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		go handle(conn, *dir)
+	}
+}
+
+func handle(conn net.Conn, dir string) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	reply := func(code int, message string) {
+		text.PrintfLine("%d %s", code, message)
+	}
+
+	var from string
+	var to []string
+
+	reply(220, "mockSMTP ready")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			text.PrintfLine("250-mockSMTP")
+			text.PrintfLine("250-8BITMIME")
+			reply(250, "AUTH PLAIN LOGIN")
+		case "HELO":
+			reply(250, "mockSMTP")
+		case "AUTH":
+			reply(235, "authenticated")
+		case "MAIL":
+			from = addressArgument(line)
+			to = nil
+			reply(250, "ok")
+		case "RCPT":
+			to = append(to, addressArgument(line))
+			reply(250, "ok")
+		case "DATA":
+			if from == "" || len(to) == 0 {
+				reply(503, "need MAIL and RCPT first")
+				continue
+			}
+
+			reply(354, "end data with <CR><LF>.<CR><LF>")
+
+			body, err := ioutil.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+
+			name, err := save(dir, from, to, body)
+			if err != nil {
+				log.Println(err)
+				reply(451, "failed to store message")
+				continue
+			}
+
+			log.Printf("Received message from %v to %v, saved to %v", from, strings.Join(to, ", "), name)
+			from, to = "", nil
+			reply(250, "queued")
+		case "RSET":
+			from, to = "", nil
+			reply(250, "ok")
+		case "NOOP":
+			reply(250, "ok")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+func addressArgument(line string) string {
+	start := strings.Index(line, "<")
+	end := strings.LastIndex(line, ">")
+	if start == -1 || end < start {
+		return ""
+	}
+
+	return line[start+1 : end]
+}
+
+func save(dir, from string, to []string, body []byte) (string, error) {
+
+	name := filepath.Join(dir, strconv.FormatInt(time.Now().UnixNano(), 10)+".eml")
+
+	envelope := "X-Envelope-From: " + from + "\r\nX-Envelope-To: " + strings.Join(to, ", ") + "\r\n"
+
+	return name, ioutil.WriteFile(name, append([]byte(envelope), body...), 0644)
+}
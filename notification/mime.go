@@ -0,0 +1,210 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// InvalidHeader is returned for a message whose addresses don't parse or whose headers would span lines,
+// which could otherwise add headers or a body of the sender's choosing
+var InvalidHeader = &PermanentError{Err: errors.New("invalid message header")}
+
+func formatAddress(name, address string) string {
+	if name == "" {
+		return address
+	}
+
+	return (&mail.Address{Name: name, Address: address}).String()
+}
+
+// Bytes encodes the message as MIME, multipart/alternative when it has an HTML part and wrapped in
+// multipart/mixed when it has attachments
+func (m *Message) Bytes() ([]byte, error) {
+	var buffer bytes.Buffer
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, InvalidHeader
+	}
+
+	to := make([]string, 0, len(m.To))
+	for _, recipient := range m.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, InvalidHeader
+		}
+		to = append(to, address.String())
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", from.String())
+	header.Set("To", strings.Join(to, ", "))
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header.Set("Date", m.Created.Format(time.RFC1123Z))
+	header.Set("MIME-Version", "1.0")
+	if m.Reference != "" {
+		header.Set("X-Reference", mime.QEncoding.Encode("utf-8", m.Reference))
+	}
+
+	bodyHeader, body, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.Attachments) == 0 {
+		for key, values := range bodyHeader {
+			header[key] = values
+		}
+		err = writeHeader(&buffer, header)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(body)
+
+		return buffer.Bytes(), nil
+	}
+
+	var mixed bytes.Buffer
+	writer := multipart.NewWriter(&mixed)
+
+	header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	err = writeHeader(&buffer, header)
+	if err != nil {
+		return nil, err
+	}
+
+	partWriter, err := writer.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = partWriter.Write(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range m.Attachments {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = partWriter.Write(encodeBase64Lines(attachment.Content))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	buffer.Write(mixed.Bytes())
+
+	return buffer.Bytes(), nil
+}
+
+// body encodes the text, and the HTML if there is any, returning the content headers separately so
+// the body can be sent on its own or as the first part of a multipart/mixed message
+func (m *Message) body() (textproto.MIMEHeader, []byte, error) {
+	var buffer bytes.Buffer
+
+	if m.HTML == "" {
+		err := writeQuotedPrintable(&buffer, m.Text)
+
+		return textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, buffer.Bytes(), err
+	}
+
+	writer := multipart.NewWriter(&buffer)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var encoded bytes.Buffer
+		err = writeQuotedPrintable(&encoded, part.content)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		_, err = partWriter.Write(encoded.Bytes())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + writer.Boundary()},
+	}, buffer.Bytes(), nil
+}
+
+// writeHeader writes the message header, refusing any value with a line break in it
+func writeHeader(buffer *bytes.Buffer, header textproto.MIMEHeader) error {
+	for _, key := range []string{"From", "To", "Subject", "Date", "MIME-Version", "X-Reference", "Content-Type", "Content-Transfer-Encoding"} {
+		value := header.Get(key)
+		if strings.ContainsAny(value, "\r\n") {
+			return InvalidHeader
+		}
+		if value != "" {
+			fmt.Fprintf(buffer, "%s: %s\r\n", key, value)
+		}
+	}
+	buffer.WriteString("\r\n")
+
+	return nil
+}
+
+// encodeBase64Lines encodes content as base64 split into 76 character lines
+func encodeBase64Lines(content []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(content)
+
+	var buffer bytes.Buffer
+	for len(encoded) > 76 {
+		buffer.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buffer.WriteString(encoded + "\r\n")
+
+	return buffer.Bytes()
+}
+
+func writeQuotedPrintable(buffer *bytes.Buffer, content string) error {
+	writer := quotedprintable.NewWriter(buffer)
+
+	_, err := writer.Write([]byte(content))
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
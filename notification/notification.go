@@ -0,0 +1,167 @@
+package notification
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Settings, set from command line flags in main before InitNotifier is called
+var (
+	// Kind selects the Notifier, one of smtp, file or log
+	Kind        *string
+	TemplateDir *string
+	DropDir     *string
+
+	SMTPAddress  *string
+	SMTPUser     *string
+	SMTPPassword *string
+
+	FromName         *string
+	FromAddress      *string
+	CompanyName      *string
+	CompanyReference *string
+	Branch           *string
+	BranchAddress    *string
+	BranchPhone      *string
+	// SiteURL is prefixed to links in messages
+	SiteURL *string
+)
+
+var (
+	UnknownNotifier = errors.New("unknown notifier")
+	UnknownTemplate = errors.New("unknown template")
+
+	notifier  Notifier
+	templates map[string]*messageTemplate
+)
+
+// Notifier delivers a rendered message
+type Notifier interface {
+	Send(message *Message) error
+}
+
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Message is a rendered notification. HTML is optional, Text is always sent and is the whole of an SMS
+type Message struct {
+	Channel   string
+	From      string
+	To        []string
+	Subject   string
+	Text      string
+	HTML      string
+	Template  string
+	Reference string
+	Created   time.Time
+	// Attachments are added to emails after the text and HTML
+	Attachments []Attachment
+}
+
+// Attachment is a file sent with an email, such as a machine readable copy of a report
+type Attachment struct {
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
+// Sender is the company the notifications are sent on behalf of, available to templates as .Sender
+type Sender struct {
+	Name      string
+	Address   string
+	Company   string
+	Reference string
+	Branch    string
+	// BranchAddress and BranchPhone are the branch contact details given to regulators
+	BranchAddress string
+	BranchPhone   string
+}
+
+// InitNotifier loads the templates and creates the configured Notifier
+func InitNotifier() error {
+	var err error
+
+	templates, err = loadTemplates(*TemplateDir)
+	if err != nil {
+		return err
+	}
+
+	switch *Kind {
+	case "smtp":
+		notifier = &smtpNotifier{address: *SMTPAddress, user: *SMTPUser, password: *SMTPPassword}
+	case "file":
+		notifier = &fileNotifier{dir: *DropDir}
+	case "log":
+		notifier = &logNotifier{}
+	default:
+		return UnknownNotifier
+	}
+
+	err = initSMS()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Notifications sent using %v, SMS using %v, %v templates loaded", *Kind, *SMSKind, len(templates))
+
+	return nil
+}
+
+func GetSender() *Sender {
+	return &Sender{
+		Name:      *FromName,
+		Address:   *FromAddress,
+		Company:   *CompanyName,
+		Reference: *CompanyReference,
+		Branch:    *Branch,
+
+		BranchAddress: *BranchAddress,
+		BranchPhone:   *BranchPhone,
+	}
+}
+
+// Render fills in the named template. values is available to the template as .Data
+func Render(templateName, reference string, to []string, values interface{}) (*Message, error) {
+
+	tmpl, ok := templates[templateName]
+	if !ok {
+		return nil, UnknownTemplate
+	}
+
+	return tmpl.render(GetSender(), reference, to, values)
+}
+
+// RenderSMS fills in the SMS version of the named template, see HasSMS
+func RenderSMS(templateName, reference, to string, values interface{}) (*Message, error) {
+
+	tmpl, ok := templates[templateName]
+	if !ok || tmpl.sms == nil {
+		return nil, UnknownTemplate
+	}
+
+	return tmpl.renderSMS(GetSender(), reference, to, values)
+}
+
+// HasSMS reports whether the named template has an SMS version
+func HasSMS(templateName string) bool {
+	tmpl, ok := templates[templateName]
+	return ok && tmpl.sms != nil
+}
+
+// Send renders the named template and delivers it with the configured Notifier
+func Send(templateName, reference string, to []string, values interface{}) error {
+
+	if notifier == nil {
+		return UnknownNotifier
+	}
+
+	message, err := Render(templateName, reference, to, values)
+	if err != nil {
+		return err
+	}
+
+	return notifier.Send(message)
+}
@@ -0,0 +1,98 @@
+package notification
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// smtpNotifier delivers messages through an SMTP server, authenticating when a user is set
+type smtpNotifier struct {
+	address  string
+	user     string
+	password string
+}
+
+func (sn *smtpNotifier) Send(message *Message) error {
+
+	if len(message.To) == 0 {
+		return errors.New("message has no recipients")
+	}
+
+	from, err := mail.ParseAddress(message.From)
+	if err != nil {
+		return err
+	}
+
+	body, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if sn.user != "" {
+		host, _, err := net.SplitHostPort(sn.address)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", sn.user, sn.password, host)
+	}
+
+	return smtp.SendMail(sn.address, auth, from.Address, message.To, body)
+}
+
+// fileNotifier writes each message to the drop directory as an .eml file
+type fileNotifier struct {
+	dir string
+}
+
+func (fn *fileNotifier) Send(message *Message) error {
+
+	body, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(fn.dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	name := message.Template
+	if message.Reference != "" {
+		name = message.Reference + "_" + name
+	}
+	name = SafeFileName(name) + "_" + strconv.FormatInt(message.Created.UnixNano(), 10) + ".eml"
+
+	return ioutil.WriteFile(filepath.Join(fn.dir, name), body, 0644)
+}
+
+// SafeFileName replaces anything but letters, digits, - and _ in name, as the file notifier does for the
+// reference and template a message is saved under
+func SafeFileName(name string) string {
+	return strings.Map(safeFileRune, name)
+}
+
+func safeFileRune(r rune) rune {
+	if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+		return r
+	}
+
+	return '_'
+}
+
+// logNotifier only logs messages, for development
+type logNotifier struct{}
+
+func (ln *logNotifier) Send(message *Message) error {
+	log.Printf("Notification %v to %v\nSubject: %v\n%v", message.Template, strings.Join(message.To, ", "), message.Subject, message.Text)
+
+	return nil
+}
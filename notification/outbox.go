@@ -0,0 +1,248 @@
+package notification
+
+import (
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/textproto"
+	"time"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSending = "sending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+
+	maxAttempts  = 8
+	firstBackoff = 30 * time.Second
+	maxBackoff   = time.Hour
+	batchSize    = 20
+
+	rateLimitWait = time.Minute
+
+	//sendLease is how long a claimed message can stay sending before it's put back in the queue
+	sendLease = 10 * time.Minute
+)
+
+// OutboxInterval is how often the worker checks for due messages, set from flags in main
+var OutboxInterval *time.Duration
+
+// Enqueue renders the named template into the outbox for the worker to email. A message is only
+// queued once per key, later calls with the same key return the original message ID
+func Enqueue(key, templateName, reference string, to []string, values interface{}) (int, error) {
+
+	message, err := Render(templateName, reference, to, values)
+	if err != nil {
+		return 0, err
+	}
+
+	return enqueue(key, message)
+}
+
+// EnqueueWithAttachments is Enqueue for emails sent with files attached
+func EnqueueWithAttachments(key, templateName, reference string, to []string, values interface{}, attachments []Attachment) (int, error) {
+
+	message, err := Render(templateName, reference, to, values)
+	if err != nil {
+		return 0, err
+	}
+	message.Attachments = attachments
+
+	return enqueue(key, message)
+}
+
+// EnqueueSMS renders the SMS version of the named template into the outbox for the worker to text to phone
+func EnqueueSMS(key, templateName, reference, phone string, values interface{}) (int, error) {
+
+	message, err := RenderSMS(templateName, reference, phone, values)
+	if err != nil {
+		return 0, err
+	}
+
+	return enqueue(key, message)
+}
+
+func enqueue(key string, message *Message) (int, error) {
+
+	if key == "" {
+		return 0, errors.New("idempotency key required")
+	}
+
+	attachments := ""
+	if len(message.Attachments) > 0 {
+		encoded, err := json.Marshal(message.Attachments)
+		if err != nil {
+			return 0, err
+		}
+		attachments = string(encoded)
+	}
+
+	messageID, _, err := db.InsertOutboxMessage(&data.OutboxMessage{
+		IdempotencyKey: key,
+		Channel:        message.Channel,
+		Template:       message.Template,
+		Reference:      message.Reference,
+		From:           message.From,
+		To:             message.To,
+		Subject:        message.Subject,
+		Text:           message.Text,
+		HTML:           message.HTML,
+		Attachments:    attachments,
+	})
+
+	return messageID, err
+}
+
+// StartWorker delivers queued messages in the background until the process exits
+func StartWorker() error {
+
+	err := db.ResetSendingOutboxMessages()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			err := deliverDue()
+			if err != nil {
+				log.Printf("outbox worker error - err: %v", err)
+			}
+
+			time.Sleep(*OutboxInterval)
+		}
+	}()
+
+	return nil
+}
+
+// deliverDue sends the batch of due messages. An error with one message is logged and the rest still sent,
+// a message left sending by it is requeued once its claim lapses
+func deliverDue() error {
+
+	requeued, err := db.RequeueExpiredOutboxMessages()
+	if err != nil {
+		return err
+	}
+	if requeued > 0 {
+		log.Printf("outbox worker requeued %v messages left sending", requeued)
+	}
+
+	messages, err := db.GetDueOutboxMessages(batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, queued := range messages {
+
+		claimed, err := db.ClaimOutboxMessage(queued.ID, time.Now().Add(sendLease))
+		if err != nil {
+			log.Printf("outbox worker failed to claim message %v - err: %v", queued.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		err = deliver(queued)
+		if err != nil {
+			log.Printf("outbox worker failed to record delivery of message %v - err: %v", queued.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func deliver(queued *data.OutboxMessage) error {
+
+	attempts := queued.Attempts + 1
+
+	var attachments []Attachment
+	if queued.Attachments != "" {
+		err := json.Unmarshal([]byte(queued.Attachments), &attachments)
+		if err != nil {
+			return db.SetOutboxMessageFailed(queued.ID, attempts, OutboxFailed, err.Error(), time.Now())
+		}
+	}
+
+	var sendErr error
+	if queued.Channel == ChannelSMS {
+		sendErr = sendSMS(queued.To[0], queued.Text)
+	} else {
+		sendErr = notifier.Send(&Message{
+			Channel:   queued.Channel,
+			From:      queued.From,
+			To:        queued.To,
+			Subject:   queued.Subject,
+			Text:      queued.Text,
+			HTML:      queued.HTML,
+			Template:  queued.Template,
+			Reference: queued.Reference,
+			Created:   queued.Created.Time,
+
+			Attachments: attachments,
+		})
+	}
+	if sendErr == nil {
+		return db.SetOutboxMessageSent(queued.ID, attempts)
+	}
+
+	//Held back by the rate limit, so try again shortly without counting it as a failed attempt
+	if sendErr == RateLimited {
+		return db.SetOutboxMessageFailed(queued.ID, queued.Attempts, OutboxPending, sendErr.Error(), time.Now().Add(rateLimitWait))
+	}
+
+	if permanent(sendErr) || attempts >= maxAttempts {
+		log.Printf("outbox message %v failed permanently after %v attempts - err: %v", queued.ID, attempts, sendErr)
+		return db.SetOutboxMessageFailed(queued.ID, attempts, OutboxFailed, sendErr.Error(), time.Now())
+	}
+
+	return db.SetOutboxMessageFailed(queued.ID, attempts, OutboxPending, sendErr.Error(), time.Now().Add(backoff(attempts)))
+}
+
+// backoff doubles the wait after each failed attempt
+func backoff(attempts int) time.Duration {
+	wait := firstBackoff << uint(attempts-1)
+	if wait > maxBackoff || wait <= 0 {
+		return maxBackoff
+	}
+
+	return wait
+}
+
+// permanent reports whether retrying can't help, such as an SMTP server rejecting a recipient
+func permanent(err error) bool {
+	var permanentError *PermanentError
+	if errors.As(err, &permanentError) || err == SMSDisabled {
+		return true
+	}
+
+	var protocolError *textproto.Error
+	if errors.As(err, &protocolError) {
+		return protocolError.Code >= 500
+	}
+
+	return false
+}
+
+// GetOutboxStatus returns the number of messages in each state and the latest messages, optionally of one status
+func GetOutboxStatus(status string, limit int) (*data.OutboxStatus, error) {
+
+	counts, err := db.GetOutboxCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := db.GetOutboxMessages(status, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.OutboxStatus{Counts: counts, Messages: messages}, nil
+}
+
+func Retry(messageID int) error {
+	return db.RetryOutboxMessage(messageID)
+}
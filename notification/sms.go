@@ -0,0 +1,242 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SMS settings, set from command line flags in main before InitNotifier is called
+var (
+	// SMSKind selects the SMSProvider, one of gateway, fake or none
+	SMSKind       *string
+	SMSGatewayURL *string
+	SMSGatewayKey *string
+	SMSFrom       *string
+	// Limits on messages sent to one number per hour and to everyone per minute
+	SMSRecipientLimit *int
+	SMSGlobalLimit    *int
+)
+
+var (
+	UnknownSMSProvider = errors.New("unknown sms provider")
+	SMSDisabled        = errors.New("sms is not configured")
+	RateLimited        = errors.New("sms rate limit reached")
+
+	smsProvider SMSProvider
+	smsLimiter  *rateLimiter
+)
+
+// SMSProvider delivers a text message to an E.164 phone number
+type SMSProvider interface {
+	SendSMS(from, to, body string) error
+}
+
+// PermanentError marks a failure retrying can't fix, such as a provider rejecting the number
+type PermanentError struct {
+	Err error
+}
+
+func (pe *PermanentError) Error() string {
+	return pe.Err.Error()
+}
+
+func (pe *PermanentError) Unwrap() error {
+	return pe.Err
+}
+
+func initSMS() error {
+
+	switch *SMSKind {
+	case "gateway":
+		smsProvider = &gatewayProvider{url: *SMSGatewayURL, key: *SMSGatewayKey, client: &http.Client{Timeout: 10 * time.Second}}
+	case "fake":
+		smsProvider = Fake
+	case "none", "":
+		smsProvider = nil
+	default:
+		return UnknownSMSProvider
+	}
+
+	smsLimiter = newRateLimiter(*SMSRecipientLimit, *SMSGlobalLimit)
+
+	return nil
+}
+
+// SMSEnabled reports whether an SMS provider is configured
+func SMSEnabled() bool {
+	return smsProvider != nil
+}
+
+// sendSMS delivers through the provider, or returns RateLimited without sending
+func sendSMS(to, body string) error {
+
+	if smsProvider == nil {
+		return SMSDisabled
+	}
+
+	if !smsLimiter.allow(to, time.Now()) {
+		return RateLimited
+	}
+
+	return smsProvider.SendSMS(*SMSFrom, to, body)
+}
+
+// gatewayProvider posts each message as JSON to an HTTP SMS gateway
+type gatewayProvider struct {
+	url    string
+	key    string
+	client *http.Client
+}
+
+type gatewayRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Body string `json:"body"`
+}
+
+func (gp *gatewayProvider) SendSMS(from, to, body string) error {
+
+	payload, err := json.Marshal(&gatewayRequest{From: from, To: to, Body: body})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, gp.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if gp.key != "" {
+		request.Header.Set("Authorization", "Bearer "+gp.key)
+	}
+
+	response, err := gp.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 512))
+	err = fmt.Errorf("sms gateway returned %v: %s", response.Status, message)
+
+	//Rate limiting and gateway faults can be retried, anything else the gateway rejected won't succeed later
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return err
+	}
+
+	return &PermanentError{Err: err}
+}
+
+// FakeSMS records messages instead of sending them, for development and tests
+type FakeSMS struct {
+	sync.Mutex
+	sent []FakeMessage
+	// Fail is returned by SendSMS when set
+	Fail error
+}
+
+type FakeMessage struct {
+	From string
+	To   string
+	Body string
+	Sent time.Time
+}
+
+// Fake is the provider used when SMSKind is fake
+var Fake = &FakeSMS{}
+
+func (fs *FakeSMS) SendSMS(from, to, body string) error {
+	fs.Lock()
+	defer fs.Unlock()
+
+	if fs.Fail != nil {
+		return fs.Fail
+	}
+
+	fs.sent = append(fs.sent, FakeMessage{From: from, To: to, Body: body, Sent: time.Now()})
+	log.Printf("Fake SMS from %v to %v\n%v", from, to, body)
+
+	return nil
+}
+
+// Sent returns a copy of every message sent so far
+func (fs *FakeSMS) Sent() []FakeMessage {
+	fs.Lock()
+	defer fs.Unlock()
+
+	sent := make([]FakeMessage, len(fs.sent))
+	copy(sent, fs.sent)
+
+	return sent
+}
+
+func (fs *FakeSMS) Reset() {
+	fs.Lock()
+	fs.sent = nil
+	fs.Fail = nil
+	fs.Unlock()
+}
+
+// rateLimiter keeps sliding windows of send times per recipient over an hour and overall over a minute
+type rateLimiter struct {
+	sync.Mutex
+	recipientLimit int
+	globalLimit    int
+	recipients     map[string][]time.Time
+	global         []time.Time
+}
+
+func newRateLimiter(recipientLimit, globalLimit int) *rateLimiter {
+	return &rateLimiter{
+		recipientLimit: recipientLimit,
+		globalLimit:    globalLimit,
+		recipients:     make(map[string][]time.Time),
+	}
+}
+
+// allow records a send and returns true if neither limit has been reached, a limit of 0 is unlimited
+func (rl *rateLimiter) allow(to string, now time.Time) bool {
+	rl.Lock()
+	defer rl.Unlock()
+
+	rl.global = prune(rl.global, now.Add(-time.Minute))
+	for recipient, times := range rl.recipients {
+		rl.recipients[recipient] = prune(times, now.Add(-time.Hour))
+		if len(rl.recipients[recipient]) == 0 {
+			delete(rl.recipients, recipient)
+		}
+	}
+
+	if rl.globalLimit > 0 && len(rl.global) >= rl.globalLimit {
+		return false
+	}
+	if rl.recipientLimit > 0 && len(rl.recipients[to]) >= rl.recipientLimit {
+		return false
+	}
+
+	rl.global = append(rl.global, now)
+	rl.recipients[to] = append(rl.recipients[to], now)
+
+	return true
+}
+
+func prune(times []time.Time, after time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(after) {
+		i++
+	}
+
+	return times[i:]
+}
@@ -0,0 +1,143 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRecipient(t *testing.T) {
+
+	rl := newRateLimiter(2, 0)
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if !rl.allow("+447700900001", now) || !rl.allow("+447700900001", now.Add(time.Minute)) {
+		t.Fatal("sends under the recipient limit refused")
+	}
+	if rl.allow("+447700900001", now.Add(2*time.Minute)) {
+		t.Error("third send within the hour allowed")
+	}
+	if !rl.allow("+447700900002", now.Add(2*time.Minute)) {
+		t.Error("another recipient limited")
+	}
+
+	//The first send leaves the window an hour after it was made
+	if rl.allow("+447700900001", now.Add(time.Hour-time.Second)) {
+		t.Error("send allowed before the first left the window")
+	}
+	if !rl.allow("+447700900001", now.Add(time.Hour)) {
+		t.Error("send refused after the first left the window")
+	}
+}
+
+func TestRateLimiterGlobal(t *testing.T) {
+
+	rl := newRateLimiter(0, 3)
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		if !rl.allow("+447700900001", now) {
+			t.Fatalf("send %v under the global limit refused", i+1)
+		}
+	}
+	if rl.allow("+447700900002", now.Add(30*time.Second)) {
+		t.Error("send over the global limit allowed")
+	}
+	if !rl.allow("+447700900002", now.Add(time.Minute)) {
+		t.Error("send refused after the minute passed")
+	}
+}
+
+func TestRateLimiterRefusedNotCounted(t *testing.T) {
+
+	rl := newRateLimiter(1, 0)
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	rl.allow("+447700900001", now)
+	for i := 1; i < 10; i++ {
+		rl.allow("+447700900001", now.Add(time.Duration(i)*time.Minute))
+	}
+
+	if !rl.allow("+447700900001", now.Add(time.Hour)) {
+		t.Error("refused sends kept the recipient limited")
+	}
+}
+
+func TestSendSMSRateLimited(t *testing.T) {
+
+	from := "CarHire"
+	SMSFrom = &from
+	smsProvider = Fake
+	smsLimiter = newRateLimiter(1, 0)
+	Fake.Reset()
+	defer Fake.Reset()
+
+	if err := sendSMS("+447700900001", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendSMS("+447700900001", "second"); err != RateLimited {
+		t.Errorf("sendSMS over the limit = %v, want RateLimited", err)
+	}
+
+	sent := Fake.Sent()
+	if len(sent) != 1 || sent[0].Body != "first" || sent[0].From != from {
+		t.Errorf("sent %+v, want only the first message", sent)
+	}
+
+	smsProvider = nil
+	if err := sendSMS("+447700900001", "third"); err != SMSDisabled {
+		t.Errorf("sendSMS without a provider = %v, want SMSDisabled", err)
+	}
+}
+
+func TestGatewayProvider(t *testing.T) {
+
+	var (
+		status   int
+		received gatewayRequest
+		auth     string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	gp := &gatewayProvider{url: server.URL, key: "secret", client: server.Client()}
+
+	tests := []struct {
+		status    int
+		ok        bool
+		permanent bool
+	}{
+		{http.StatusOK, true, false},
+		{http.StatusAccepted, true, false},
+		{http.StatusTooManyRequests, false, false},
+		{http.StatusBadGateway, false, false},
+		{http.StatusBadRequest, false, true},
+	}
+
+	for _, test := range tests {
+		status = test.status
+
+		err := gp.SendSMS("CarHire", "+447700900001", "hello")
+
+		var permanent *PermanentError
+		switch {
+		case test.ok && err != nil:
+			t.Errorf("%v: SendSMS = %v", test.status, err)
+		case !test.ok && err == nil:
+			t.Errorf("%v: SendSMS succeeded", test.status)
+		case !test.ok && errors.As(err, &permanent) != test.permanent:
+			t.Errorf("%v: SendSMS = %v, permanent should be %v", test.status, err, test.permanent)
+		}
+	}
+
+	if received != (gatewayRequest{From: "CarHire", To: "+447700900001", Body: "hello"}) || auth != "Bearer secret" {
+		t.Errorf("gateway received %+v with Authorization %q", received, auth)
+	}
+}
@@ -0,0 +1,150 @@
+package notification
+
+import (
+	"bytes"
+	htmlTemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	textTemplate "text/template"
+	"time"
+)
+
+// messageTemplate is read from <name>.subject, <name>.txt and optional <name>.html and <name>.sms files in the template directory
+type messageTemplate struct {
+	name    string
+	subject *textTemplate.Template
+	text    *textTemplate.Template
+	html    *htmlTemplate.Template
+	sms     *textTemplate.Template
+}
+
+type templateData struct {
+	Sender *Sender
+	Data   interface{}
+	Sent   time.Time
+}
+
+func loadTemplates(dir string) (map[string]*messageTemplate, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]*messageTemplate)
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() || filepath.Ext(fi.Name()) != ".txt" {
+			continue
+		}
+
+		name := strings.TrimSuffix(fi.Name(), ".txt")
+
+		tmpl, err := loadTemplate(dir, name)
+		if err != nil {
+			return nil, err
+		}
+
+		loaded[name] = tmpl
+	}
+
+	return loaded, nil
+}
+
+func loadTemplate(dir, name string) (*messageTemplate, error) {
+	var err error
+
+	tmpl := &messageTemplate{name: name}
+
+	tmpl.subject, err = textTemplate.ParseFiles(filepath.Join(dir, name+".subject"))
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl.text, err = textTemplate.ParseFiles(filepath.Join(dir, name+".txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	htmlPath := filepath.Join(dir, name+".html")
+	_, err = os.Stat(htmlPath)
+	if err == nil {
+		tmpl.html, err = htmlTemplate.ParseFiles(htmlPath)
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	smsPath := filepath.Join(dir, name+".sms")
+	_, err = os.Stat(smsPath)
+	if err == nil {
+		tmpl.sms, err = textTemplate.ParseFiles(smsPath)
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+func (mt *messageTemplate) render(sender *Sender, reference string, to []string, values interface{}) (*Message, error) {
+	var subject, text, html bytes.Buffer
+
+	now := time.Now()
+	data := &templateData{Sender: sender, Data: values, Sent: now}
+
+	err := mt.subject.Execute(&subject, data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mt.text.Execute(&text, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if mt.html != nil {
+		err = mt.html.Execute(&html, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Message{
+		Channel:   ChannelEmail,
+		From:      formatAddress(sender.Name, sender.Address),
+		To:        to,
+		Subject:   strings.TrimSpace(subject.String()),
+		Text:      text.String(),
+		HTML:      html.String(),
+		Template:  mt.name,
+		Reference: reference,
+		Created:   now,
+	}, nil
+}
+
+func (mt *messageTemplate) renderSMS(sender *Sender, reference, to string, values interface{}) (*Message, error) {
+	var text bytes.Buffer
+
+	now := time.Now()
+
+	err := mt.sms.Execute(&text, &templateData{Sender: sender, Data: values, Sent: now})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		Channel:   ChannelSMS,
+		From:      *SMSFrom,
+		To:        []string{to},
+		Text:      strings.TrimSpace(text.String()),
+		Template:  mt.name,
+		Reference: reference,
+		Created:   now,
+	}, nil
+}
@@ -0,0 +1,162 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keys are re-fetched at most this often when a token is signed with an unknown key ID
+const keyRefreshInterval = time.Minute
+
+type keySet struct {
+	sync.RWMutex
+	uri       string
+	client    *http.Client
+	keys      map[string]*rsa.PublicKey
+	refreshed time.Time
+}
+
+type jsonWebKeys struct {
+	Keys []struct {
+		KeyType string `json:"kty"`
+		KeyID   string `json:"kid"`
+		Use     string `json:"use"`
+		N       string `json:"n"`
+		E       string `json:"e"`
+	} `json:"keys"`
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+func (ks *keySet) refresh() error {
+
+	response, err := ks.client.Get(ks.uri)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc jwks returned %v", response.Status)
+	}
+
+	set := &jsonWebKeys{}
+	err = json.NewDecoder(response.Body).Decode(set)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range set.Keys {
+		if key.KeyType != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return err
+		}
+
+		keys[key.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	ks.Lock()
+	ks.keys = keys
+	ks.refreshed = time.Now()
+	ks.Unlock()
+
+	return nil
+}
+
+func (ks *keySet) get(keyID string) (*rsa.PublicKey, error) {
+
+	ks.RLock()
+	key, ok := ks.keys[keyID]
+	refreshed := ks.refreshed
+	ks.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	//The provider may have rotated its keys
+	if time.Since(refreshed) > keyRefreshInterval {
+		err := ks.refresh()
+		if err != nil {
+			return nil, err
+		}
+
+		ks.RLock()
+		key, ok = ks.keys[keyID]
+		ks.RUnlock()
+
+		if ok {
+			return key, nil
+		}
+	}
+
+	return nil, errors.New("oidc token signed with unknown key")
+}
+
+// verify checks an RS256 signed JWT, returning its decoded payload
+func (ks *keySet) verify(token string) ([]byte, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed oidc token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	header := &tokenHeader{}
+	err = json.Unmarshal(headerJSON, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Algorithm != "RS256" {
+		return nil, errors.New("unsupported oidc token algorithm " + header.Algorithm)
+	}
+
+	key, err := ks.get(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.RawURLEncoding.DecodeString(parts[1])
+}
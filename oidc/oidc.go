@@ -0,0 +1,415 @@
+package oidc
+
+import (
+	"carHiringWebsite/roles"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Settings, set from command line flags in main before InitProvider is called.
+// Login is disabled when Issuer is empty
+var (
+	Issuer       *string
+	ClientID     *string
+	ClientSecret *string
+	RedirectURL  *string
+	// Comma separated group=role pairs, the first group the user is in decides their role
+	GroupRoles *string
+)
+
+const (
+	// LoginExpiry is how long a login started with AuthCodeURL can be completed for
+	LoginExpiry = 10 * time.Minute
+
+	// StateCookie holds the state in the browser that started the login, so a login can't be completed in another
+	StateCookie = "oidc-state"
+)
+
+var (
+	Disabled      = errors.New("oidc login is not configured")
+	UnknownState  = errors.New("unknown or expired login state")
+	NoMappedGroup = errors.New("user is not in a group mapped to a role")
+
+	provider *identityProvider
+	logins   = &pendingLogins{store: make(map[string]*pendingLogin)}
+)
+
+type identityProvider struct {
+	issuer        string
+	authEndpoint  string
+	tokenEndpoint string
+	jwksURI       string
+	groupRoles    []groupRole
+	keys          *keySet
+	client        *http.Client
+}
+
+type groupRole struct {
+	group string
+	role  roles.Role
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// pendingLogin is the state kept between sending the user to the identity provider and their return.
+// linkUserID is the signed in user linking the identity to their account, 0 for a login
+type pendingLogin struct {
+	nonce      string
+	verifier   string
+	linkUserID int
+	expires    time.Time
+}
+
+type pendingLogins struct {
+	sync.Mutex
+	store map[string]*pendingLogin
+}
+
+// Claims are the fields read from a verified ID token
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	GivenName     string   `json:"given_name"`
+	FamilyName    string   `json:"family_name"`
+	Groups        []string `json:"groups"`
+	Nonce         string   `json:"nonce"`
+	Expires       int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Audience      audience `json:"aud"`
+}
+
+// audience may be sent as a single string or an array
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if json.Unmarshal(b, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	err := json.Unmarshal(b, &many)
+	*a = many
+
+	return err
+}
+
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+	Error   string `json:"error"`
+}
+
+// InitProvider reads the identity providers discovery document and signing keys
+func InitProvider() error {
+
+	if Issuer == nil || *Issuer == "" {
+		return nil
+	}
+
+	groupRoles, err := parseGroupRoles(*GroupRoles)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	issuer := strings.TrimSuffix(*Issuer, "/")
+
+	response, err := client.Get(issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc discovery returned %v", response.Status)
+	}
+
+	config := &discovery{}
+	err = json.NewDecoder(response.Body).Decode(config)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSuffix(config.Issuer, "/") != issuer {
+		return errors.New("oidc discovery issuer mismatch")
+	}
+
+	newProvider := &identityProvider{
+		issuer:        config.Issuer,
+		authEndpoint:  config.AuthorizationEndpoint,
+		tokenEndpoint: config.TokenEndpoint,
+		jwksURI:       config.JWKSURI,
+		groupRoles:    groupRoles,
+		client:        client,
+	}
+	newProvider.keys = &keySet{uri: config.JWKSURI, client: client}
+
+	err = newProvider.keys.refresh()
+	if err != nil {
+		return err
+	}
+
+	provider = newProvider
+
+	return nil
+}
+
+func Enabled() bool {
+	return provider != nil
+}
+
+func parseGroupRoles(value string) ([]groupRole, error) {
+	groupRoles := make([]groupRole, 0)
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("invalid oidc group mapping " + pair)
+		}
+
+		role, err := roles.Parse(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+
+		groupRoles = append(groupRoles, groupRole{group: strings.TrimSpace(parts[0]), role: role})
+	}
+
+	return groupRoles, nil
+}
+
+// RoleForGroups returns the role of the first mapping the groups match
+func RoleForGroups(groups []string) (roles.Role, error) {
+
+	if provider == nil {
+		return "", Disabled
+	}
+
+	for _, mapping := range provider.groupRoles {
+		for _, group := range groups {
+			if group == mapping.group {
+				return mapping.role, nil
+			}
+		}
+	}
+
+	return "", NoMappedGroup
+}
+
+// AuthCodeURL starts a login, returning the identity provider URL to send the user to and the state to keep in
+// StateCookie. A PKCE verifier and nonce are kept against the state until Exchange is called. linkUserID is the
+// signed in user linking the identity to their account, 0 to sign in
+func AuthCodeURL(linkUserID int) (string, string, error) {
+
+	if provider == nil {
+		return "", "", Disabled
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	logins.add(state, &pendingLogin{
+		nonce:      nonce,
+		verifier:   verifier,
+		linkUserID: linkUserID,
+		expires:    time.Now().Add(LoginExpiry),
+	})
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", *ClientID)
+	query.Set("redirect_uri", *RedirectURL)
+	query.Set("scope", "openid email profile groups")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(provider.authEndpoint, "?") {
+		separator = "&"
+	}
+
+	return provider.authEndpoint + separator + query.Encode(), state, nil
+}
+
+// Exchange completes a login, trading the code for an ID token and returning its verified claims and the user
+// the login links to. cookieState is the StateCookie of the browser completing the login, it must match state
+func Exchange(state, cookieState, code string) (*Claims, int, error) {
+
+	if provider == nil {
+		return nil, 0, Disabled
+	}
+
+	if subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		return nil, 0, UnknownState
+	}
+
+	login, ok := logins.take(state)
+	if !ok {
+		return nil, 0, UnknownState
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", *RedirectURL)
+	form.Set("client_id", *ClientID)
+	form.Set("code_verifier", login.verifier)
+
+	request, err := http.NewRequest(http.MethodPost, provider.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, 0, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if *ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(*ClientID), url.QueryEscape(*ClientSecret))
+	}
+
+	response, err := provider.client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	token := &tokenResponse{}
+	err = json.NewDecoder(response.Body).Decode(token)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if response.StatusCode != http.StatusOK || token.IDToken == "" {
+		return nil, 0, fmt.Errorf("oidc token request failed: %v %v", response.Status, token.Error)
+	}
+
+	claims, err := provider.verify(token.IDToken)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if claims.Nonce != login.nonce {
+		return nil, 0, errors.New("oidc nonce mismatch")
+	}
+
+	return claims, login.linkUserID, nil
+}
+
+// verify checks the ID tokens signature and standard claims
+func (p *identityProvider) verify(idToken string) (*Claims, error) {
+
+	payload, err := p.keys.verify(idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	err = json.Unmarshal(payload, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != p.issuer {
+		return nil, errors.New("oidc issuer mismatch")
+	}
+
+	validAudience := false
+	for _, aud := range claims.Audience {
+		if aud == *ClientID {
+			validAudience = true
+		}
+	}
+	if !validAudience {
+		return nil, errors.New("oidc audience mismatch")
+	}
+
+	now := time.Now().Unix()
+	if claims.Expires < now {
+		return nil, errors.New("oidc token expired")
+	}
+	if claims.IssuedAt > now+60 {
+		return nil, errors.New("oidc token issued in the future")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("oidc token has no subject")
+	}
+
+	return claims, nil
+}
+
+func (pl *pendingLogins) add(state string, login *pendingLogin) {
+	pl.Lock()
+	defer pl.Unlock()
+
+	now := time.Now()
+	for key, existing := range pl.store {
+		if now.After(existing.expires) {
+			delete(pl.store, key)
+		}
+	}
+
+	pl.store[state] = login
+}
+
+// take removes the login so a state can only be used once
+func (pl *pendingLogins) take(state string) (*pendingLogin, bool) {
+	pl.Lock()
+	defer pl.Unlock()
+
+	login, ok := pl.store[state]
+	if !ok {
+		return nil, false
+	}
+	delete(pl.store, state)
+
+	if time.Now().After(login.expires) {
+		return nil, false
+	}
+
+	return login, true
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,139 @@
+package roles
+
+import (
+	"errors"
+	"sort"
+)
+
+type Role string
+
+type Permission string
+
+const (
+	Customer     Role = "customer"
+	DeskClerk    Role = "deskClerk"
+	FleetManager Role = "fleetManager"
+	Finance      Role = "finance"
+	SuperAdmin   Role = "superadmin"
+)
+
+const (
+	StatsView       Permission = "stats.view"
+	BookingView     Permission = "booking.view"
+	BookingEdit     Permission = "booking.edit"
+	BookingProgress Permission = "booking.progress"
+	PaymentProcess  Permission = "payment.process"
+	RefundProcess   Permission = "refund.process"
+	DriverVerify    Permission = "driver.verify"
+	DocumentView    Permission = "document.view"
+	CarView         Permission = "car.view"
+	CarEdit         Permission = "car.edit"
+	UserView        Permission = "user.view"
+	UserCreate      Permission = "user.create"
+	UserEdit        Permission = "user.edit"
+	UserDisable     Permission = "user.disable"
+	UserBlacklist   Permission = "user.blacklist"
+	UserRoles       Permission = "user.roles"
+	UserErase       Permission = "user.erase"
+	AuditView       Permission = "audit.view"
+
+	UserImpersonate  Permission = "user.impersonate"
+	ImpersonateWrite Permission = "user.impersonate.write"
+
+	APIKeyManage Permission = "apikey.manage"
+
+	NotificationView  Permission = "notification.view"
+	NotificationRetry Permission = "notification.retry"
+
+	RegulatoryAlertView Permission = "alert.view"
+	DatasetView         Permission = "dataset.view"
+	DatasetManage       Permission = "dataset.manage"
+	DriverReview        Permission = "driver.review"
+	RetentionManage     Permission = "retention.manage"
+)
+
+var (
+	UnknownRole       = errors.New("unknown role")
+	UnknownPermission = errors.New("unknown permission")
+
+	rolePermissions = map[Role][]Permission{
+		Customer: {},
+		DeskClerk: {
+			StatsView, BookingView, BookingEdit, BookingProgress, PaymentProcess,
+			DriverVerify, DocumentView, CarView, UserView, UserCreate,
+			UserImpersonate,
+		},
+		FleetManager: {
+			StatsView, BookingView, CarView, CarEdit,
+		},
+		Finance: {
+			StatsView, BookingView, PaymentProcess, RefundProcess, UserView,
+		},
+		SuperAdmin: {
+			StatsView, BookingView, BookingEdit, BookingProgress, PaymentProcess,
+			RefundProcess, DriverVerify, DocumentView, CarView, CarEdit, UserView,
+			UserCreate, UserEdit, UserDisable, UserBlacklist, UserRoles, UserErase,
+			AuditView, UserImpersonate, ImpersonateWrite, APIKeyManage, NotificationView,
+			NotificationRetry, RegulatoryAlertView, DatasetView,
+			DatasetManage, DriverReview, RetentionManage,
+		},
+	}
+)
+
+// Parse validates a role name, returning UnknownRole for anything not defined above
+func Parse(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := rolePermissions[role]; !ok {
+		return "", UnknownRole
+	}
+
+	return role, nil
+}
+
+// ParsePermission validates a permission name, returning UnknownPermission if no role is granted it
+func ParsePermission(name string) (Permission, error) {
+	permission := Permission(name)
+	if !Has(SuperAdmin, permission) {
+		return "", UnknownPermission
+	}
+
+	return permission, nil
+}
+
+// Has reports whether the role has been granted the permission
+func Has(role Role, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsStaff reports whether the role has any permissions beyond a customer's
+func IsStaff(role Role) bool {
+	return len(rolePermissions[role]) > 0
+}
+
+// Permissions returns the permissions granted to the role
+func Permissions(role Role) []Permission {
+	permissions := make([]Permission, len(rolePermissions[role]))
+	copy(permissions, rolePermissions[role])
+
+	return permissions
+}
+
+// All returns every defined role in alphabetical order
+func All() []Role {
+	all := make([]Role, 0, len(rolePermissions))
+	for role := range rolePermissions {
+		all = append(all, role)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i] < all[j]
+	})
+
+	return all
+}
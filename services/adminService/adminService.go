@@ -1,39 +1,52 @@
 package adminService
 
 import (
+	"bytes"
 	"carHiringWebsite/ABIDataProvider"
 	"carHiringWebsite/DVLADataProvider"
+	"carHiringWebsite/authorisation"
 	"carHiringWebsite/data"
 	"carHiringWebsite/db"
-	"carHiringWebsite/emailService"
+	"carHiringWebsite/hash"
+	"carHiringWebsite/imaging"
+	"carHiringWebsite/notification"
+	"carHiringWebsite/roles"
+	"carHiringWebsite/services/alertService"
+	"carHiringWebsite/services/auditService"
 	"carHiringWebsite/services/bookingService"
+	"carHiringWebsite/services/carService"
+	"carHiringWebsite/services/riskService"
 	"carHiringWebsite/services/userService"
 	"carHiringWebsite/session"
-	"encoding/base64"
+	"carHiringWebsite/storage"
+	"database/sql"
 	"errors"
-	"image/jpeg"
+	"image"
 	"io"
 	"log"
-	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 var (
-	BlackListedDriver = errors.New("blacklisted")
-)
+	BlackListedDriver = riskService.BlackListedDriver
 
-func GetBookingStatuses(token string) ([]*data.BookingStatusType, error) {
+	DriverReviewRequired = riskService.DriverReviewRequired
+	DriverReviewPending  = riskService.DriverReviewPending
 
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
+	UnknownDocument = errors.New("unknown document")
 
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
-	}
+	UnknownCar        = errors.New("unknown car")
+	UnknownCarImage   = errors.New("unknown car image")
+	InvalidImageOrder = errors.New("image order must list each of the car's images once")
+
+	documentNames = map[string]bool{"license.jpg": true, "document1.jpg": true, "document2.jpg": true}
+)
+
+func GetBookingStatuses(user *data.User) ([]*data.BookingStatusType, error) {
 
 	statuses, err := db.GetBookingStatuses()
 	if err != nil {
@@ -43,16 +56,7 @@ func GetBookingStatuses(token string) ([]*data.BookingStatusType, error) {
 	return statuses, nil
 }
 
-func GetBookingStats(token string) ([]*data.BookingStat, error) {
-
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
-	}
+func GetBookingStats(user *data.User) ([]*data.BookingStat, error) {
 
 	stats, err := db.GetBookingStats()
 	if err != nil {
@@ -62,16 +66,7 @@ func GetBookingStats(token string) ([]*data.BookingStat, error) {
 	return stats, nil
 }
 
-func GetUserStats(token string) (*data.UserStat, error) {
-
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
-	}
+func GetUserStats(user *data.User) (*data.UserStat, error) {
 
 	stats, err := db.GetUserStats()
 	if err != nil {
@@ -83,16 +78,7 @@ func GetUserStats(token string) (*data.UserStat, error) {
 	return stats, nil
 }
 
-func GetUsers(token string, userSearch string) ([]*data.OutputUser, error) {
-
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
-	}
+func GetUsers(user *data.User, userSearch string) ([]*data.OutputUser, error) {
 
 	users, err := db.GetUsers(userSearch)
 	if err != nil {
@@ -102,16 +88,7 @@ func GetUsers(token string, userSearch string) ([]*data.OutputUser, error) {
 	return users, nil
 }
 
-func GetCarStats(token string) (*data.CarStat, error) {
-
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
-	}
+func GetCarStats(user *data.User) (*data.CarStat, error) {
 
 	stats, err := db.GetCarStats()
 	if err != nil {
@@ -121,16 +98,7 @@ func GetCarStats(token string) (*data.CarStat, error) {
 	return stats, nil
 }
 
-func GetBooking(token, bookingID string) (*data.AdminBooking, error) {
-
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
-	}
+func GetBooking(user *data.User, bookingID string) (*data.AdminBooking, error) {
 
 	bookingIDValid, err := strconv.Atoi(bookingID)
 	if err != nil {
@@ -159,11 +127,11 @@ func GetBooking(token, bookingID string) (*data.AdminBooking, error) {
 		return nil, err
 	}
 
-	user, err = db.SelectUserByID(adminBooking.Booking.UserID)
+	bookingUser, err := db.SelectUserByID(adminBooking.Booking.UserID)
 	if err != nil {
 		return nil, err
 	}
-	adminBooking.User = data.NewOutputUser(user)
+	adminBooking.User = data.NewOutputUser(bookingUser)
 
 	if adminBooking.Booking.DriverID.Int32 != 0 {
 		adminBooking.Booking.Driver, err = db.GetDriverByID(int(adminBooking.Booking.DriverID.Int32))
@@ -172,19 +140,15 @@ func GetBooking(token, bookingID string) (*data.AdminBooking, error) {
 		}
 	}
 
-	return adminBooking, nil
-}
-
-func GetUser(token, userID string) (*data.UserBundle, error) {
-
-	user, err := userService.GetUserFromSession(token)
+	adminBooking.RiskReport, err = riskService.GetReport(user, bookingID)
 	if err != nil {
 		return nil, err
 	}
 
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
-	}
+	return adminBooking, nil
+}
+
+func GetUser(user *data.User, userID string) (*data.UserBundle, error) {
 
 	userIDValid, err := strconv.Atoi(userID)
 	if err != nil {
@@ -193,12 +157,12 @@ func GetUser(token, userID string) (*data.UserBundle, error) {
 
 	userBundle := &data.UserBundle{}
 
-	user, err = db.SelectUserByID(userIDValid)
+	bundleUser, err := db.SelectUserByID(userIDValid)
 	if err != nil {
 		return nil, err
 	}
 
-	userBundle.User = data.NewOutputUser(user)
+	userBundle.User = data.NewOutputUser(bundleUser)
 
 	userBundle.Bookings, err = db.GetAdminUsersBookings(userIDValid)
 	if err != nil {
@@ -208,16 +172,7 @@ func GetUser(token, userID string) (*data.UserBundle, error) {
 	return userBundle, nil
 }
 
-func GetAccessoryStats(token string) ([]*data.AccessoryStat, error) {
-
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
-	}
+func GetAccessoryStats(user *data.User) ([]*data.AccessoryStat, error) {
 
 	stats, err := db.GetAccessoryStats()
 	if err != nil {
@@ -227,21 +182,18 @@ func GetAccessoryStats(token string) ([]*data.AccessoryStat, error) {
 	return stats, nil
 }
 
-func SetUser(token, userID, mode, value string) error {
-
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return err
-	}
+// SetUserPermissions are the permissions needed for each SetUser mode, main requires them on the route
+var SetUserPermissions = map[string]roles.Permission{
+	"0": roles.UserDisable,
+	"1": roles.UserBlacklist,
+	"2": roles.UserRoles,
+	"3": roles.UserRoles,
+}
 
-	if !user.Admin {
-		return errors.New("user is not admin")
-	}
+// SetUser changes a flag on another user, mode 0 disables, 1 blacklists, 2 toggles superadmin
+// and 3 assigns the role named in value
+func SetUser(user *data.User, userID, mode, value string) error {
 
-	valueBool, err := strconv.ParseBool(value)
-	if err != nil {
-		return err
-	}
 	modeValue, err := strconv.Atoi(mode)
 	if err != nil {
 		return err
@@ -251,35 +203,97 @@ func SetUser(token, userID, mode, value string) error {
 		return err
 	}
 
+	if _, ok := SetUserPermissions[mode]; !ok {
+		return errors.New("unknown mode")
+	}
+
 	if userIDValue == user.ID {
 		return errors.New("admin cannot demote themself")
 	}
 
+	target, err := db.SelectUserByID(userIDValue)
+	if err != nil {
+		return err
+	}
+
+	var role roles.Role
+	var valueBool bool
+	if modeValue == 3 {
+		role, err = roles.Parse(value)
+		if err != nil {
+			return err
+		}
+	} else {
+		valueBool, err = strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+	}
+
 	switch modeValue {
 	case 0:
 		err = db.SetDisableUser(userIDValue, valueBool)
 		if err != nil {
 			return err
 		}
+
+		err = auditService.Record(user, auditService.UserDisable, auditService.EntityUser, userIDValue,
+			map[string]bool{"Disabled": target.Disabled}, map[string]bool{"Disabled": valueBool})
 		break
 	case 1:
 		err = db.SetBlackListUser(userIDValue, valueBool)
 		if err != nil {
 			return err
 		}
+
+		err = auditService.Record(user, auditService.UserBlacklist, auditService.EntityUser, userIDValue,
+			map[string]bool{"Blacklisted": target.Blacklisted}, map[string]bool{"Blacklisted": valueBool})
 		break
 	case 2:
-		err = db.SetAdminUser(userIDValue, valueBool)
+		role = roles.Customer
+		if valueBool {
+			role = roles.SuperAdmin
+		}
+		fallthrough
+	case 3:
+		err = db.SetUserRole(userIDValue, role)
 		if err != nil {
 			return err
 		}
+
+		err = auditService.Record(user, auditService.UserRole, auditService.EntityUser, userIDValue,
+			map[string]roles.Role{"Role": target.Role}, map[string]roles.Role{"Role": role})
 		break
 	}
+	if err != nil {
+		return err
+	}
+
+	return refreshSession(userIDValue)
+}
+
+// refreshSession reloads a user into their active session so role and status changes apply straight away
+func refreshSession(userID int) error {
+
+	target, err := db.SelectUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	bag, err := session.GetByEmail(target.Email)
+	if err == session.InactiveSession {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	target.SessionToken = bag.GetToken()
+	bag.UpdateUser(target)
 
 	return nil
 }
 
-func VerifyDriver(token, dob, lastname, names, address, postcode, license, bookingID string, images data.ImageBundle) error {
+func VerifyDriver(user *data.User, dob, lastname, names, address, postcode, license, bookingID string, images data.ImageBundle) error {
 
 	dobUnix, err := strconv.ParseInt(dob, 10, 64)
 	if err != nil {
@@ -288,9 +302,8 @@ func VerifyDriver(token, dob, lastname, names, address, postcode, license, booki
 
 	dobTime := time.Unix(dobUnix, 0)
 
-	var verifyError error
-	driverID, verifyError := verifyDriver(token, lastname, names, address, postcode, license, bookingID, dobTime, images)
-	if verifyError == BlackListedDriver || verifyError == DVLADataProvider.InvalidLicense || verifyError == ABIDataProvider.FraudulentClaim {
+	driverID, report, verifyError := verifyDriver(user, lastname, names, address, postcode, license, bookingID, dobTime, images)
+	if report != nil && report.Decision == riskService.ResultFail {
 		if driverID != 0 {
 			err = db.BlackListedDriver(driverID)
 			if err != nil {
@@ -303,228 +316,264 @@ func VerifyDriver(token, dob, lastname, names, address, postcode, license, booki
 			}
 		}
 
-		if verifyError == DVLADataProvider.InvalidLicense {
-
-			go func() {
-				var emailError error
+		err = riskService.LinkDriver(report, driverID)
+		if err != nil {
+			return err
+		}
 
-				defer func() {
-					if emailError != nil {
-						log.Printf("SendEmail error - err: %v", err)
-					}
-				}()
+		err = auditService.Record(user, auditService.DriverVerify, auditService.EntityDriver, driverID, nil,
+			map[string]interface{}{"BookingID": bookingID, "Result": verifyError.Error(), "BlackListed": true, "RiskReportID": report.ID})
+		if err != nil {
+			return err
+		}
 
-				driver, emailError := db.GetDriverByID(driverID)
-				if err != nil {
-					return
-				}
-				if driver == nil {
-					emailError = errors.New("driver is nil")
-					return
-				}
+		err = raiseAlert(user, verifyError, driverID, bookingID)
+		if err != nil {
+			return err
+		}
 
-				emailError = emailService.SendEmail(driver)
-			}()
+		return verifyError
+	}
 
+	//The licence record doesn't match, refused without blacklisting as it may be a mistake on the form, and
+	//borderline ABI matches wait for a senior admin to decide
+	if report != nil && report.Decision != riskService.ResultPass {
+		err = auditService.Record(user, auditService.DriverVerify, auditService.EntityDriver, driverID, nil,
+			map[string]interface{}{"BookingID": bookingID, "License": license, "Result": verifyError.Error(), "BlackListed": false,
+				"RiskReportID": report.ID})
+		if err != nil {
+			return err
 		}
+
+		return verifyError
+	}
+
+	if verifyError != nil {
 		return verifyError
 	}
 
+	return auditService.Record(user, auditService.DriverVerify, auditService.EntityDriver, driverID, nil,
+		map[string]interface{}{"BookingID": bookingID, "Result": "verified", "BlackListed": false, "RiskReportID": report.ID})
+}
+
+// raiseAlert reports invalid licences to the DVLA and fraudulent claims to the ABI
+func raiseAlert(user *data.User, verifyError error, driverID int, bookingID string) error {
+
+	authority, offence := "", ""
+	switch verifyError {
+	case DVLADataProvider.InvalidLicense:
+		authority, offence = alertService.DVLA, alertService.InvalidLicense
+	case ABIDataProvider.FraudulentClaim:
+		authority, offence = alertService.ABI, alertService.FraudulentClaim
+	default:
+		return nil
+	}
+
+	bookID, err := strconv.Atoi(bookingID)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = alertService.Raise(user, authority, offence, driverID, bookID)
 
+	return err
 }
 
-func verifyDriver(token, lastname, names, address, postcode, license, bookingID string, dob time.Time, images data.ImageBundle) (int, error) {
-
-	//user, err := userService.GetUserFromSession(token)
-	//if err != nil {
-	//	return 0, err
-	//}
-	//
-	//if !user.Admin {
-	//	return 0, errors.New("user is not admin")
-	//}
+func verifyDriver(user *data.User, lastname, names, address, postcode, license, bookingID string, dob time.Time, images data.ImageBundle) (int, *data.RiskReport, error) {
 
 	bookID, err := strconv.Atoi(bookingID)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
 	booking, err := db.GetSingleBooking(bookID)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
 	if booking.ProcessID != bookingService.BookingConfirmed {
-		return 0, errors.New("booking has incorrect status")
+		return 0, nil, errors.New("booking has incorrect status")
 	}
 
 	DVLAStatus, err := db.GetBookingProcessStatus(bookID, bookingService.DVLACheck)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 	if DVLAStatus != nil && !DVLAStatus.Active {
-		return 0, errors.New("booking not ready")
+		return 0, nil, errors.New("booking not ready")
 	}
 
 	ABIStatus, err := db.GetBookingProcessStatus(bookID, bookingService.ABICheck)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 	if ABIStatus != nil && !ABIStatus.Active {
-		return 0, errors.New("booking not ready")
+		return 0, nil, errors.New("booking not ready")
 	}
 
-	driver, err := db.GetDriverByName(lastname, names)
+	//Images are checked before the driver, a bad scan shouldn't leave a driver verified without documents
+	documents, err := readDocuments(images)
 	if err != nil {
-		return 0, err
-	}
-
-	driverID := 0
-	if driver != nil {
-		driverID = driver.ID
-
-		if driver.BlackListed {
-			if driver.Reason == DVLADataProvider.InvalidLicense.Error() {
-				return driver.ID, DVLADataProvider.InvalidLicense
-			}
-			return driver.ID, BlackListedDriver
-		}
-	}
-
-	if DVLADataProvider.IsInvalidLicense(license) {
-		return driverID, DVLADataProvider.InvalidLicense
+		return 0, nil, err
 	}
 
-	fraudulent, err := ABIDataProvider.HasFraudulentClaim(lastname, names, address, postcode, dob)
+	//Every check is made and reported before any is acted on
+	report, err := riskService.Assess(user, bookID, &data.RiskSubject{
+		LastName: lastname,
+		Names:    names,
+		DOB:      dob,
+		Address:  address,
+		PostCode: postcode,
+		License:  license,
+	}, booking.End.Time)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
-	if fraudulent {
-		return driverID, ABIDataProvider.FraudulentClaim
+	if report.Decision != riskService.ResultPass {
+		return report.DriverID, report, riskService.Err(report)
 	}
 
-	if driver == nil {
+	driverID := report.DriverID
+	if driverID == 0 {
 		driverID, err = db.CreateDriver(lastname, names, license, address, postcode, false, dob, "")
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
-	}
-
-	noExtraDoc := false
-
-	licenseImageReader := strings.NewReader(images.License)
-	document1ImageReader := strings.NewReader(images.Document1)
-
-	var document2ImageReader io.Reader
-	if images.Document2 == "empty" {
-		noExtraDoc = true
-	} else {
-		document2ImageReader = strings.NewReader(images.Document2)
-	}
-
-	driverIDString := strconv.Itoa(driverID)
-	err = os.MkdirAll("documents/"+driverIDString+"/"+bookingID, os.ModePerm)
-	if err != nil {
-		return 0, err
-	}
 
-	licenseFile, err := os.Create("documents/" + driverIDString + "/" + bookingID + "/license.jpg")
-	if err != nil {
-		return 0, err
-	}
-	document1File, err := os.Create("documents/" + driverIDString + "/" + bookingID + "/document1.jpg")
-	if err != nil {
-		return 0, err
-	}
-	var document2File *os.File
-	if !noExtraDoc {
-		document2File, err = os.Create("documents/" + driverIDString + "/" + bookingID + "/document2.jpg")
+		err = riskService.LinkDriver(report, driverID)
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 	}
 
+	saved := make([]string, 0, len(documents))
 	defer func() {
-		if licenseFile != nil {
-			licenseFile.Close()
-		}
-		if document1File != nil {
-			document1File.Close()
-		}
-		if !noExtraDoc && document2File != nil {
-			document2File.Close()
-		}
 		if err != nil {
-			os.Remove("documents/" + driverIDString + "/" + bookingID + "/license.jpg")
-			os.Remove("documents/" + driverIDString + "/" + bookingID + "/document1.jpg")
-			os.Remove("documents/" + driverIDString + "/" + bookingID + "/document2.jpg")
+			for _, key := range saved {
+				storage.Delete(key)
+			}
 		}
 	}()
 
-	err = saveImage(licenseImageReader, licenseFile)
-	if err != nil {
-		return 0, err
-	}
-	err = saveImage(document1ImageReader, document1File)
-	if err != nil {
-		return 0, err
-	}
-	if !noExtraDoc {
-		err = saveImage(document2ImageReader, document2File)
+	for _, document := range documents {
+		var key string
+		key, err = storage.Key(strconv.Itoa(driverID), bookingID, document.name)
+		if err != nil {
+			return 0, nil, err
+		}
+		key = storage.Documents + key
+
+		_, err = storage.Put(key, bytes.NewReader(document.content))
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
+		saved = append(saved, key)
 	}
 
 	status, err := db.GetBookingProcessStatus(bookID, booking.ProcessID)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 	if status != nil && status.Active {
-		err := db.SetBookingStatus(status.ID, false)
+		err = db.SetBookingStatus(status.ID, false)
 		if err != nil {
-			return 0, err
+			return 0, nil, err
 		}
 	}
 
-	_, err = db.InsertBookingStatus(bookID, bookingService.CollectedBooking, 1, 1, 0.0, "admin progressed booking")
+	_, err = db.InsertBookingStatus(bookID, bookingService.CollectedBooking, user.ID, 1, 0.0, "admin progressed booking")
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
 	err = db.SetBookingStatus(DVLAStatus.ID, false)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
 	err = db.SetBookingStatus(ABIStatus.ID, false)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
 	err = db.AddBookingDriver(bookID, driverID)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
+	}
+
+	return driverID, report, nil
+}
+
+// document is a driver document scan ready to store
+type document struct {
+	name    string
+	content []byte
+}
+
+// readDocuments decodes the scans sent to verify a driver, the second identity document is optional
+func readDocuments(images data.ImageBundle) ([]*document, error) {
+
+	scans := []*document{{name: "license.jpg"}, {name: "document1.jpg"}}
+	uploads := []string{images.License, images.Document1}
+	if images.Document2 != "empty" && images.Document2 != "" {
+		scans = append(scans, &document{name: "document2.jpg"})
+		uploads = append(uploads, images.Document2)
 	}
 
-	return 0, nil
+	for i, scan := range scans {
+		img, err := imaging.Read(strings.NewReader(uploads[i]))
+		if err != nil {
+			return nil, err
+		}
+
+		scan.content, err = imaging.EncodeJPEG(img)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return scans, nil
+}
+
+// IsVerifyFailure reports whether err is a verification result to show the admin rather than a server error
+func IsVerifyFailure(err error) bool {
+	return err == BlackListedDriver || err == DVLADataProvider.InvalidLicense || err == ABIDataProvider.FraudulentClaim ||
+		DVLADataProvider.IsMismatch(err) || err == DriverReviewRequired || err == DriverReviewPending || imaging.IsUserError(err)
 }
 
-func CreateCar(token, fuelType, gearType, carType, size, colour, seats, price, disabled, over25, description string, body io.Reader) error {
+// GetDocumentURL returns a signed link to one of the documents saved when a driver was verified for a booking
+func GetDocumentURL(user *data.User, driverID, bookingID, document string) (*data.DocumentURL, error) {
+
+	if !documentNames[document] {
+		return nil, UnknownDocument
+	}
 
-	user, err := userService.GetUserFromSession(token)
+	key, err := storage.Key(driverID, bookingID, document)
+	if err == storage.InvalidKey {
+		return nil, UnknownDocument
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
+	key = storage.Documents + key
 
-	if !user.Admin {
-		return errors.New("user is not admin")
+	_, err = storage.Stat(key)
+	if err == storage.NotFound {
+		return nil, UnknownDocument
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	url, expires, err := storage.URL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.DocumentURL{URL: url, Expires: data.ConvertDate(expires)}, nil
+}
+
+func CreateCar(user *data.User, fuelType, gearType, carType, size, colour, seats, price, disabled, over25, description string, body io.Reader) error {
 
 	disabledBool, err := strconv.ParseBool(disabled)
 	if err != nil {
@@ -565,60 +614,157 @@ func CreateCar(token, fuelType, gearType, carType, size, colour, seats, price, d
 		return err
 	}
 
-	fileName := strings.ReplaceAll(description, " ", "_")
-	fileName += "_" + colour
+	//The image is checked before the car is made so a bad upload doesn't leave a car without one
+	img, err := imaging.Read(body)
+	if err != nil {
+		return err
+	}
 
-	file, err := os.Create("cars/" + fileName + ".jpg")
+	carID, err := db.CreateCar(fuelTypeID, gearTypeID, carTypeID, sizeID, colourID, seatsNumber, priceNumber, disabledBool, over25Bool, description)
+	if err != nil {
+		return err
+	}
+
+	_, err = addCarImage(user, carID, "", true, img)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if file != nil {
-			file.Close()
-			if err != nil {
-				os.Remove("cars/" + fileName + ".jpg")
-			}
-		}
-	}()
 
-	err = saveImage(body, file)
+	car, err := db.GetCar(strconv.Itoa(carID))
 	if err != nil {
 		return err
 	}
 
-	_, err = db.CreateCar(fuelTypeID, gearTypeID, carTypeID, sizeID, colourID, seatsNumber, priceNumber, disabledBool, over25Bool, fileName, description)
+	return auditService.Record(user, auditService.CarCreate, auditService.EntityCar, carID, nil, car)
+}
 
-	return nil
+// carImageName is a new file name for a photo of the car, never one already stored
+func carImageName(carID int) string {
+	return "car" + strconv.Itoa(carID) + "_" + uuid.New().String()
+}
+
+// addCarImage stores the image under a new file name and adds it as the car's last photo, returning the photo
+func addCarImage(user *data.User, carID int, caption string, primary bool, img image.Image) (*data.CarImage, error) {
+
+	fileName := carImageName(carID)
+
+	keys, err := saveCarImage(fileName, img)
+	if err != nil {
+		return nil, err
+	}
+
+	imageID, err := db.InsertCarImage(carID, fileName, caption, primary, user.ID)
+	if err != nil {
+		for _, key := range keys {
+			storage.Delete(key)
+		}
+		return nil, err
+	}
+
+	return db.GetCarImage(imageID)
 }
 
-func saveImage(reader io.Reader, file *os.File) error {
+// replaceCarImage stores the image under a new file name and swaps it in as the photo's file
+func replaceCarImage(carID int, photo *data.CarImage, img image.Image) error {
 
-	reader = base64.NewDecoder(base64.StdEncoding.WithPadding(base64.StdPadding), reader)
+	fileName := carImageName(carID)
 
-	image, err := jpeg.Decode(reader)
+	keys, err := saveCarImage(fileName, img)
 	if err != nil {
 		return err
 	}
 
-	err = jpeg.Encode(file, image, nil)
+	err = db.ReplaceCarImageFile(photo.ID, fileName)
 	if err != nil {
+		for _, key := range keys {
+			storage.Delete(key)
+		}
 		return err
 	}
 
-	return nil
+	return deleteCarImageFiles(photo.FileName)
+}
+
+// removeCarImage deletes the photo, and its files once no other photo uses them
+func removeCarImage(photo *data.CarImage) error {
+
+	err := db.DeleteCarImage(photo.ID)
+	if err != nil {
+		return err
+	}
+
+	return deleteCarImageFiles(photo.FileName)
 }
 
-func UpdateCar(token, carID, fuelType, gearType, carType, size, colour, seats, price, disabled, description, over25 string, body io.Reader) error {
+// deleteCarImageFiles deletes every size of the file unless a photo still uses it
+func deleteCarImageFiles(fileName string) error {
 
-	user, err := userService.GetUserFromSession(token)
+	count, err := db.CountCarImageFile(fileName)
 	if err != nil {
 		return err
 	}
+	if count > 0 {
+		return nil
+	}
+
+	for _, variant := range imaging.CarVariants {
+		key, err := storage.Key(imaging.VariantName(fileName, variant) + ".jpg")
+		if err != nil {
+			return err
+		}
+
+		err = storage.Delete(storage.Cars + key)
+		if err != nil && err != storage.NotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveCarImage stores the image at every car image size, returning the keys stored. Nothing is left
+// stored if any size fails
+func saveCarImage(fileName string, img image.Image) (keys []string, err error) {
+
+	keys = make([]string, 0, len(imaging.CarVariants))
+	defer func() {
+		if err != nil {
+			for _, key := range keys {
+				storage.Delete(key)
+			}
+			keys = nil
+		}
+	}()
+
+	for _, variant := range imaging.CarVariants {
+		var (
+			key     string
+			content []byte
+		)
+
+		key, err = storage.Key(imaging.VariantName(fileName, variant) + ".jpg")
+		if err != nil {
+			return keys, err
+		}
+		key = storage.Cars + key
+
+		content, err = imaging.EncodeJPEG(imaging.Resize(img, variant.MaxSize))
+		if err != nil {
+			return keys, err
+		}
 
-	if !user.Admin {
-		return errors.New("user is not admin")
+		_, err = storage.Put(key, bytes.NewReader(content))
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
 	}
 
+	return keys, nil
+}
+
+func UpdateCar(user *data.User, carID, fuelType, gearType, carType, size, colour, seats, price, disabled, description, over25 string, body io.Reader) error {
+
 	disabledBool, err := strconv.ParseBool(disabled)
 	if err != nil {
 		return err
@@ -662,101 +808,224 @@ func UpdateCar(token, carID, fuelType, gearType, carType, size, colour, seats, p
 		return err
 	}
 
-	fileName := ""
+	//An image sent with the car replaces its primary photo, keeping its caption and place in the order
 	if body != nil {
-		fileName = strings.ReplaceAll(description, " ", "_")
-		fileName += "_" + colour
-
-		file, err := os.Create("cars/" + fileName + ".jpg")
+		img, err := imaging.Read(body)
 		if err != nil {
 			return err
 		}
-		defer func() {
-			if file != nil {
-				file.Close()
-				if err != nil {
-					os.Remove("cars/" + fileName + ".jpg")
-				}
-			}
-		}()
-
-		decoder := base64.NewDecoder(base64.StdEncoding.WithPadding(base64.StdPadding), body)
 
-		image, err := jpeg.Decode(decoder)
+		photos, err := db.GetCarImages(car.ID)
 		if err != nil {
 			return err
 		}
 
-		err = jpeg.Encode(file, image, nil)
+		var primary *data.CarImage
+		for _, photo := range photos {
+			if photo.Primary {
+				primary = photo
+			}
+		}
+
+		if primary == nil {
+			_, err = addCarImage(user, car.ID, "", true, img)
+		} else {
+			err = replaceCarImage(car.ID, primary, img)
+		}
 		if err != nil {
 			return err
 		}
-	} else {
-		fileName = car.Image
 	}
 
-	_, err = db.UpdateCar(fuelTypeID, gearTypeID, carTypeID, sizeID, colourID, seatsNumber, priceNumber, disabledBool, over25Bool, fileName, description, car.ID)
+	_, err = db.UpdateCar(fuelTypeID, gearTypeID, carTypeID, sizeID, colourID, seatsNumber, priceNumber, disabledBool, over25Bool, description, car.ID)
+	if err != nil {
+		return err
+	}
+
+	updatedCar, err := db.GetCar(carID)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return auditService.Record(user, auditService.CarUpdate, auditService.EntityCar, car.ID, car, updatedCar)
 }
 
-func GetQueryingRefundBookings(token string) ([]*data.BookingColumn, error) {
-	user, err := userService.GetUserFromSession(token)
+// GetCarImages returns the car's photos in the order they're shown
+func GetCarImages(user *data.User, carID string) ([]*data.CarImage, error) {
+
+	car, err := getCar(carID)
 	if err != nil {
 		return nil, err
 	}
 
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
-	}
-
-	bookings, err := db.GetQueryingRefundBookings()
+	err = carService.SetPhotos(car)
 	if err != nil {
 		return nil, err
 	}
 
-	return bookings, nil
+	return car.Photos, nil
 }
 
-func GetAwaitingBookings(token, status, limit string) ([]*data.BookingColumn, error) {
+// AddCarImage adds the uploaded image as the car's last photo, it's made primary if asked or the car has no others
+func AddCarImage(user *data.User, carID, caption, primary string, body io.Reader) (*data.CarImage, error) {
 
-	user, err := userService.GetUserFromSession(token)
+	primaryBool, err := strconv.ParseBool(primary)
 	if err != nil {
 		return nil, err
 	}
 
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
+	car, err := getCar(carID)
+	if err != nil {
+		return nil, err
 	}
 
-	limitNum, err := strconv.Atoi(limit)
+	img, err := imaging.Read(body)
 	if err != nil {
 		return nil, err
 	}
-	if limitNum < 0 || limitNum > 20 {
-		return nil, errors.New("limit out of bound")
-	}
 
-	bookings, err := db.GetUpcomingBookings(status, limitNum)
+	photo, err := addCarImage(user, car.ID, caption, primaryBool, img)
 	if err != nil {
 		return nil, err
 	}
+	photo.Images = carService.ImageURLs(photo.FileName)
 
-	return bookings, nil
+	return photo, auditService.Record(user, auditService.CarImageAdd, auditService.EntityCar, car.ID, nil, photo)
+}
+
+// UpdateCarImage sets the photo's caption, and makes it the car's primary photo if primary is true
+func UpdateCarImage(user *data.User, imageID, caption, primary string) error {
+
+	primaryBool, err := strconv.ParseBool(primary)
+	if err != nil {
+		return err
+	}
+
+	photo, err := getCarImage(imageID)
+	if err != nil {
+		return err
+	}
+
+	err = db.UpdateCarImage(photo.ID, caption, primaryBool)
+	if err != nil {
+		return err
+	}
+
+	updatedPhoto, err := db.GetCarImage(photo.ID)
+	if err != nil {
+		return err
+	}
+
+	return auditService.Record(user, auditService.CarImageUpdate, auditService.EntityCar, photo.CarID, photo, updatedPhoto)
+}
+
+// ReorderCarImages puts the car's photos in the order of imageIDs, a comma separated list that must have every
+// one of the car's photos exactly once
+func ReorderCarImages(user *data.User, carID, imageIDs string) error {
+
+	car, err := getCar(carID)
+	if err != nil {
+		return err
+	}
+
+	photos, err := db.GetCarImages(car.ID)
+	if err != nil {
+		return err
+	}
+
+	carPhotos := make(map[int]bool, len(photos))
+	before := make([]int, 0, len(photos))
+	for _, photo := range photos {
+		carPhotos[photo.ID] = true
+		before = append(before, photo.ID)
+	}
+
+	order := make([]int, 0, len(photos))
+	for _, id := range strings.Split(imageIDs, ",") {
+		imageID, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil {
+			return InvalidImageOrder
+		}
+		if !carPhotos[imageID] {
+			return InvalidImageOrder
+		}
+		delete(carPhotos, imageID)
+
+		order = append(order, imageID)
+	}
+	if len(carPhotos) > 0 {
+		return InvalidImageOrder
+	}
+
+	err = db.ReorderCarImages(car.ID, order)
+	if err != nil {
+		return err
+	}
+
+	return auditService.Record(user, auditService.CarImageReorder, auditService.EntityCar, car.ID, before, order)
 }
 
-func GetSearchedBookings(token, userSearch, bookingSearch, statusFilter string) ([]*data.BookingColumn, error) {
+// DeleteCarImage removes the photo, the next photo in order becomes primary if it was the primary one
+func DeleteCarImage(user *data.User, imageID string) error {
 
-	user, err := userService.GetUserFromSession(token)
+	photo, err := getCarImage(imageID)
+	if err != nil {
+		return err
+	}
+
+	err = removeCarImage(photo)
+	if err != nil {
+		return err
+	}
+
+	return auditService.Record(user, auditService.CarImageDelete, auditService.EntityCar, photo.CarID, photo, nil)
+}
+
+func getCar(carID string) (*data.Car, error) {
+
+	id, err := strconv.Atoi(carID)
+	if err != nil {
+		return nil, UnknownCar
+	}
+
+	car, err := db.GetCar(strconv.Itoa(id))
+	if err == sql.ErrNoRows {
+		return nil, UnknownCar
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
+	return car, nil
+}
+
+func getCarImage(imageID string) (*data.CarImage, error) {
+
+	id, err := strconv.Atoi(imageID)
+	if err != nil {
+		return nil, UnknownCarImage
 	}
 
-	bookings, err := db.GetSearchedBookings(userSearch, bookingSearch, statusFilter)
+	photo, err := db.GetCarImage(id)
+	if err != nil {
+		return nil, err
+	}
+	if photo == nil {
+		return nil, UnknownCarImage
+	}
+
+	return photo, nil
+}
+
+// IsUserError reports whether err is a problem with the request the admin can fix, rather than the server
+func IsUserError(err error) bool {
+	return err == UnknownDocument || err == UnknownCar || err == UnknownCarImage || err == InvalidImageOrder ||
+		imaging.IsUserError(err)
+}
+
+func GetQueryingRefundBookings(user *data.User) ([]*data.BookingColumn, error) {
+
+	bookings, err := db.GetQueryingRefundBookings()
 	if err != nil {
 		return nil, err
 	}
@@ -764,36 +1033,50 @@ func GetSearchedBookings(token, userSearch, bookingSearch, statusFilter string)
 	return bookings, nil
 }
 
-func GetCars(token, fuelTypes, gearTypes, carTypes, carSizes, colours, search string) ([]*data.Car, error) {
+func GetAwaitingBookings(user *data.User, status, limit string) ([]*data.BookingColumn, error) {
 
-	user, err := userService.GetUserFromSession(token)
+	limitNum, err := strconv.Atoi(limit)
 	if err != nil {
 		return nil, err
 	}
+	if limitNum < 0 || limitNum > 20 {
+		return nil, errors.New("limit out of bound")
+	}
 
-	if !user.Admin {
-		return nil, errors.New("user is not admin")
+	bookings, err := db.GetUpcomingBookings(status, limitNum)
+	if err != nil {
+		return nil, err
 	}
 
-	cars, err := db.AdminGetCars(fuelTypes, gearTypes, carTypes, carSizes, colours, search)
+	return bookings, nil
+}
+
+func GetSearchedBookings(user *data.User, userSearch, bookingSearch, statusFilter string) ([]*data.BookingColumn, error) {
+
+	bookings, err := db.GetSearchedBookings(userSearch, bookingSearch, statusFilter)
 	if err != nil {
 		return nil, err
 	}
 
-	return cars, nil
+	return bookings, nil
 }
 
-func ProgressBooking(token, bookingID, failed string) error {
+func GetCars(user *data.User, fuelTypes, gearTypes, carTypes, carSizes, colours, search string) ([]*data.Car, error) {
 
-	user, err := userService.GetUserFromSession(token)
+	cars, err := db.AdminGetCars(fuelTypes, gearTypes, carTypes, carSizes, colours, search)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !user.Admin {
-		return errors.New("user is not admin")
+	for _, car := range cars {
+		carService.SetImages(car)
 	}
 
+	return cars, nil
+}
+
+func ProgressBooking(user *data.User, bookingID, failed string) error {
+
 	failedValue, err := strconv.ParseBool(failed)
 	if err != nil {
 		return err
@@ -902,27 +1185,21 @@ func ProgressBooking(token, bookingID, failed string) error {
 			return err
 		}
 
+		nextID = bookingService.CanceledBooking
 	}
 
-	return nil
+	return auditService.Record(user, auditService.BookingProgress, auditService.EntityBooking, booking.ID,
+		map[string]interface{}{"ProcessID": booking.ProcessID},
+		map[string]interface{}{"ProcessID": nextID, "Failed": failedValue, "UserBlackListed": blackListUser})
 }
 
-func ProcessRefundHandler(token, bookingID, accept, reason string) error {
+func ProcessRefundHandler(user *data.User, bookingID, accept, reason string) error {
 
 	acceptBool, err := strconv.ParseBool(accept)
 	if err != nil {
 		return err
 	}
 
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return err
-	}
-
-	if !user.Admin {
-		return errors.New("user is not admin")
-	}
-
 	bookID, err := strconv.Atoi(bookingID)
 	if err != nil {
 		return err
@@ -974,32 +1251,28 @@ func ProcessRefundHandler(token, bookingID, accept, reason string) error {
 		}
 	}
 
-	return nil
+	return auditService.Record(user, auditService.BookingRefund, auditService.EntityBooking, booking.ID,
+		map[string]interface{}{"AmountPaid": booking.AmountPaid},
+		map[string]interface{}{"Accepted": acceptBool, "Reason": reason})
 }
 
-func CreateUser(token, email, password, firstname, names, dobString string) (bool, *data.OutputUser, error) {
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return false, nil, err
-	}
+func CreateUser(user *data.User, email, password, firstname, names, dobString string) (bool, *data.OutputUser, error) {
 
-	if !user.Admin {
-		return false, nil, errors.New("user is not admin")
+	created, newUser, err := userService.CreateUser(email, password, firstname, names, dobString)
+	if err != nil || !created {
+		return created, newUser, err
 	}
 
-	return userService.CreateUser(email, password, firstname, names, dobString)
-}
-
-func ProcessExtraPayment(token, bookingID string) error {
-
-	user, err := userService.GetUserFromSession(token)
+	err = auditService.Record(user, auditService.UserCreate, auditService.EntityUser, newUser.ID, nil,
+		map[string]interface{}{"FirstName": newUser.FirstName, "Names": newUser.Names, "Email": newUser.Email})
 	if err != nil {
-		return err
+		return false, nil, err
 	}
 
-	if !user.Admin {
-		return errors.New("user is not admin")
-	}
+	return created, newUser, nil
+}
+
+func ProcessExtraPayment(user *data.User, bookingID string) error {
 
 	bookID, err := strconv.Atoi(bookingID)
 	if err != nil {
@@ -1050,5 +1323,258 @@ func ProcessExtraPayment(token, bookingID string) error {
 		return err
 	}
 
-	return nil
+	return auditService.Record(user, auditService.BookingExtraPayment, auditService.EntityBooking, booking.ID,
+		map[string]float64{"AmountPaid": booking.AmountPaid},
+		map[string]float64{"AmountPaid": booking.TotalCost})
+}
+
+func GetErasureRequests(user *data.User, status string) ([]*data.ErasureRequest, error) {
+
+	if status == "" {
+		status = userService.ErasurePending
+	}
+
+	requests, err := db.GetErasureRequests(status)
+	if err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// ProcessErasure accepts or rejects a customers erasure request. Accepting anonymises the user and any
+// drivers only they have used, redacts the audit entries about them and deletes the documents uploaded for
+// their bookings.
+// Booking rows and their statuses are kept as they are needed for accounting
+func ProcessErasure(user *data.User, requestID, accept, reason string) error {
+
+	acceptBool, err := strconv.ParseBool(accept)
+	if err != nil {
+		return err
+	}
+
+	requestIDValid, err := strconv.Atoi(requestID)
+	if err != nil {
+		return err
+	}
+
+	request, err := db.GetErasureRequest(requestIDValid)
+	if err != nil {
+		return err
+	}
+
+	if request.Status != userService.ErasurePending {
+		return errors.New("erasure request already processed")
+	}
+
+	if !acceptBool {
+		err = db.UpdateErasureRequest(request.ID, userService.ErasureRejected, user.ID, reason)
+		if err != nil {
+			return err
+		}
+
+		return auditService.Record(user, auditService.UserErase, auditService.EntityUser, request.UserID,
+			map[string]string{"Status": request.Status}, map[string]string{"Status": userService.ErasureRejected, "Reason": reason})
+	}
+
+	bookingIDs, err := db.GetUserBookingIDs(request.UserID)
+	if err != nil {
+		return err
+	}
+
+	driverIDs := make(map[int][]int)
+	for _, bookingID := range bookingIDs {
+		booking, err := db.GetSingleBooking(bookingID)
+		if err != nil {
+			return err
+		}
+
+		finished := booking.ProcessID == bookingService.CompletedBooking || booking.ProcessID == bookingService.CanceledBooking
+		if !finished || booking.AwaitingExtraPayment {
+			return errors.New("user has bookings in progress")
+		}
+
+		if booking.DriverID.Valid {
+			driverID := int(booking.DriverID.Int32)
+			driverIDs[driverID] = append(driverIDs[driverID], booking.ID)
+		}
+	}
+
+	//Drivers used by other users keep their identity, only the documents from this users bookings go
+	anonymise := make([]int, 0, len(driverIDs))
+	prefixes := make([]string, 0)
+	for driverID, driverBookings := range driverIDs {
+		driverString := strconv.Itoa(driverID)
+
+		shared, err := db.DriverUsedByOtherUsers(driverID, request.UserID)
+		if err != nil {
+			return err
+		}
+
+		if shared {
+			for _, bookingID := range driverBookings {
+				prefixes = append(prefixes, storage.Documents+driverString+"/"+strconv.Itoa(bookingID)+"/")
+			}
+			continue
+		}
+
+		anonymise = append(anonymise, driverID)
+		prefixes = append(prefixes, storage.Documents+driverString+"/")
+	}
+
+	target, err := db.SelectUserByID(request.UserID)
+	if err != nil {
+		return err
+	}
+
+	salt, authHash, err := hash.New(uuid.New().String())
+	if err != nil {
+		return err
+	}
+
+	redacted, err := db.EraseUser(request.ID, request.UserID, user.ID, "erased-"+strconv.Itoa(request.UserID)+"@erased.invalid",
+		salt, authHash, reason, anonymise)
+	if err != nil {
+		return err
+	}
+
+	bag, err := session.GetByEmail(target.Email)
+	if err == nil {
+		session.Delete(bag)
+	}
+
+	err = auditService.Record(user, auditService.UserErase, auditService.EntityUser, request.UserID,
+		map[string]string{"Status": request.Status},
+		map[string]interface{}{"Status": userService.ErasureCompleted, "Reason": reason, "Bookings": len(bookingIDs), "Drivers": len(driverIDs)})
+	if err != nil {
+		return err
+	}
+
+	err = auditService.Record(user, auditService.AuditRedact, auditService.EntityUser, request.UserID, nil,
+		map[string]int{"ErasureRequestID": request.ID, "Entries": redacted})
+	if err != nil {
+		return err
+	}
+
+	//Documents go once the erasure is committed, any a failure leaves are logged and later removed by the retention purge
+	var deleteErr error
+	for _, prefix := range prefixes {
+		err = storage.DeletePrefix(prefix)
+		if err != nil {
+			log.Printf("erasure of user %v failed to delete documents %v - err: %v", request.UserID, prefix, err)
+			deleteErr = err
+		}
+	}
+
+	return deleteErr
+}
+
+const (
+	defaultImpersonationMinutes = 15
+	maxImpersonationMinutes     = 60
+)
+
+// StartImpersonation creates a time-limited session that lets the admin see the site as a customer.
+// Sessions are read-only unless the admin also holds ImpersonateWrite, and every request made with
+// the returned session token is recorded against both users in the audit log. API keys can't start
+// one, the session token returned would act without the key's scopes
+func StartImpersonation(user *data.User, userID, minutes, readOnly string) (*data.OutputUser, error) {
+
+	if user.APIKeyID != 0 {
+		return nil, authorisation.KeyNotAllowed
+	}
+
+	userIDValue, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	minutesValue := defaultImpersonationMinutes
+	if minutes != "" {
+		minutesValue, err = strconv.Atoi(minutes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if minutesValue < 1 || minutesValue > maxImpersonationMinutes {
+		return nil, errors.New("impersonation duration out of bound")
+	}
+
+	readOnlyBool := true
+	if readOnly != "" {
+		readOnlyBool, err = strconv.ParseBool(readOnly)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !readOnlyBool && !authorisation.Can(user, roles.ImpersonateWrite) {
+		return nil, errors.New("user does not have permission " + string(roles.ImpersonateWrite))
+	}
+
+	target, err := db.SelectUserByID(userIDValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if roles.IsStaff(target.Role) {
+		return nil, errors.New("cannot impersonate staff")
+	}
+	if target.Disabled {
+		return nil, errors.New("cannot impersonate a disabled user")
+	}
+
+	token := session.NewImpersonation(target, user.ID, time.Duration(minutesValue)*time.Minute, readOnlyBool)
+
+	err = auditService.Record(user, auditService.UserImpersonate, auditService.EntityUser, target.ID, nil,
+		map[string]interface{}{"Minutes": minutesValue, "ReadOnly": readOnlyBool})
+	if err != nil {
+		if bag, bagErr := session.GetByToken(token); bagErr == nil {
+			session.Delete(bag)
+		}
+		return nil, err
+	}
+
+	target.SessionToken = token
+	target.ImpersonatorID = user.ID
+	target.ReadOnly = readOnlyBool
+
+	return data.NewOutputUser(target), nil
+}
+
+func GetOutboxStatus(user *data.User, status, limit string) (*data.OutboxStatus, error) {
+
+	limitValue := 50
+	var err error
+	if limit != "" {
+		limitValue, err = strconv.Atoi(limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if limitValue < 1 || limitValue > 500 {
+		return nil, errors.New("limit out of bound")
+	}
+
+	return notification.GetOutboxStatus(status, limitValue)
+}
+
+// GetDVLAStatus describes the DVLA dataset licences are currently checked against
+func GetDVLAStatus(user *data.User) *data.DatasetStatus {
+	return DVLADataProvider.GetStatus()
+}
+
+// RetryNotification queues a permanently failed notification to be sent again
+func RetryNotification(user *data.User, messageID string) error {
+
+	messageIDValue, err := strconv.Atoi(messageID)
+	if err != nil {
+		return err
+	}
+
+	err = notification.Retry(messageIDValue)
+	if err != nil {
+		return err
+	}
+
+	return auditService.Record(user, auditService.NotificationRetry, auditService.EntityNotification, messageIDValue, nil, nil)
 }
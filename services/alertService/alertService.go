@@ -0,0 +1,309 @@
+package alertService
+
+import (
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"carHiringWebsite/notification"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DVLA = "DVLA"
+	ABI  = "ABI"
+
+	InvalidLicense  = "invalid licence"
+	FraudulentClaim = "fraudulent insurance claim"
+
+	DVLATemplate = "dvlaOffence"
+	ABITemplate  = "abiFraud"
+
+	// referencePrefix starts the reference alert emails are sent with, followed by the alert ID
+	referencePrefix = "alert"
+
+	defaultLimit = 50
+	maxLimit     = 500
+	exportLimit  = 100000
+)
+
+// Authority settings, set from command line flags in main
+var (
+	DVLAAddress   *string
+	DVLAReference *string
+	ABIAddress    *string
+	ABIReference  *string
+)
+
+var (
+	UnknownAuthority = errors.New("unknown authority")
+	UnknownAlert     = errors.New("unknown alert")
+)
+
+// authority is a regulator alerts are sent to. reference is the company reference the authority knows
+// us by, falling back to the company reference when not set
+type authority struct {
+	name      string
+	template  string
+	address   *string
+	reference *string
+}
+
+func getAuthority(name string) (*authority, error) {
+	switch strings.ToUpper(name) {
+	case DVLA:
+		return &authority{name: DVLA, template: DVLATemplate, address: DVLAAddress, reference: DVLAReference}, nil
+	case ABI:
+		return &authority{name: ABI, template: ABITemplate, address: ABIAddress, reference: ABIReference}, nil
+	}
+
+	return nil, UnknownAuthority
+}
+
+// reportColumns is the CSV header, in the order csvRow writes the values
+var reportColumns = []string{"AlertID", "Authority", "Offence", "Company", "CompanyReference", "Branch", "BranchAddress",
+	"BranchPhone", "DriverID", "LicenseNumber", "LastName", "Names", "DOB", "Address", "PostCode", "BookingID", "Occurred"}
+
+func csvRow(report *data.AlertReport) []string {
+	return []string{
+		strconv.Itoa(report.AlertID),
+		report.Authority,
+		report.Offence,
+		report.Company,
+		report.CompanyReference,
+		report.Branch,
+		report.BranchAddress,
+		report.BranchPhone,
+		strconv.Itoa(report.DriverID),
+		report.LicenseNumber,
+		report.LastName,
+		report.Names,
+		report.DOB,
+		report.Address,
+		report.PostCode,
+		strconv.Itoa(report.BookingID),
+		report.Occurred.UTC().Format(time.RFC3339),
+	}
+}
+
+// Raise sends the authority an alert about the driver, rendered from the authority's template with the
+// report attached as JSON and CSV. An offence on a booking is only reported once to each authority, raising
+// it again returns the original alert ID
+func Raise(user *data.User, authorityName, offence string, driverID, bookingID int) (int, error) {
+
+	authority, err := getAuthority(authorityName)
+	if err != nil {
+		return 0, err
+	}
+
+	driver, err := db.GetDriverByID(driverID)
+	if err != nil {
+		return 0, err
+	}
+
+	sender := notification.GetSender()
+
+	reference := *authority.reference
+	if reference == "" {
+		reference = sender.Reference
+	}
+
+	raisedBy := 0
+	if user != nil {
+		raisedBy = user.ID
+	}
+
+	report := &data.AlertReport{
+		Authority:        authority.name,
+		Offence:          offence,
+		Company:          sender.Company,
+		CompanyReference: reference,
+		Branch:           sender.Branch,
+		BranchAddress:    sender.BranchAddress,
+		BranchPhone:      sender.BranchPhone,
+		DriverID:         driver.ID,
+		LicenseNumber:    driver.LicenseNumber,
+		LastName:         driver.LastName,
+		Names:            driver.Names,
+		DOB:              driver.DOB.Format("2006-01-02"),
+		Address:          driver.Address,
+		PostCode:         driver.PostCode,
+		BookingID:        bookingID,
+		Occurred:         time.Now(),
+	}
+
+	key := authority.template + ":" + strconv.Itoa(driver.ID) + ":" + strconv.Itoa(bookingID)
+
+	alertID, err := db.InsertRegulatoryAlert(key, &data.RegulatoryAlert{
+		Authority: authority.name,
+		Offence:   offence,
+		DriverID:  driver.ID,
+		BookingID: bookingID,
+		RaisedBy:  raisedBy,
+		Report:    report,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	//Already queued by an earlier call, an alert without an outbox message failed to queue and is tried again
+	alert, err := db.GetRegulatoryAlert(alertID)
+	if err != nil {
+		return 0, err
+	}
+	if alert.OutboxID != 0 {
+		return alertID, nil
+	}
+
+	report.AlertID = alertID
+
+	attachments, err := reportAttachments(report)
+	if err != nil {
+		return 0, err
+	}
+
+	outboxID, err := notification.EnqueueWithAttachments(key, authority.template, Reference(alertID),
+		[]string{*authority.address}, report, attachments)
+	if err != nil {
+		return 0, err
+	}
+
+	return alertID, db.SetRegulatoryAlertSent(alertID, outboxID, report)
+}
+
+// Reference is the reference the alert's email is sent with, and the file notifier names it by
+func Reference(alertID int) string {
+	return referencePrefix + strconv.Itoa(alertID)
+}
+
+// reportAttachments returns the report as JSON and CSV files named after the authority and alert ID
+func reportAttachments(report *data.AlertReport) ([]notification.Attachment, error) {
+
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var reportCSV strings.Builder
+	err = writeCSV(&reportCSV, []*data.AlertReport{report})
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(report.Authority) + "_alert_" + strconv.Itoa(report.AlertID)
+
+	return []notification.Attachment{
+		{Name: name + ".json", ContentType: "application/json", Content: reportJSON},
+		{Name: name + ".csv", ContentType: "text/csv", Content: []byte(reportCSV.String())},
+	}, nil
+}
+
+func writeCSV(writer io.Writer, reports []*data.AlertReport) error {
+
+	csvWriter := csv.NewWriter(writer)
+
+	err := csvWriter.Write(reportColumns)
+	if err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		err = csvWriter.Write(csvRow(report))
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
+
+func GetAlerts(user *data.User, authorityName, limit string) ([]*data.RegulatoryAlert, error) {
+
+	authorityValue, err := parseAuthority(authorityName)
+	if err != nil {
+		return nil, err
+	}
+
+	limitValue := defaultLimit
+	if limit != "" {
+		limitValue, err = strconv.Atoi(limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if limitValue < 1 || limitValue > maxLimit {
+		return nil, errors.New("limit out of bound")
+	}
+
+	return db.GetRegulatoryAlerts(authorityValue, limitValue)
+}
+
+func GetAlert(user *data.User, alertID string) (*data.RegulatoryAlert, error) {
+
+	alertIDValue, err := strconv.Atoi(alertID)
+	if err != nil {
+		return nil, err
+	}
+
+	alert, err := db.GetRegulatoryAlert(alertIDValue)
+	if err != nil {
+		return nil, err
+	}
+	if alert == nil {
+		return nil, UnknownAlert
+	}
+
+	return alert, nil
+}
+
+// ExportCSV writes the report of every alert sent, optionally to one authority, to writer as CSV
+func ExportCSV(user *data.User, writer io.Writer, authorityName string) error {
+
+	authorityValue, err := parseAuthority(authorityName)
+	if err != nil {
+		return err
+	}
+
+	alerts, err := db.GetRegulatoryAlerts(authorityValue, exportLimit)
+	if err != nil {
+		return err
+	}
+
+	reports := make([]*data.AlertReport, len(alerts))
+	for i, alert := range alerts {
+		reports[i] = alert.Report
+	}
+
+	return writeCSV(writer, reports)
+}
+
+// ExportAlertCSV writes the report of a single alert to writer as CSV, as attached to the email
+func ExportAlertCSV(user *data.User, writer io.Writer, alertID string) error {
+
+	alert, err := GetAlert(user, alertID)
+	if err != nil {
+		return err
+	}
+
+	return writeCSV(writer, []*data.AlertReport{alert.Report})
+}
+
+// parseAuthority returns "" for every authority or the canonical name of one
+func parseAuthority(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	authority, err := getAuthority(name)
+	if err != nil {
+		return "", err
+	}
+
+	return authority.name, nil
+}
@@ -0,0 +1,182 @@
+package apiKeyService
+
+import (
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"carHiringWebsite/hash"
+	"carHiringWebsite/roles"
+	"carHiringWebsite/services/auditService"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EntityAPIKey = "apiKey"
+
+	defaultExpiryDays = 90
+	maxExpiryDays     = 365
+	prefixLength      = 8
+	lastUsedInterval  = time.Minute
+)
+
+var (
+	InvalidKey = errors.New("invalid api key")
+	ExpiredKey = errors.New("api key expired")
+	RevokedKey = errors.New("api key revoked")
+)
+
+// Create issues a new key for user limited to scopes, which must all be permissions the user holds.
+// The returned key is the only time the secret is available, only its hash is stored
+func Create(user *data.User, name, scopes, expiryDays string) (*data.APIKey, error) {
+
+	if user.APIKeyID != 0 {
+		return nil, errors.New("api keys cannot create keys")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return nil, errors.New("invalid key name")
+	}
+
+	days := defaultExpiryDays
+	var err error
+	if expiryDays != "" {
+		days, err = strconv.Atoi(expiryDays)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if days < 1 || days > maxExpiryDays {
+		return nil, errors.New("expiry out of bound")
+	}
+
+	permissions := make([]roles.Permission, 0)
+	for _, scope := range strings.Split(scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+
+		permission, err := roles.ParsePermission(scope)
+		if err != nil {
+			return nil, err
+		}
+		if !roles.Has(user.Role, permission) {
+			return nil, errors.New("user does not have permission " + scope)
+		}
+
+		permissions = append(permissions, permission)
+	}
+	if len(permissions) == 0 {
+		return nil, errors.New("no scopes given")
+	}
+
+	prefix := strings.ReplaceAll(uuid.New().String(), "-", "")[:prefixLength]
+	secret := strings.ReplaceAll(uuid.New().String(), "-", "")
+
+	keyHash, err := hash.Get(prefix, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().AddDate(0, 0, days)
+
+	keyID, err := db.InsertAPIKey(name, prefix, keyHash, permissions, user.ID, expires)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := db.GetAPIKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = auditService.Record(user, auditService.APIKeyCreate, EntityAPIKey, keyID, nil,
+		map[string]interface{}{"Name": name, "Prefix": prefix, "Scopes": permissions, "Expires": expires})
+	if err != nil {
+		return nil, err
+	}
+
+	key.Key = prefix + "." + secret
+
+	return key, nil
+}
+
+func GetAll(user *data.User) ([]*data.APIKey, error) {
+
+	keys, err := db.GetAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Revoke disables a key. Keys are checked against the database on every request so this applies immediately
+func Revoke(user *data.User, keyID string) error {
+
+	keyIDValue, err := strconv.Atoi(keyID)
+	if err != nil {
+		return err
+	}
+
+	key, err := db.GetAPIKey(keyIDValue)
+	if err != nil {
+		return err
+	}
+
+	err = db.RevokeAPIKey(key.ID)
+	if err != nil {
+		return err
+	}
+
+	return auditService.Record(user, auditService.APIKeyRevoke, EntityAPIKey, key.ID, nil, nil)
+}
+
+// Validate checks a key sent by a client and returns its stored record, recording when it was last used
+func Validate(rawKey string) (*data.APIKey, error) {
+
+	parts := strings.SplitN(rawKey, ".", 2)
+	if len(parts) != 2 || len(parts[0]) != prefixLength || parts[1] == "" {
+		return nil, InvalidKey
+	}
+
+	key, err := db.GetAPIKeyByPrefix(parts[0])
+	if err == sql.ErrNoRows {
+		return nil, InvalidKey
+	} else if err != nil {
+		return nil, err
+	}
+
+	keyHash, err := hash.Get(parts[0], parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(keyHash), []byte(key.KeyHash)) != 1 {
+		return nil, InvalidKey
+	}
+
+	if !key.Revoked.IsZero() {
+		return nil, RevokedKey
+	}
+	now := time.Now()
+	if now.After(key.Expires.Time) {
+		return nil, ExpiredKey
+	}
+
+	//Only write last used once a minute so a busy script doesn't update the row on every request
+	if now.Sub(key.LastUsed.Time) > lastUsedInterval {
+		err = db.SetAPIKeyLastUsed(key.ID, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
@@ -0,0 +1,238 @@
+package auditService
+
+import (
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	UserCreate    = "user.create"
+	UserEdit      = "user.edit"
+	UserDisable   = "user.disable"
+	UserBlacklist = "user.blacklist"
+	UserRole      = "user.role"
+
+	UserIdentityLink = "user.identityLink"
+
+	UserNotificationPreferences = "user.notificationPreferences"
+	UserUnsubscribe             = "user.unsubscribe"
+	UserPhone                   = "user.phone"
+
+	UserExport         = "user.export"
+	UserErasureRequest = "user.erasureRequest"
+	UserErase          = "user.erase"
+
+	AuditRedact = "audit.redact"
+
+	UserImpersonate      = "user.impersonate"
+	ImpersonationRequest = "impersonation.request"
+
+	APIKeyCreate = "apiKey.create"
+	APIKeyRevoke = "apiKey.revoke"
+
+	CarCreate = "car.create"
+	CarUpdate = "car.update"
+
+	CarImageAdd     = "car.imageAdd"
+	CarImageUpdate  = "car.imageUpdate"
+	CarImageReorder = "car.imageReorder"
+	CarImageDelete  = "car.imageDelete"
+
+	DriverVerify        = "driver.verify"
+	DriverReviewOpen    = "driverReview.open"
+	DriverReviewResolve = "driverReview.resolve"
+
+	DriverBlacklistRemove = "driver.blacklistRemove"
+
+	NotificationRetry = "notification.retry"
+
+	DatasetUpload   = "dataset.upload"
+	DatasetActivate = "dataset.activate"
+	DatasetRollback = "dataset.rollback"
+
+	LegalHoldPlace   = "legalHold.place"
+	LegalHoldRelease = "legalHold.release"
+	RetentionPurge   = "retention.purge"
+
+	BookingCreate       = "booking.create"
+	BookingPayment      = "booking.payment"
+	BookingExtPayment   = "booking.extensionPayment"
+	BookingCancel       = "booking.cancel"
+	BookingEdit         = "booking.edit"
+	BookingExtend       = "booking.extend"
+	BookingProgress     = "booking.progress"
+	BookingRefund       = "booking.refund"
+	BookingExtraPayment = "booking.extraPayment"
+)
+
+const (
+	EntityUser    = "user"
+	EntityCar     = "car"
+	EntityBooking = "booking"
+	EntityDriver  = "driver"
+
+	EntityNotification = "notification"
+	EntityDataset      = "dataset"
+	EntityDriverReview = "driverReview"
+	EntityLegalHold    = "legalHold"
+	EntityPurgeReport  = "purgeReport"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+	exportLimit  = 100000
+)
+
+// Record appends an entry to the audit log. before and after are stored as JSON so any value
+// can be captured, a nil actor is recorded as the system (ID 0)
+func Record(actor *data.User, action, entityType string, entityID int, before, after interface{}) error {
+
+	actorID := 0
+	impersonatorID := 0
+	remoteAddr := ""
+	if actor != nil {
+		actorID = actor.ID
+		impersonatorID = actor.ImpersonatorID
+		remoteAddr = actor.RemoteAddr
+	}
+
+	beforeJSON, err := marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := marshal(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.InsertAuditEntry(actorID, impersonatorID, action, entityType, entityID, beforeJSON, afterJSON, remoteAddr)
+
+	return err
+}
+
+func marshal(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes), nil
+}
+
+func GetEntries(user *data.User, actorID, action, entityType, entityID, from, to, limit string) ([]*data.AuditEntry, error) {
+
+	filter, err := parseFilter(actorID, action, entityType, entityID, from, to, limit, maxLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetAuditEntries(filter)
+}
+
+// ExportCSV writes every entry matching the filters to writer as CSV, newest first
+func ExportCSV(user *data.User, writer io.Writer, actorID, action, entityType, entityID, from, to string) error {
+
+	filter, err := parseFilter(actorID, action, entityType, entityID, from, to, strconv.Itoa(exportLimit), exportLimit)
+	if err != nil {
+		return err
+	}
+
+	entries, err := db.GetAuditEntries(filter)
+	if err != nil {
+		return err
+	}
+
+	csvWriter := csv.NewWriter(writer)
+
+	err = csvWriter.Write([]string{"ID", "Created", "ActorID", "ActorEmail", "ImpersonatorID", "IP", "Action", "EntityType", "EntityID", "Before", "After", "Redacted"})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err = csvWriter.Write([]string{
+			strconv.Itoa(entry.ID),
+			entry.Created.UTC().Format(time.RFC3339),
+			strconv.Itoa(entry.ActorID),
+			entry.ActorEmail,
+			strconv.Itoa(entry.ImpersonatorID),
+			entry.IP,
+			entry.Action,
+			entry.EntityType,
+			strconv.Itoa(entry.EntityID),
+			entry.Before,
+			entry.After,
+			strconv.FormatBool(entry.Redacted),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
+
+func parseFilter(actorID, action, entityType, entityID, from, to, limit string, max int) (*data.AuditFilter, error) {
+	var err error
+
+	filter := &data.AuditFilter{
+		Action:     action,
+		EntityType: entityType,
+		Limit:      defaultLimit,
+	}
+
+	if actorID != "" {
+		filter.ActorID, err = strconv.Atoi(actorID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if entityID != "" {
+		filter.EntityID, err = strconv.Atoi(entityID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if from != "" {
+		fromUnix, err := strconv.ParseInt(from, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		filter.From = time.Unix(fromUnix, 0)
+	}
+
+	if to != "" {
+		toUnix, err := strconv.ParseInt(to, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		filter.To = time.Unix(toUnix, 0)
+	}
+
+	if limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if filter.Limit < 1 || filter.Limit > max {
+		return nil, errors.New("limit out of bound")
+	}
+
+	return filter, nil
+}
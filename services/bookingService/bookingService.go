@@ -4,6 +4,8 @@ import (
 	"carHiringWebsite/VehicleScanner"
 	"carHiringWebsite/data"
 	"carHiringWebsite/db"
+	"carHiringWebsite/roles"
+	"carHiringWebsite/services/auditService"
 	"carHiringWebsite/services/userService"
 	"errors"
 	"fmt"
@@ -38,16 +40,12 @@ const (
 	ExtensionPaymentAccepted
 	DVLACheck
 	ABICheck
+	DriverReview
 )
 
-func Create(token, start, end, carID, late, fullDay, accessories, days string) (*data.Booking, error) {
+func Create(user *data.User, start, end, carID, late, fullDay, accessories, days string) (*data.Booking, error) {
 	var finishString string
 
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
 	dbUser, err := db.SelectUserByID(user.ID)
 	if err != nil {
 		return nil, err
@@ -201,15 +199,15 @@ func Create(token, start, end, carID, late, fullDay, accessories, days string) (
 	booking.CarData = car
 	booking.Accessories = bookingAccesories
 
-	return booking, nil
-}
-
-func MakePayment(token, bookingID string) error {
-	user, err := userService.GetUserFromSession(token)
+	err = auditService.Record(user, auditService.BookingCreate, auditService.EntityBooking, booking.ID, nil, booking)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	return booking, nil
+}
+
+func MakePayment(user *data.User, bookingID string) error {
 	bookingIDValid, err := strconv.Atoi(bookingID)
 	if err != nil {
 		return err
@@ -261,15 +259,12 @@ func MakePayment(token, bookingID string) error {
 		return err
 	}
 
-	return nil
+	return auditService.Record(user, auditService.BookingPayment, auditService.EntityBooking, booking.ID,
+		map[string]float64{"AmountPaid": booking.AmountPaid},
+		map[string]float64{"AmountPaid": booking.AmountPaid + amountDue})
 }
 
-func MakeExtensionPayment(token, bookingID string) error {
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return err
-	}
-
+func MakeExtensionPayment(user *data.User, bookingID string) error {
 	bookingIDValid, err := strconv.Atoi(bookingID)
 	if err != nil {
 		return err
@@ -316,15 +311,12 @@ func MakeExtensionPayment(token, bookingID string) error {
 		return err
 	}
 
-	return nil
+	return auditService.Record(user, auditService.BookingExtPayment, auditService.EntityBooking, booking.ID,
+		map[string]float64{"AmountPaid": booking.AmountPaid},
+		map[string]float64{"AmountPaid": booking.TotalCost})
 }
 
-func GetDriver(token, driverID string) (*data.Driver, error) {
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
+func GetDriver(user *data.User, driverID string) (*data.Driver, error) {
 	driverIDValid, err := strconv.Atoi(driverID)
 	if err != nil {
 		return nil, err
@@ -346,12 +338,7 @@ func GetDriver(token, driverID string) (*data.Driver, error) {
 	return driver, nil
 }
 
-func GetUsersBookings(token string) (map[int][]*data.Booking, error) {
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
+func GetUsersBookings(user *data.User) (map[int][]*data.Booking, error) {
 	bookings, err := db.GetUsersBookings(user.ID)
 	if err != nil {
 		return nil, err
@@ -363,12 +350,7 @@ func GetUsersBookings(token string) (map[int][]*data.Booking, error) {
 	return organiseBookings(bookings)
 }
 
-func CountExtensionDays(token string, bookingID string) (*data.ExtensionResponse, error) {
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
+func CountExtensionDays(user *data.User, bookingID string) (*data.ExtensionResponse, error) {
 	bookingIDValid, err := strconv.Atoi(bookingID)
 	if err != nil {
 		return nil, err
@@ -379,7 +361,7 @@ func CountExtensionDays(token string, bookingID string) (*data.ExtensionResponse
 		return nil, err
 	}
 
-	if booking.UserID != user.ID && !user.Admin {
+	if booking.UserID != user.ID && !roles.Has(user.Role, roles.BookingView) {
 		return nil, errors.New("booking does not belong to user")
 	}
 
@@ -413,13 +395,9 @@ func organiseBookings(bookings []*data.Booking) (map[int][]*data.Booking, error)
 	return organisedBookings, nil
 }
 
-func CancelBooking(token, bookingID string) error {
+func CancelBooking(user *data.User, bookingID string) error {
 	adminID := 0
 	cancelMsg := "User canceled booking"
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return err
-	}
 
 	bookingIDValid, err := strconv.Atoi(bookingID)
 	if err != nil {
@@ -431,9 +409,11 @@ func CancelBooking(token, bookingID string) error {
 		return err
 	}
 
-	if user.ID != booking.UserID && !user.Admin {
+	canEdit := roles.Has(user.Role, roles.BookingEdit)
+
+	if user.ID != booking.UserID && !canEdit {
 		return errors.New("this booking does not belong to this user")
-	} else if user.Admin {
+	} else if canEdit {
 		adminID = user.ID
 		cancelMsg = "Admin canceled booking"
 	}
@@ -441,7 +421,7 @@ func CancelBooking(token, bookingID string) error {
 	if booking.ProcessID == CanceledBooking {
 		return errors.New("booking already canceled")
 	}
-	if booking.ProcessID > BookingConfirmed && !user.Admin {
+	if booking.ProcessID > BookingConfirmed && !canEdit {
 		return errors.New("booking can only be canceled by an admin after collection")
 	}
 
@@ -463,15 +443,12 @@ func CancelBooking(token, bookingID string) error {
 		return err
 	}
 
-	return nil
+	return auditService.Record(user, auditService.BookingCancel, auditService.EntityBooking, booking.ID,
+		map[string]int{"ProcessID": booking.ProcessID},
+		map[string]int{"ProcessID": CanceledBooking})
 }
 
-func GetHistory(token, bookingID string) ([]*data.BookingStatus, error) {
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return nil, err
-	}
-
+func GetHistory(user *data.User, bookingID string) ([]*data.BookingStatus, error) {
 	bookingIDValid, err := strconv.Atoi(bookingID)
 	if err != nil {
 		return nil, err
@@ -482,7 +459,7 @@ func GetHistory(token, bookingID string) ([]*data.BookingStatus, error) {
 		return nil, err
 	}
 
-	if user.ID != booking.UserID && !user.Admin {
+	if user.ID != booking.UserID && !roles.Has(user.Role, roles.BookingView) {
 		return nil, errors.New("this booking does not belong to this user")
 	}
 
@@ -491,14 +468,9 @@ func GetHistory(token, bookingID string) ([]*data.BookingStatus, error) {
 	return history, err
 }
 
-func ExtendBooking(token, bookingID, lateReturn, fullDay, days string) error {
+func ExtendBooking(user *data.User, bookingID, lateReturn, fullDay, days string) error {
 	adminID := 0
 
-	user, err := userService.GetUserFromSession(token)
-	if err != nil {
-		return err
-	}
-
 	bookingIDValid, err := strconv.Atoi(bookingID)
 	if err != nil {
 		return err
@@ -509,9 +481,11 @@ func ExtendBooking(token, bookingID, lateReturn, fullDay, days string) error {
 		return err
 	}
 
-	if user.ID != booking.UserID && !user.Admin {
+	canEdit := roles.Has(user.Role, roles.BookingEdit)
+
+	if user.ID != booking.UserID && !canEdit {
 		return errors.New("this booking does not belong to this user")
-	} else if user.Admin {
+	} else if canEdit {
 		adminID = user.ID
 	}
 
@@ -623,10 +597,12 @@ func ExtendBooking(token, bookingID, lateReturn, fullDay, days string) error {
 		return err
 	}
 
-	return err
+	return auditService.Record(user, auditService.BookingExtend, auditService.EntityBooking, booking.ID,
+		map[string]interface{}{"TotalCost": booking.TotalCost, "BookingLength": booking.BookingLength, "End": booking.End.Unix(), "LateReturn": booking.LateReturn, "FullDay": booking.FullDay},
+		map[string]interface{}{"TotalCost": newCost, "BookingLength": newDaysValue, "End": newEndDate.Unix(), "LateReturn": lateReturnValue, "FullDay": fullDayValue})
 }
 
-func EditBooking(token, bookingID, remove, add, lateReturn, fullDay string) error {
+func EditBooking(user *data.User, bookingID, remove, add, lateReturn, fullDay string) error {
 	adminID := 0
 	edited := false
 	var description string
@@ -634,8 +610,6 @@ func EditBooking(token, bookingID, remove, add, lateReturn, fullDay string) erro
 	var amountDue float64
 	var finishString string
 
-	user, err := userService.GetUserFromSession(token)
-
 	bookingIDValid, err := strconv.Atoi(bookingID)
 	if err != nil {
 		return err
@@ -646,9 +620,11 @@ func EditBooking(token, bookingID, remove, add, lateReturn, fullDay string) erro
 		return err
 	}
 
-	if user.ID != booking.UserID && !user.Admin {
+	canEdit := roles.Has(user.Role, roles.BookingEdit)
+
+	if user.ID != booking.UserID && !canEdit {
 		return errors.New("this booking does not belong to this user")
-	} else if user.Admin {
+	} else if canEdit {
 		adminID = user.ID
 	}
 
@@ -787,6 +763,13 @@ func EditBooking(token, bookingID, remove, add, lateReturn, fullDay string) erro
 			return err
 		}
 
+		err = auditService.Record(user, auditService.BookingEdit, auditService.EntityBooking, booking.ID,
+			map[string]interface{}{"TotalCost": booking.TotalCost, "BookingLength": booking.BookingLength, "LateReturn": booking.LateReturn, "FullDay": booking.FullDay},
+			map[string]interface{}{"TotalCost": newCost, "BookingLength": days, "LateReturn": lateReturnValue, "FullDay": fullDayValue, "Description": description})
+		if err != nil {
+			return err
+		}
+
 		if booking.ProcessID != AwaitingPayment {
 			status, err := db.GetBookingProcessStatus(booking.ID, EditAwaitingPayment)
 			if err != nil {
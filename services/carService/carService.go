@@ -1,11 +1,16 @@
 package carService
 
 import (
+	"bytes"
 	"carHiringWebsite/VehicleScanner"
 	"carHiringWebsite/data"
 	"carHiringWebsite/db"
+	"carHiringWebsite/imaging"
+	"carHiringWebsite/storage"
 	"errors"
+	"io/ioutil"
 	"log"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -17,6 +22,10 @@ func GetAllCars(fuelTypes, gearTypes, carTypes, carSizes, colours, search string
 		return nil, err
 	}
 
+	for _, car := range cars {
+		SetImages(car)
+	}
+
 	return cars, nil
 }
 
@@ -30,6 +39,12 @@ func GetCar(id string) (*data.Car, error) {
 		return nil, errors.New("car disabled")
 	}
 
+	SetImages(car)
+	err = SetPhotos(car)
+	if err != nil {
+		return nil, err
+	}
+
 	price, err := VehicleScanner.GetVehiclePrice(car.CarType.ID, car.Size.ID, time.Now().Add(time.Hour*24), time.Now().Add(time.Hour*24*2))
 	if err != nil {
 		log.Printf("failed to scan vehicle price for id: %d", id)
@@ -42,6 +57,103 @@ func GetCar(id string) (*data.Car, error) {
 	return car, nil
 }
 
+// SetImages sets the URLs of the car's primary image at each size
+func SetImages(car *data.Car) {
+	car.Images = ImageURLs(car.Image)
+}
+
+// SetPhotos sets the car's photos, in order, with the URLs of each at each size
+func SetPhotos(car *data.Car) error {
+
+	photos, err := db.GetCarImages(car.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, photo := range photos {
+		photo.Images = ImageURLs(photo.FileName)
+	}
+	car.Photos = photos
+
+	return nil
+}
+
+// ImageURLs returns the URLs of the car image file at each size, served from the site's cars route
+func ImageURLs(fileName string) *data.ImageVariants {
+
+	imageURL := func(variant imaging.Variant) string {
+		return "/cars/" + url.PathEscape(imaging.VariantName(fileName, variant)+".jpg")
+	}
+
+	return &data.ImageVariants{
+		Full:      imageURL(imaging.Full),
+		Medium:    imageURL(imaging.Medium),
+		Thumbnail: imageURL(imaging.Thumbnail),
+	}
+}
+
+// BuildImageVariants stores the smaller sizes of car images uploaded before they were made, returning how many
+// images it resized. Images that already have every size are skipped
+func BuildImageVariants() (int, error) {
+
+	images, err := db.GetCarImageFiles()
+	if err != nil {
+		return 0, err
+	}
+
+	built := 0
+	for _, image := range images {
+		missing := make([]imaging.Variant, 0)
+		for _, variant := range imaging.CarVariants[1:] {
+			_, err := storage.Stat(storage.Cars + imaging.VariantName(image, variant) + ".jpg")
+			if err == storage.NotFound {
+				missing = append(missing, variant)
+			} else if err != nil {
+				return built, err
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		reader, err := storage.Get(storage.Cars + image + ".jpg")
+		if err == storage.NotFound {
+			log.Printf("Car image %v not found, no sizes made", image)
+			continue
+		}
+		if err != nil {
+			return built, err
+		}
+
+		content, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return built, err
+		}
+
+		img, err := imaging.Decode(content)
+		if err != nil {
+			log.Printf("Car image %v could not be read, no sizes made - err: %v", image, err)
+			continue
+		}
+
+		for _, variant := range missing {
+			content, err := imaging.EncodeJPEG(imaging.Resize(img, variant.MaxSize))
+			if err != nil {
+				return built, err
+			}
+
+			_, err = storage.Put(storage.Cars+imaging.VariantName(image, variant)+".jpg", bytes.NewReader(content))
+			if err != nil {
+				return built, err
+			}
+		}
+		built++
+	}
+
+	return built, nil
+}
+
 func GetCarAttributes() (map[string][]*data.CarAttribute, error) {
 
 	attributes, err := db.GetCarAttributes()
@@ -0,0 +1,322 @@
+package datasetService
+
+import (
+	"carHiringWebsite/ABIDataProvider"
+	"carHiringWebsite/DVLADataProvider"
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"carHiringWebsite/services/auditService"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DVLA = "dvla"
+	ABI  = "abi"
+
+	StatusValidated  = "validated"
+	StatusRefused    = "refused"
+	StatusActive     = "active"
+	StatusSuperseded = "superseded"
+
+	previewRows  = 20
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+var (
+	// MaxUploadSize is the largest dataset file accepted in bytes, set from flags in main
+	MaxUploadSize *int64
+
+	UnknownDataset    = errors.New("unknown dataset")
+	UnknownImport     = errors.New("unknown import")
+	FileTooLarge      = errors.New("file too large")
+	ImportRefused     = errors.New("import failed validation")
+	AlreadyActive     = errors.New("import already active")
+	NoPreviousVersion = errors.New("no previous version to roll back to")
+
+	// activateLock stops two activations of a dataset racing each other
+	activateLock sync.Mutex
+)
+
+// dataset is a kind of regulator data, uploaded files are kept in versions under its directory
+type dataset struct {
+	name      string
+	dir       string
+	extension func() string
+	validate  func(name string, content []byte) (interface{}, *data.ImportReport, error)
+	activate  func(content []byte) error
+}
+
+var datasets = map[string]*dataset{
+	DVLA: {
+		name: DVLA,
+		dir:  "./DVLAfiles/",
+		extension: func() string {
+			return ".csv"
+		},
+		validate: func(name string, content []byte) (interface{}, *data.ImportReport, error) {
+			return DVLADataProvider.Validate(name, content, previewRows)
+		},
+		activate: DVLADataProvider.Activate,
+	},
+	ABI: {
+		name:      ABI,
+		dir:       "./ABIfiles/",
+		extension: ABIDataProvider.Extension,
+		validate: func(name string, content []byte) (interface{}, *data.ImportReport, error) {
+			report, err := ABIDataProvider.Validate(name, content)
+			return nil, report, err
+		},
+		activate: ABIDataProvider.Activate,
+	},
+}
+
+func getDataset(name string) (*dataset, error) {
+	ds, ok := datasets[strings.ToLower(name)]
+	if !ok {
+		return nil, UnknownDataset
+	}
+
+	return ds, nil
+}
+
+// Upload validates a new version of a dataset and keeps it for activation. A file that fails validation
+// is still recorded, as refused, so the report can be seen. Nothing is activated
+func Upload(user *data.User, datasetName, fileName string, body io.Reader) (*data.DatasetPreview, error) {
+
+	ds, err := getDataset(datasetName)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName = filepath.Base(strings.TrimSpace(fileName))
+	if fileName == "." || fileName == string(filepath.Separator) || fileName == "" {
+		fileName = ds.name + ds.extension()
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(body, *MaxUploadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > *MaxUploadSize {
+		return nil, FileTooLarge
+	}
+
+	preview, report, validateErr := ds.validate(fileName, content)
+
+	status := StatusValidated
+	if validateErr != nil {
+		status = StatusRefused
+	}
+
+	sum := sha256.Sum256(content)
+
+	datasetImport := &data.DatasetImport{
+		Dataset:    ds.name,
+		FileName:   fileName,
+		Hash:       hex.EncodeToString(sum[:]),
+		Size:       int64(len(content)),
+		Status:     status,
+		Report:     report,
+		UploadedBy: user.ID,
+		Uploaded:   *data.ConvertDate(time.Now()),
+	}
+
+	importID, err := db.InsertDatasetImport(datasetImport)
+	if err != nil {
+		return nil, err
+	}
+	datasetImport.ID = importID
+
+	//Stored under the import ID so the original name can't clash or escape the directory
+	versionDir := filepath.Join(ds.dir, "versions")
+	err = os.MkdirAll(versionDir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	datasetImport.StoredFile = filepath.Join(versionDir, strconv.Itoa(importID)+ds.extension())
+	err = ioutil.WriteFile(datasetImport.StoredFile, content, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.SetStoredFile(importID, datasetImport.StoredFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = auditService.Record(user, auditService.DatasetUpload, auditService.EntityDataset, importID, nil,
+		map[string]interface{}{"Dataset": ds.name, "FileName": fileName, "Hash": datasetImport.Hash, "Status": status,
+			"Accepted": report.Accepted, "Rejected": report.Rejected})
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.DatasetPreview{Import: datasetImport, Preview: preview}, nil
+}
+
+func GetImports(user *data.User, datasetName, limit string) ([]*data.DatasetImport, error) {
+
+	ds, err := getDataset(datasetName)
+	if err != nil {
+		return nil, err
+	}
+
+	limitValue := defaultLimit
+	if limit != "" {
+		limitValue, err = strconv.Atoi(limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if limitValue < 1 || limitValue > maxLimit {
+		return nil, errors.New("limit out of bound")
+	}
+
+	return db.GetDatasetImports(ds.name, limitValue)
+}
+
+// Preview validates a stored upload again, returning its report and first records
+func Preview(user *data.User, importID string) (*data.DatasetPreview, error) {
+
+	datasetImport, ds, content, err := readImport(importID)
+	if err != nil {
+		return nil, err
+	}
+
+	preview, _, _ := ds.validate(datasetImport.FileName, content)
+
+	return &data.DatasetPreview{Import: datasetImport, Preview: preview}, nil
+}
+
+// Activate makes a validated or superseded upload the dataset checks are made against
+func Activate(user *data.User, importID string) (*data.DatasetImport, error) {
+
+	datasetImport, ds, content, err := readImport(importID)
+	if err != nil {
+		return nil, err
+	}
+
+	if datasetImport.Status == StatusActive {
+		return nil, AlreadyActive
+	}
+
+	err = activate(user, ds, datasetImport, content)
+	if err != nil {
+		return nil, err
+	}
+
+	err = auditService.Record(user, auditService.DatasetActivate, auditService.EntityDataset, datasetImport.ID, nil,
+		map[string]interface{}{"Dataset": ds.name, "Hash": datasetImport.Hash})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetDatasetImport(datasetImport.ID)
+}
+
+// Rollback activates the version of the dataset that was active before the current one
+func Rollback(user *data.User, datasetName string) (*data.DatasetImport, error) {
+
+	ds, err := getDataset(datasetName)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := db.GetPreviousDatasetImport(ds.name)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return nil, NoPreviousVersion
+	}
+
+	datasetImport, _, content, err := readImport(strconv.Itoa(previous.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	err = activate(user, ds, datasetImport, content)
+	if err != nil {
+		return nil, err
+	}
+
+	err = auditService.Record(user, auditService.DatasetRollback, auditService.EntityDataset, datasetImport.ID, nil,
+		map[string]interface{}{"Dataset": ds.name, "Hash": datasetImport.Hash})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetDatasetImport(datasetImport.ID)
+}
+
+func activate(user *data.User, ds *dataset, datasetImport *data.DatasetImport, content []byte) error {
+	activateLock.Lock()
+	defer activateLock.Unlock()
+
+	if datasetImport.Status == StatusRefused {
+		return ImportRefused
+	}
+
+	err := ds.activate(content)
+	if errors.Is(err, DVLADataProvider.DatasetRefused) || errors.Is(err, ABIDataProvider.DatasetRefused) ||
+		err == ABIDataProvider.InvalidDatabase {
+		return ImportRefused
+	}
+	if err != nil {
+		return err
+	}
+
+	return db.ActivateDatasetImport(datasetImport.ID, user.ID, ds.name)
+}
+
+// readImport loads an import and its stored file, checking the file hasn't changed since upload
+func readImport(importID string) (*data.DatasetImport, *dataset, []byte, error) {
+
+	importIDValue, err := strconv.Atoi(importID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	datasetImport, err := db.GetDatasetImport(importIDValue)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if datasetImport == nil {
+		return nil, nil, nil, UnknownImport
+	}
+
+	ds, err := getDataset(datasetImport.Dataset)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	content, err := ioutil.ReadFile(datasetImport.StoredFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != datasetImport.Hash {
+		return nil, nil, nil, errors.New("stored dataset file has changed since upload")
+	}
+
+	return datasetImport, ds, content, nil
+}
+
+// IsUserError reports whether err should be shown to the admin rather than logged as a failure
+func IsUserError(err error) bool {
+	return err == UnknownDataset || err == UnknownImport || err == FileTooLarge || err == ImportRefused ||
+		err == AlreadyActive || err == NoPreviousVersion
+}
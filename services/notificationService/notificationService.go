@@ -0,0 +1,211 @@
+package notificationService
+
+import (
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"carHiringWebsite/notification"
+	"carHiringWebsite/services/auditService"
+	"carHiringWebsite/services/bookingService"
+	"database/sql"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// bookingNotification is the template sent when a booking reaches a status. Essential messages are
+// sent even to users who have unsubscribed, as they need them to complete or understand their booking
+type bookingNotification struct {
+	template  string
+	essential bool
+}
+
+var bookingNotifications = map[int]bookingNotification{
+	bookingService.AwaitingPayment:          {"bookingAwaitingPayment", false},
+	bookingService.PaymentAccepted:          {"bookingPaymentAccepted", true},
+	bookingService.AwaitingConfirmation:     {"bookingAwaitingConfirmation", false},
+	bookingService.BookingConfirmed:         {"bookingConfirmed", true},
+	bookingService.BookingEdited:            {"bookingEdited", true},
+	bookingService.EditAwaitingPayment:      {"bookingPaymentRequested", true},
+	bookingService.EditPaymentAccepted:      {"bookingPaymentAccepted", true},
+	bookingService.QueryingRefund:           {"bookingRefundQueried", false},
+	bookingService.RefundRejected:           {"bookingRefundRejected", true},
+	bookingService.RefundIssued:             {"bookingRefundIssued", true},
+	bookingService.CanceledBooking:          {"bookingCancelled", true},
+	bookingService.CollectedBooking:         {"bookingCollected", false},
+	bookingService.ReturnedBooking:          {"bookingReturned", false},
+	bookingService.CompletedBooking:         {"bookingCompleted", false},
+	bookingService.ExtendedBooking:          {"bookingExtended", true},
+	bookingService.ExtensionAwaitingPayment: {"bookingPaymentRequested", true},
+	bookingService.ExtensionPaymentAccepted: {"bookingPaymentAccepted", true},
+}
+
+// bookingNotice is available to booking templates as .Data
+type bookingNotice struct {
+	FirstName      string
+	Booking        *data.Booking
+	Description    string
+	Extra          float64
+	Due            time.Time
+	SiteURL        string
+	UnsubscribeURL string
+}
+
+// BookingStatusChanged queues the customers notification for a new booking status. It is registered as
+// db.BookingStatusListener so every transition is covered, failures are logged rather than failing the transition
+func BookingStatusChanged(statusID, bookingID, processID int, extra float64, description string) {
+
+	err := notifyBookingStatus(statusID, bookingID, processID, extra, description)
+	if err != nil {
+		log.Printf("BookingStatusChanged error - err: %v\nbooking: %v status: %v", err, bookingID, statusID)
+	}
+}
+
+func notifyBookingStatus(statusID, bookingID, processID int, extra float64, description string) error {
+
+	bookingNotification, ok := bookingNotifications[processID]
+	if !ok {
+		return nil
+	}
+
+	booking, err := db.GetBookingSummary(bookingID)
+	if err != nil {
+		return err
+	}
+
+	return notifyCustomer("bookingStatus:"+strconv.Itoa(statusID), bookingNotification, booking, &bookingNotice{
+		Description: description,
+		Extra:       extra,
+	})
+}
+
+// notifyCustomer queues a booking notification to the bookings owner on the channels they have chosen.
+// key identifies the notification and has the channel appended to make the outbox idempotency key
+func notifyCustomer(key string, bookingNotification bookingNotification, booking *data.Booking, notice *bookingNotice) error {
+
+	customer, err := db.SelectUserByID(booking.UserID)
+	if err != nil {
+		return err
+	}
+
+	if customer.Disabled {
+		return nil
+	}
+
+	preferences, err := GetUserPreferences(customer.ID)
+	if err != nil {
+		return err
+	}
+
+	if !bookingNotification.essential && !preferences.NonEssential {
+		return nil
+	}
+
+	notice.FirstName = customer.FirstName
+	notice.Booking = booking
+	notice.SiteURL = siteURL("/")
+	if !bookingNotification.essential {
+		notice.UnsubscribeURL = siteURL("/notificationService/unsubscribe?token=" + url.QueryEscape(preferences.UnsubscribeToken))
+	}
+
+	reference := "booking" + strconv.Itoa(booking.ID)
+
+	//Only templates with an SMS version are texted, and only when a provider is configured
+	if preferences.SMS && customer.Phone != "" && notification.SMSEnabled() && notification.HasSMS(bookingNotification.template) {
+		_, err = notification.EnqueueSMS(key+":sms", bookingNotification.template, reference, customer.Phone, notice)
+		if err != nil {
+			return err
+		}
+	}
+
+	//Essential messages always go by email too, even when the user has turned email off, as a queued text can
+	//still fail to send
+	if preferences.Email || bookingNotification.essential {
+		_, err = notification.Enqueue(key+":email", bookingNotification.template, reference, []string{customer.Email}, notice)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func siteURL(path string) string {
+	return strings.TrimSuffix(*notification.SiteURL, "/") + path
+}
+
+// GetUserPreferences returns the users preferences, storing the defaults the first time they are needed
+func GetUserPreferences(userID int) (*data.NotificationPreferences, error) {
+
+	preferences, err := db.GetNotificationPreferences(userID)
+	if err != sql.ErrNoRows {
+		return preferences, err
+	}
+
+	preferences = &data.NotificationPreferences{
+		UserID:           userID,
+		Email:            true,
+		SMS:              false,
+		NonEssential:     true,
+		UnsubscribeToken: uuid.New().String(),
+	}
+
+	err = db.SetNotificationPreferences(preferences)
+	if err != nil {
+		return nil, err
+	}
+
+	return preferences, nil
+}
+
+func GetPreferences(user *data.User) (*data.NotificationPreferences, error) {
+	return GetUserPreferences(user.ID)
+}
+
+func SetPreferences(user *data.User, email, sms, nonEssential string) (*data.NotificationPreferences, error) {
+
+	preferences, err := GetUserPreferences(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	before := *preferences
+
+	preferences.Email, err = strconv.ParseBool(email)
+	if err != nil {
+		return nil, err
+	}
+	preferences.SMS, err = strconv.ParseBool(sms)
+	if err != nil {
+		return nil, err
+	}
+	preferences.NonEssential, err = strconv.ParseBool(nonEssential)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.SetNotificationPreferences(preferences)
+	if err != nil {
+		return nil, err
+	}
+
+	err = auditService.Record(user, auditService.UserNotificationPreferences, auditService.EntityUser, user.ID, before, preferences)
+	if err != nil {
+		return nil, err
+	}
+
+	return preferences, nil
+}
+
+// Unsubscribe turns off non-essential messages for the user the token was issued to
+func Unsubscribe(token string) error {
+
+	userID, err := db.UnsubscribeNonEssential(token)
+	if err != nil {
+		return err
+	}
+
+	return auditService.Record(nil, auditService.UserUnsubscribe, auditService.EntityUser, userID, nil, nil)
+}
@@ -0,0 +1,199 @@
+package notificationService
+
+import (
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"carHiringWebsite/notification"
+	"carHiringWebsite/services/bookingService"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings, set from command line flags in main before StartReminders is called
+var (
+	// Comma separated durations before bookings.start and the return deadline to remind customers, such as "24h,2h"
+	CollectionReminders *string
+	ReturnReminders     *string
+	ReminderInterval    *time.Duration
+	// ReturnTime is how long after the start of the finish date a standard booking must be returned by.
+	// Late return and full day bookings have until the end of the end date, which is the start of finish
+	ReturnTime *time.Duration
+	// StaffAlertAddress receives overdue return alerts
+	StaffAlertAddress *string
+)
+
+var (
+	collectionReminder = bookingNotification{"bookingCollectionReminder", false}
+	returnReminder     = bookingNotification{"bookingReturnReminder", false}
+	returnOverdue      = bookingNotification{"bookingReturnOverdue", true}
+)
+
+type overdueNotice struct {
+	Booking      *data.Booking
+	Customer     *data.User
+	Due          time.Time
+	HoursOverdue int
+}
+
+// StartReminders checks for due reminders and overdue returns in the background until the process exits
+func StartReminders() error {
+
+	collectionOffsets, err := parseOffsets(*CollectionReminders)
+	if err != nil {
+		return err
+	}
+	returnOffsets, err := parseOffsets(*ReturnReminders)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			now := time.Now()
+
+			err := sendReminders(bookingService.BookingConfirmed, collectionReminder, collectionOffsets, now, collectionTime)
+			if err != nil {
+				log.Printf("collection reminder error - err: %v", err)
+			}
+
+			err = sendReminders(bookingService.CollectedBooking, returnReminder, returnOffsets, now, ReturnDeadline)
+			if err != nil {
+				log.Printf("return reminder error - err: %v", err)
+			}
+
+			err = alertOverdueReturns(now)
+			if err != nil {
+				log.Printf("overdue return alert error - err: %v", err)
+			}
+
+			time.Sleep(*ReminderInterval)
+		}
+	}()
+
+	return nil
+}
+
+// parseOffsets reads a list of durations, returned smallest first
+func parseOffsets(value string) ([]time.Duration, error) {
+	offsets := make([]time.Duration, 0)
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		offset, err := time.ParseDuration(part)
+		if err != nil {
+			return nil, err
+		}
+		if offset <= 0 {
+			return nil, errors.New("reminder offsets must be positive")
+		}
+
+		offsets = append(offsets, offset)
+	}
+
+	sort.Slice(offsets, func(i, j int) bool {
+		return offsets[i] < offsets[j]
+	})
+
+	return offsets, nil
+}
+
+func collectionTime(booking *data.Booking) time.Time {
+	return booking.Start.Time
+}
+
+// ReturnDeadline is when a collected booking becomes overdue
+func ReturnDeadline(booking *data.Booking) time.Time {
+	if booking.LateReturn || booking.FullDay {
+		return booking.Finish.Time
+	}
+
+	return booking.Finish.Add(*ReturnTime)
+}
+
+// sendReminders reminds the owner of every booking at the process whose due time is within an offset.
+// Only the smallest offset that has been reached is sent, so a booking made at short notice doesn't get
+// every reminder at once, and the outbox idempotency key stops the same reminder being sent twice
+func sendReminders(processID int, reminder bookingNotification, offsets []time.Duration, now time.Time, dueTime func(*data.Booking) time.Time) error {
+
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	bookings, err := db.GetActiveProcessBookings(processID)
+	if err != nil {
+		return err
+	}
+
+	for _, booking := range bookings {
+		due := dueTime(booking)
+		until := due.Sub(now)
+		if until <= 0 {
+			continue
+		}
+
+		for _, offset := range offsets {
+			if until > offset {
+				continue
+			}
+
+			key := reminder.template + ":" + strconv.Itoa(booking.ID) + ":" + strconv.FormatInt(due.Unix(), 10) + ":" + offset.String()
+
+			err = notifyCustomer(key, reminder, booking, &bookingNotice{Due: due})
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	return nil
+}
+
+// alertOverdueReturns warns the customer and tells staff about every collected booking past its return deadline, once per deadline
+func alertOverdueReturns(now time.Time) error {
+
+	bookings, err := db.GetActiveProcessBookings(bookingService.CollectedBooking)
+	if err != nil {
+		return err
+	}
+
+	for _, booking := range bookings {
+		due := ReturnDeadline(booking)
+		if !now.After(due) {
+			continue
+		}
+
+		key := "overdueReturn:" + strconv.Itoa(booking.ID) + ":" + strconv.FormatInt(due.Unix(), 10)
+
+		err = notifyCustomer(key, returnOverdue, booking, &bookingNotice{Due: due})
+		if err != nil {
+			return err
+		}
+
+		customer, err := db.SelectUserByID(booking.UserID)
+		if err != nil {
+			return err
+		}
+
+		_, err = notification.Enqueue(key+":staff",
+			"bookingOverdue", "booking"+strconv.Itoa(booking.ID), []string{*StaffAlertAddress}, &overdueNotice{
+				Booking:      booking,
+				Customer:     customer,
+				Due:          due,
+				HoursOverdue: int(now.Sub(due).Hours()),
+			})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,505 @@
+package retentionService
+
+import (
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"carHiringWebsite/notification"
+	"carHiringWebsite/services/alertService"
+	"carHiringWebsite/services/auditService"
+	"carHiringWebsite/services/bookingService"
+	"carHiringWebsite/storage"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Document types, each kept for its own retention period after the booking it belongs to finishes
+	TypeLicense  = "license"
+	TypeIdentity = "identity"
+	TypeEmail    = "email"
+	TypeAlert    = "alert"
+
+	// Entities a legal hold can be placed on, a user's hold covers all of their bookings
+	HoldUser    = auditService.EntityUser
+	HoldBooking = auditService.EntityBooking
+	HoldDriver  = auditService.EntityDriver
+
+	// bookingReference is how booking notifications are referenced, see notificationService
+	bookingReference = "booking"
+
+	day          = 24 * time.Hour
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Retention settings, set from command line flags in main. Periods are in days counted from the booking being
+// completed or cancelled, 0 keeps files of that type forever
+var (
+	LicenseRetention  *int
+	IdentityRetention *int
+	EmailRetention    *int
+	AlertRetention    *int
+
+	// PurgeInterval is how often the purge job runs, 0 to only purge when an admin asks. PurgeDryRun makes the
+	// scheduled job report what it would remove without removing anything
+	PurgeInterval *time.Duration
+	PurgeDryRun   *bool
+)
+
+var (
+	UnknownEntity  = errors.New("unknown legal hold entity")
+	UnknownHold    = errors.New("unknown legal hold")
+	AlreadyHeld    = errors.New("already under legal hold")
+	HoldReleased   = errors.New("legal hold already released")
+	ReasonRequired = errors.New("a reason is required")
+
+	// purging stops a scheduled run and one started by an admin overlapping
+	purging sync.Mutex
+
+	documentTypes = map[string]string{
+		"license.jpg":   TypeLicense,
+		"document1.jpg": TypeIdentity,
+		"document2.jpg": TypeIdentity,
+	}
+)
+
+// candidate is a file the purge could remove. Files with no finished booking use the time they were written
+type candidate struct {
+	file    *data.PurgedFile
+	start   time.Time
+	userID  int
+	remove  func() error
+	pending bool
+}
+
+// holds are the active legal holds by entity type and ID
+type holds map[string]map[int]bool
+
+func (h holds) covers(c *candidate) bool {
+	return h[HoldBooking][c.file.BookingID] || h[HoldDriver][c.file.DriverID] || h[HoldUser][c.userID]
+}
+
+func retention(fileType string) time.Duration {
+	periods := map[string]*int{
+		TypeLicense:  LicenseRetention,
+		TypeIdentity: IdentityRetention,
+		TypeEmail:    EmailRetention,
+		TypeAlert:    AlertRetention,
+	}
+
+	return time.Duration(*periods[fileType]) * day
+}
+
+// StartPurge runs the purge job every PurgeInterval
+func StartPurge() error {
+
+	if *PurgeInterval <= 0 {
+		log.Println("Retention purge job disabled")
+		return nil
+	}
+
+	go func() {
+		for {
+			report, err := Purge(nil, *PurgeDryRun)
+			if err != nil {
+				log.Printf("retention purge error - err: %v", err)
+			} else {
+				log.Printf("Retention purge %v: removed %v files (%v bytes), %v held, %v errors", report.ID,
+					len(report.Removed), report.Bytes, report.Held, len(report.Errors))
+			}
+
+			time.Sleep(*PurgeInterval)
+		}
+	}()
+
+	return nil
+}
+
+// Purge removes every driver document and notification email past its retention period that isn't under a legal
+// hold, and records a report of what it removed. A dry run only reports what would have been removed. Files that
+// fail to delete are listed in the report's errors and left for the next run
+func Purge(user *data.User, dryRun bool) (*data.PurgeReport, error) {
+
+	purging.Lock()
+	defer purging.Unlock()
+
+	report := &data.PurgeReport{
+		DryRun:  dryRun,
+		Removed: make([]*data.PurgedFile, 0),
+		Errors:  make([]string, 0),
+		Started: *data.ConvertDate(time.Now()),
+	}
+	if user != nil {
+		report.RanBy = user.ID
+	}
+
+	finished, err := db.GetFinishedBookings(bookingService.CompletedBooking, bookingService.CanceledBooking)
+	if err != nil {
+		return nil, err
+	}
+
+	activeHolds, err := getActiveHolds()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := documentCandidates(finished)
+	if err != nil {
+		return nil, err
+	}
+
+	emails, err := emailCandidates(finished)
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, emails...)
+
+	now := time.Now()
+	for _, c := range candidates {
+		period := retention(c.file.Type)
+		if c.pending || period <= 0 || now.Before(c.start.Add(period)) {
+			continue
+		}
+
+		if activeHolds.covers(c) {
+			report.Held++
+			continue
+		}
+
+		if !dryRun {
+			err = c.remove()
+			if err != nil {
+				report.Errors = append(report.Errors, c.file.Key+": "+err.Error())
+				continue
+			}
+		}
+
+		c.file.Retained = c.start.UTC().Format(time.RFC3339)
+		report.Removed = append(report.Removed, c.file)
+		report.Bytes += c.file.Size
+	}
+
+	report.Finished = *data.ConvertDate(time.Now())
+
+	report.ID, err = db.InsertPurgeReport(report)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	return report, auditService.Record(user, auditService.RetentionPurge, auditService.EntityPurgeReport, report.ID, nil,
+		map[string]interface{}{"Removed": len(report.Removed), "Bytes": report.Bytes, "Held": report.Held, "Errors": len(report.Errors)})
+}
+
+// documentCandidates lists stored driver documents, keyed documents/driverID/bookingID/name
+func documentCandidates(finished map[int]*data.FinishedBooking) ([]*candidate, error) {
+
+	objects, err := storage.List(storage.Documents)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]*candidate, 0, len(objects))
+	for _, object := range objects {
+		parts := strings.Split(strings.TrimPrefix(object.Key, storage.Documents), "/")
+		if len(parts) != 3 {
+			continue
+		}
+
+		fileType, ok := documentTypes[parts[2]]
+		if !ok {
+			continue
+		}
+
+		driverID, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		bookingID, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+
+		key := object.Key
+		c := &candidate{
+			file:   &data.PurgedFile{Type: fileType, Key: key, BookingID: bookingID, DriverID: driverID, Size: object.Size},
+			remove: func() error { return storage.Delete(key) },
+		}
+		setBooking(c, finished)
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
+
+// emailCandidates lists emails the file notifier wrote, named reference_template_created.eml. Booking emails are
+// referenced by booking ID and regulatory alerts by alert ID, or by the driver's licence number when sent before
+func emailCandidates(finished map[int]*data.FinishedBooking) ([]*candidate, error) {
+
+	files, err := ioutil.ReadDir(*notification.DropDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	alerts, err := getAlerts()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]*candidate, 0, len(files))
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() || filepath.Ext(fi.Name()) != ".eml" {
+			continue
+		}
+
+		name := filepath.Join(*notification.DropDir, fi.Name())
+		c := &candidate{
+			file:   &data.PurgedFile{Type: TypeEmail, Key: filepath.ToSlash(name), Size: fi.Size()},
+			start:  fi.ModTime(),
+			remove: func() error { return os.Remove(name) },
+		}
+
+		reference, template := splitEmailName(fi.Name())
+
+		alert, ok := alerts[reference]
+		if !ok {
+			alert, ok = alerts[template+"_"+reference]
+		}
+		if ok {
+			c.file.Type = TypeAlert
+			c.file.BookingID = alert.BookingID
+			c.file.DriverID = alert.DriverID
+		} else if strings.HasPrefix(reference, bookingReference) {
+			c.file.BookingID, _ = strconv.Atoi(strings.TrimPrefix(reference, bookingReference))
+		}
+
+		if c.file.BookingID != 0 {
+			setBooking(c, finished)
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
+
+// setBooking starts the candidate's retention from its booking finishing, marking it pending while the booking is open
+func setBooking(c *candidate, finished map[int]*data.FinishedBooking) {
+
+	booking, ok := finished[c.file.BookingID]
+	if !ok {
+		c.pending = true
+		return
+	}
+
+	c.start = booking.Finished
+	c.userID = booking.UserID
+	if c.file.DriverID == 0 {
+		c.file.DriverID = booking.DriverID
+	}
+}
+
+// splitEmailName returns the reference and template of a file notifier email, the reference is empty for
+// messages sent without one
+func splitEmailName(name string) (string, string) {
+
+	parts := strings.Split(strings.TrimSuffix(name, ".eml"), "_")
+	if len(parts) < 2 {
+		return "", ""
+	}
+	if len(parts) == 2 {
+		return "", parts[0]
+	}
+
+	return strings.Join(parts[:len(parts)-2], "_"), parts[len(parts)-2]
+}
+
+// getAlerts returns regulatory alerts keyed by the reference their emails are named with. Emails sent before
+// alerts were referenced by ID are keyed template_licence, the licence number is taken from the report sent so it
+// still matches after the driver is anonymised
+func getAlerts() (map[string]*data.RegulatoryAlert, error) {
+
+	alerts, err := db.GetRegulatoryAlerts("", 1<<30)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := map[string]string{alertService.DVLA: alertService.DVLATemplate, alertService.ABI: alertService.ABITemplate}
+
+	byName := make(map[string]*data.RegulatoryAlert)
+	for _, alert := range alerts {
+		byName[alertService.Reference(alert.ID)] = alert
+		byName[templates[alert.Authority]+"_"+notification.SafeFileName(alert.Report.LicenseNumber)] = alert
+	}
+
+	return byName, nil
+}
+
+func getActiveHolds() (holds, error) {
+
+	active, err := db.GetLegalHolds(false, 1<<30)
+	if err != nil {
+		return nil, err
+	}
+
+	h := holds{HoldUser: {}, HoldBooking: {}, HoldDriver: {}}
+	for _, hold := range active {
+		h[hold.EntityType][hold.EntityID] = true
+	}
+
+	return h, nil
+}
+
+func GetPurgeReports(user *data.User, limit string) ([]*data.PurgeReport, error) {
+
+	limitValue, err := parseLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetPurgeReports(limitValue)
+}
+
+// GetHolds returns active legal holds, or every hold including released ones when all is true
+func GetHolds(user *data.User, all, limit string) ([]*data.LegalHold, error) {
+
+	allBool := false
+	if all != "" {
+		var err error
+		allBool, err = strconv.ParseBool(all)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	limitValue, err := parseLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetLegalHolds(allBool, limitValue)
+}
+
+// PlaceHold stops the purge removing files for the user, booking or driver until the hold is released
+func PlaceHold(user *data.User, entityType, entityID, reason string) (*data.LegalHold, error) {
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ReasonRequired
+	}
+
+	id, err := strconv.Atoi(entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch entityType {
+	case HoldUser:
+		_, err = db.SelectUserByID(id)
+	case HoldBooking:
+		_, err = db.GetSingleBooking(id)
+	case HoldDriver:
+		_, err = db.GetDriverByID(id)
+	default:
+		return nil, UnknownEntity
+	}
+	if err == sql.ErrNoRows {
+		return nil, UnknownEntity
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := db.GetActiveLegalHold(entityType, id)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, AlreadyHeld
+	}
+
+	holdID, err := db.InsertLegalHold(entityType, id, reason, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	hold, err := db.GetLegalHold(holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, auditService.Record(user, auditService.LegalHoldPlace, auditService.EntityLegalHold, holdID, nil, hold)
+}
+
+// ReleaseHold lets the purge remove the held files again, any already past retention go on its next run
+func ReleaseHold(user *data.User, holdID, reason string) (*data.LegalHold, error) {
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ReasonRequired
+	}
+
+	id, err := strconv.Atoi(holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	hold, err := db.GetLegalHold(id)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, UnknownHold
+	}
+
+	released, err := db.ReleaseLegalHold(id, user.ID, reason)
+	if err != nil {
+		return nil, err
+	}
+	if !released {
+		return nil, HoldReleased
+	}
+
+	updated, err := db.GetLegalHold(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, auditService.Record(user, auditService.LegalHoldRelease, auditService.EntityLegalHold, id, hold, updated)
+}
+
+func parseLimit(limit string) (int, error) {
+
+	limitValue := defaultLimit
+	if limit != "" {
+		var err error
+		limitValue, err = strconv.Atoi(limit)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if limitValue < 1 || limitValue > maxLimit {
+		return 0, errors.New("limit out of bound")
+	}
+
+	return limitValue, nil
+}
+
+// IsUserError reports whether err is a problem with the request rather than the server
+func IsUserError(err error) bool {
+	return err == UnknownEntity || err == UnknownHold || err == AlreadyHeld || err == HoldReleased || err == ReasonRequired
+}
@@ -0,0 +1,370 @@
+package reviewService
+
+import (
+	"carHiringWebsite/ABIDataProvider"
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"carHiringWebsite/services/alertService"
+	"carHiringWebsite/services/auditService"
+	"carHiringWebsite/services/bookingService"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// KindABIMatch is a driver whose details scored between the ABI review and match thresholds, KindFailedCheck a
+	// driver blacklisted by a failed check and KindBlacklistRemoval an admin removing a blacklist outside a review
+	KindABIMatch         = "abiMatch"
+	KindFailedCheck      = "failedCheck"
+	KindBlacklistRemoval = "blacklistRemoval"
+
+	StatusPending   = "pending"
+	StatusCleared   = "cleared"
+	StatusConfirmed = "confirmed"
+
+	// Decisions an admin can make on a review. Clearing a failed check overrides it, confirming upholds it
+	DecisionClear   = "clear"
+	DecisionConfirm = "confirm"
+
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+var (
+	UnknownReview   = errors.New("unknown review")
+	UnknownStatus   = errors.New("unknown review status")
+	UnknownDecision = errors.New("unknown review decision")
+	ReviewDecided   = errors.New("review already decided")
+	ReasonRequired  = errors.New("a reason is required")
+	UnknownDriver   = errors.New("unknown driver")
+	NotBlackListed  = errors.New("driver not blacklisted")
+)
+
+// Subject identifies the driver details a review is for, so a booking re-verified with different details is checked again
+func Subject(lastName, names, address, postcode string, dob time.Time) string {
+
+	normalise := func(s string) string {
+		return strings.ToUpper(strings.Join(strings.Fields(s), " "))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{normalise(lastName), normalise(names), normalise(address),
+		strings.Join(strings.Fields(strings.ToUpper(postcode)), ""), dob.UTC().Format("2006-01-02")}, "|")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Find returns the latest review of the kind for the booking and subject, nil if there isn't one
+func Find(bookingID int, kind, subject string) (*data.DriverReview, error) {
+	return db.GetBookingDriverReview(bookingID, kind, subject)
+}
+
+// Open holds the booking for review, adding the Awaiting Driver Review status until an admin decides.
+// evidence is stored as JSON with the review
+func Open(user *data.User, review *data.DriverReview, evidence interface{}) (*data.DriverReview, error) {
+
+	evidenceJSON, err := json.Marshal(evidence)
+	if err != nil {
+		return nil, err
+	}
+
+	review.Evidence = evidenceJSON
+	review.Status = StatusPending
+	review.RaisedBy = user.ID
+	review.Created = *data.ConvertDate(time.Now())
+
+	review.ID, err = db.InsertDriverReview(review)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := db.GetBookingProcessStatus(review.BookingID, bookingService.DriverReview)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil || !status.Active {
+		_, err = db.InsertBookingStatus(review.BookingID, bookingService.DriverReview, user.ID, 1, 0.0,
+			"Awaiting Driver Review, score "+strconv.FormatFloat(review.Score, 'f', 2, 64))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = auditService.Record(user, auditService.DriverReviewOpen, auditService.EntityDriverReview, review.ID, nil, review)
+	if err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+func GetReviews(user *data.User, status, driverID, limit string) ([]*data.DriverReview, error) {
+
+	if status != "" && status != StatusPending && status != StatusCleared && status != StatusConfirmed {
+		return nil, UnknownStatus
+	}
+
+	var err error
+	driverIDValue := 0
+	if driverID != "" {
+		driverIDValue, err = strconv.Atoi(driverID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	limitValue := defaultLimit
+	if limit != "" {
+		limitValue, err = strconv.Atoi(limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if limitValue < 1 || limitValue > maxLimit {
+		return nil, errors.New("limit out of bound")
+	}
+
+	return db.GetDriverReviews(status, driverIDValue, limitValue)
+}
+
+// GetReview returns the review with the driver, the booking's latest risk report and every review of the driver
+func GetReview(user *data.User, reviewID string) (*data.DriverReviewDetail, error) {
+
+	review, err := getReview(reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &data.DriverReviewDetail{Review: review, History: make([]*data.DriverReview, 0)}
+
+	if review.DriverID != 0 {
+		detail.Driver, err = db.GetDriverByID(review.DriverID)
+		if err != nil {
+			return nil, err
+		}
+
+		detail.History, err = db.GetDriverReviews("", review.DriverID, maxLimit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if review.BookingID != 0 {
+		detail.RiskReport, err = db.GetBookingRiskReport(review.BookingID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return detail, nil
+}
+
+func getReview(reviewID string) (*data.DriverReview, error) {
+
+	reviewIDValue, err := strconv.Atoi(reviewID)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := db.GetDriverReview(reviewIDValue)
+	if err != nil {
+		return nil, err
+	}
+	if review == nil {
+		return nil, UnknownReview
+	}
+
+	return review, nil
+}
+
+// Resolve records an admin's decision on a pending review. Clearing lets the booking be verified again with
+// the same details, removing the blacklist a failed check set. Confirming a borderline ABI match blacklists the
+// driver and alerts the ABI, confirming a failed check keeps the blacklist. Either way the booking stops waiting
+func Resolve(user *data.User, reviewID, decision, reason string) (*data.DriverReview, error) {
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ReasonRequired
+	}
+
+	status := ""
+	switch decision {
+	case DecisionClear:
+		status = StatusCleared
+	case DecisionConfirm:
+		status = StatusConfirmed
+	default:
+		return nil, UnknownDecision
+	}
+
+	review, err := getReview(reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if review.Status != StatusPending {
+		return nil, ReviewDecided
+	}
+
+	driverID := review.DriverID
+	if status == StatusConfirmed {
+		driverID, err = blackList(review)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ok, err := db.ResolveDriverReview(review.ID, status, driverID, user.ID, reason)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ReviewDecided
+	}
+
+	bookingStatus, err := db.GetBookingProcessStatus(review.BookingID, bookingService.DriverReview)
+	if err != nil {
+		return nil, err
+	}
+	if bookingStatus != nil && bookingStatus.Active {
+		err = db.SetBookingStatus(bookingStatus.ID, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resolved, err := db.GetDriverReview(review.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = auditService.Record(user, auditService.DriverReviewResolve, auditService.EntityDriverReview, review.ID,
+		map[string]interface{}{"Status": review.Status},
+		map[string]interface{}{"Status": resolved.Status, "Reason": reason, "DriverID": driverID, "BookingID": review.BookingID})
+	if err != nil {
+		return nil, err
+	}
+
+	if status == StatusCleared && review.Kind == KindFailedCheck && driverID != 0 {
+		err = removeBlacklist(user, driverID, review.ID, reason)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if status == StatusConfirmed && review.Kind == KindABIMatch {
+		_, err = alertService.Raise(user, alertService.ABI, alertService.FraudulentClaim, driverID, review.BookingID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
+}
+
+// blackList blacklists the driver under review, creating them from the details in the review if they aren't known yet
+func blackList(review *data.DriverReview) (int, error) {
+
+	if review.DriverID != 0 {
+		return review.DriverID, db.BlackListedDriver(review.DriverID)
+	}
+
+	driver, err := db.GetDriverByName(review.LastName, review.Names)
+	if err != nil {
+		return 0, err
+	}
+	if driver != nil {
+		return driver.ID, db.BlackListedDriver(driver.ID)
+	}
+
+	return db.CreateDriver(review.LastName, review.Names, review.License, review.Address, review.PostCode, true,
+		review.DOB.Time, ABIDataProvider.FraudulentClaim.Error())
+}
+
+// RemoveBlacklist lets a blacklisted driver hire again, recorded as a cleared review of the driver with the reason
+func RemoveBlacklist(user *data.User, driverID, reason string) (*data.DriverReview, error) {
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ReasonRequired
+	}
+
+	driverIDValue, err := strconv.Atoi(driverID)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := db.GetDriverByID(driverIDValue)
+	if err == sql.ErrNoRows {
+		return nil, UnknownDriver
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !driver.BlackListed {
+		return nil, NotBlackListed
+	}
+
+	evidence, err := json.Marshal(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	reviewID, err := db.InsertDriverReview(&data.DriverReview{
+		Kind:     KindBlacklistRemoval,
+		DriverID: driver.ID,
+		LastName: driver.LastName,
+		Names:    driver.Names,
+		DOB:      driver.DOB,
+		Address:  driver.Address,
+		PostCode: driver.PostCode,
+		License:  driver.LicenseNumber,
+		Evidence: evidence,
+		Status:   StatusPending,
+		RaisedBy: user.ID,
+		Created:  *data.ConvertDate(time.Now()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.ResolveDriverReview(reviewID, StatusCleared, driver.ID, user.ID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	err = removeBlacklist(user, driver.ID, reviewID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetDriverReview(reviewID)
+}
+
+// removeBlacklist clears the driver's blacklist, audited against the driver with the review that decided it
+func removeBlacklist(user *data.User, driverID, reviewID int, reason string) error {
+
+	driver, err := db.GetDriverByID(driverID)
+	if err != nil {
+		return err
+	}
+
+	err = db.RemoveDriverBlacklist(driverID)
+	if err != nil {
+		return err
+	}
+
+	return auditService.Record(user, auditService.DriverBlacklistRemove, auditService.EntityDriver, driverID,
+		map[string]interface{}{"BlackListed": driver.BlackListed, "Reason": driver.Reason},
+		map[string]interface{}{"BlackListed": false, "ReviewID": reviewID, "Reason": reason})
+}
+
+// IsUserError reports whether err is a problem with the request rather than the server
+func IsUserError(err error) bool {
+	return err == UnknownReview || err == UnknownStatus || err == UnknownDecision || err == ReviewDecided || err == ReasonRequired ||
+		err == UnknownDriver || err == NotBlackListed
+}
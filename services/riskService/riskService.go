@@ -0,0 +1,331 @@
+package riskService
+
+import (
+	"carHiringWebsite/ABIDataProvider"
+	"carHiringWebsite/DVLADataProvider"
+	"carHiringWebsite/data"
+	"carHiringWebsite/db"
+	"carHiringWebsite/services/reviewService"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Checks made on every driver, in the order they run and are reported
+const (
+	CheckBlacklist = "blacklist"
+	CheckDVLA      = "dvla"
+	CheckABI       = "abi"
+)
+
+// Results of a check and the overall decision, from least to most severe. Refuse turns the driver away without
+// blacklisting them, as the details may be a mistake on the form, fail blacklists them
+const (
+	ResultPass   = "pass"
+	ResultReview = "review"
+	ResultRefuse = "refuse"
+	ResultFail   = "fail"
+)
+
+var (
+	BlackListedDriver = errors.New("blacklisted")
+
+	// DriverReviewRequired is returned when a borderline ABI match has been sent for review, DriverReviewPending
+	// when the booking is assessed again before the review has been decided
+	DriverReviewRequired = errors.New("driverReviewRequired")
+	DriverReviewPending  = errors.New("driverReviewPending")
+
+	severity = map[string]int{
+		ResultPass:   0,
+		ResultReview: 1,
+		ResultRefuse: 2,
+		ResultFail:   3,
+	}
+
+	// errs are the errors a report's Error can name, returned by Err
+	errs = make(map[string]error)
+)
+
+func init() {
+	for _, err := range []error{BlackListedDriver, DriverReviewRequired, DriverReviewPending, DVLADataProvider.InvalidLicense,
+		DVLADataProvider.NameMismatch, DVLADataProvider.DOBMismatch, DVLADataProvider.LicenseExpired,
+		DVLADataProvider.InvalidAuthority, ABIDataProvider.FraudulentClaim} {
+		errs[err.Error()] = err
+	}
+}
+
+// Assess runs every check on the driver presented for a booking ending at until and stores the report against the
+// booking. The decision is the most severe result of any check. A review decision holds the booking for an admin
+// unless one has already cleared the same details, and a fail is sent for review unless an admin has already
+// overridden it. Checks that can't be made, such as no ABI dataset, return an error
+func Assess(user *data.User, bookingID int, subject *data.RiskSubject, until time.Time) (*data.RiskReport, error) {
+
+	report := &data.RiskReport{
+		BookingID: bookingID,
+		Subject:   subject,
+		Decision:  ResultPass,
+		Checks:    make([]*data.RiskCheck, 0),
+		Thresholds: map[string]float64{
+			"abiMatch":  *ABIDataProvider.MatchThreshold,
+			"abiReview": *ABIDataProvider.ReviewThreshold,
+		},
+		AssessedBy: user.ID,
+		Assessed:   *data.ConvertDate(time.Now()),
+	}
+
+	blacklist, err := checkBlacklist(report, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	dvla, err := checkDVLA(subject, until)
+	if err != nil {
+		return nil, err
+	}
+
+	abi, claims, err := checkABI(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, check := range []*data.RiskCheck{blacklist, dvla, abi} {
+		report.Checks = append(report.Checks, check)
+
+		if severity[check.Result] > severity[report.Decision] {
+			report.Decision = check.Result
+			report.Error = check.Error
+		}
+	}
+
+	if report.Decision == ResultReview {
+		err = review(user, report, abi, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if report.Decision == ResultFail {
+		err = override(user, report)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report.ID, err = db.InsertRiskReport(report)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func checkBlacklist(report *data.RiskReport, subject *data.RiskSubject) (*data.RiskCheck, error) {
+
+	check := &data.RiskCheck{Name: CheckBlacklist, Result: ResultPass}
+
+	driver, err := db.GetDriverByName(subject.LastName, subject.Names)
+	if err != nil {
+		return nil, err
+	}
+	if driver == nil {
+		return check, nil
+	}
+
+	report.DriverID = driver.ID
+	check.Evidence = map[string]interface{}{"DriverID": driver.ID, "BlackListed": driver.BlackListed, "Reason": driver.Reason}
+
+	if driver.BlackListed {
+		check.Result, check.Score, check.Error = ResultFail, 1, BlackListedDriver.Error()
+		if driver.Reason == DVLADataProvider.InvalidLicense.Error() {
+			check.Error = DVLADataProvider.InvalidLicense.Error()
+		}
+	}
+
+	return check, nil
+}
+
+func checkDVLA(subject *data.RiskSubject, until time.Time) (*data.RiskCheck, error) {
+
+	check := &data.RiskCheck{Name: CheckDVLA, Result: ResultPass}
+
+	if license := DVLADataProvider.GetLicense(subject.License); license != nil {
+		check.Evidence = license
+	}
+
+	err := DVLADataProvider.Verify(subject.License, subject.LastName, subject.Names, subject.DOB, until)
+	switch {
+	case err == DVLADataProvider.InvalidLicense:
+		check.Result, check.Score, check.Error = ResultFail, 1, err.Error()
+	case DVLADataProvider.IsMismatch(err):
+		check.Result, check.Score, check.Error = ResultRefuse, 1, err.Error()
+	case err != nil:
+		return nil, err
+	}
+
+	return check, nil
+}
+
+func checkABI(subject *data.RiskSubject) (*data.RiskCheck, *data.ClaimMatchResult, error) {
+
+	claims, err := ABIDataProvider.MatchClaims(subject.LastName, subject.Names, subject.Address, subject.PostCode, subject.DOB)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	check := &data.RiskCheck{Name: CheckABI, Result: ResultPass, Score: claims.Score, Evidence: claims}
+
+	switch claims.Decision {
+	case ABIDataProvider.DecisionMatch:
+		check.Result, check.Error = ResultFail, ABIDataProvider.FraudulentClaim.Error()
+	case ABIDataProvider.DecisionReview:
+		check.Result, check.Error = ResultReview, DriverReviewRequired.Error()
+	}
+
+	return check, claims, nil
+}
+
+// review settles a borderline ABI match with the admin review of the same details, opening one if there isn't one yet.
+// A cleared review passes the check and a confirmed one fails it
+func review(user *data.User, report *data.RiskReport, abi *data.RiskCheck, claims *data.ClaimMatchResult) error {
+
+	subject := report.Subject
+	key := subjectKey(subject)
+
+	existing, err := reviewService.Find(report.BookingID, reviewService.KindABIMatch, key)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		report.ReviewID = existing.ID
+
+		switch existing.Status {
+		case reviewService.StatusCleared:
+			abi.Result, abi.Error = ResultPass, ""
+			report.Decision, report.Error = ResultPass, ""
+		case reviewService.StatusConfirmed:
+			abi.Result, abi.Error = ResultFail, ABIDataProvider.FraudulentClaim.Error()
+			report.Decision, report.Error = ResultFail, abi.Error
+		default:
+			abi.Error = DriverReviewPending.Error()
+			report.Error = abi.Error
+		}
+
+		return nil
+	}
+
+	opened, err := reviewService.Open(user, &data.DriverReview{
+		Kind:      reviewService.KindABIMatch,
+		Subject:   key,
+		BookingID: report.BookingID,
+		DriverID:  report.DriverID,
+		LastName:  subject.LastName,
+		Names:     subject.Names,
+		DOB:       *data.ConvertDate(subject.DOB),
+		Address:   subject.Address,
+		PostCode:  subject.PostCode,
+		License:   subject.License,
+		Score:     claims.Score,
+	}, claims)
+	if err != nil {
+		return err
+	}
+
+	report.ReviewID = opened.ID
+
+	return nil
+}
+
+// override passes a failed report when an admin has overridden the failure for the same booking and details, otherwise
+// the failure is sent for review. The driver stays blacklisted until then
+func override(user *data.User, report *data.RiskReport) error {
+
+	subject := report.Subject
+	key := subjectKey(subject)
+
+	existing, err := reviewService.Find(report.BookingID, reviewService.KindFailedCheck, key)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		report.ReviewID = existing.ID
+
+		if existing.Status == reviewService.StatusCleared {
+			report.Decision, report.Error, report.Overridden = ResultPass, "", true
+		}
+
+		return nil
+	}
+
+	opened, err := reviewService.Open(user, &data.DriverReview{
+		Kind:      reviewService.KindFailedCheck,
+		Subject:   key,
+		BookingID: report.BookingID,
+		DriverID:  report.DriverID,
+		LastName:  subject.LastName,
+		Names:     subject.Names,
+		DOB:       *data.ConvertDate(subject.DOB),
+		Address:   subject.Address,
+		PostCode:  subject.PostCode,
+		License:   subject.License,
+		Score:     1,
+	}, map[string]interface{}{"Decision": report.Decision, "Error": report.Error, "Checks": report.Checks})
+	if err != nil {
+		return err
+	}
+
+	report.ReviewID = opened.ID
+
+	return nil
+}
+
+func subjectKey(subject *data.RiskSubject) string {
+	return reviewService.Subject(subject.LastName, subject.Names, subject.Address, subject.PostCode, subject.DOB)
+}
+
+// Err returns the error the report's decision was made on, nil when the driver passed
+func Err(report *data.RiskReport) error {
+
+	if report.Decision == ResultPass {
+		return nil
+	}
+
+	err, ok := errs[report.Error]
+	if !ok {
+		return errors.New("risk assessment " + report.Decision + ": " + report.Error)
+	}
+
+	return err
+}
+
+// LinkDriver records the driver a report, and any review it was sent to, was made for once they have been created
+func LinkDriver(report *data.RiskReport, driverID int) error {
+
+	if report.DriverID == driverID {
+		return nil
+	}
+	report.DriverID = driverID
+
+	err := db.SetRiskReportDriver(report.ID, driverID)
+	if err != nil {
+		return err
+	}
+
+	if report.ReviewID != 0 {
+		return db.SetDriverReviewDriver(report.ReviewID, driverID)
+	}
+
+	return nil
+}
+
+// GetReport returns the latest report for the booking, nil if the driver hasn't been assessed
+func GetReport(user *data.User, bookingID string) (*data.RiskReport, error) {
+
+	bookingIDValue, err := strconv.Atoi(bookingID)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.GetBookingRiskReport(bookingIDValue)
+}
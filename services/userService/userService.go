@@ -1,24 +1,49 @@
 package userService
 
 import (
+	"archive/zip"
 	"carHiringWebsite/data"
 	"carHiringWebsite/db"
 	"carHiringWebsite/hash"
+	"carHiringWebsite/oidc"
+	"carHiringWebsite/roles"
+	"carHiringWebsite/services/auditService"
 	"carHiringWebsite/session"
+	"carHiringWebsite/storage"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"io"
 	"math"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ErasurePending   = "pending"
+	ErasureCompleted = "completed"
+	ErasureRejected  = "rejected"
 )
 
 var (
 	InvalidPassword       = errors.New("invalid password")
 	UsernameAlreadyExists = errors.New("username already exists")
+	ErasureAlreadyPending = errors.New("erasure already requested")
+	InvalidPhone          = errors.New("phone number must be in international format, such as +447700900123")
+
+	IdentityAccountExists   = errors.New("an account with this email already exists, sign in with your password to link it")
+	IdentityLinkedElsewhere = errors.New("this identity is already linked to another account")
 )
 
+type exportBooking struct {
+	Booking *data.Booking         `json:"booking"`
+	History []*data.BookingStatus `json:"history"`
+}
+
 func Logout(token string) error {
 	err := session.ValidateToken(token)
 	if err != nil {
@@ -139,24 +164,157 @@ func Authenticate(email, password string) (*data.OutputUser, bool, error) {
 	return outputUser, true, nil
 }
 
-func EditUser(token, userID, email, oldPassword, password, firstname, names, dobString string) (*data.OutputUser, error) {
+// OIDCLogin completes an identity provider login. The user is found by their linked identity, or created when no
+// account has their verified email. An existing account is only linked when its owner started the login signed in,
+// through OIDCLinkURL. Their role is always set from their provider groups by the admin's group mapping
+func OIDCLogin(state, cookieState, code, remoteAddr string) (*data.OutputUser, error) {
 
-	id, err := strconv.Atoi(userID)
+	claims, linkUserID, err := oidc.Exchange(state, cookieState, code)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := oidc.RoleForGroups(claims.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+
+	userID, err := db.GetUserIDByIdentity(claims.Issuer, claims.Subject)
+	if err == sql.ErrNoRows {
+		userID, err = linkIdentity(claims, email, linkUserID)
+	} else if err == nil && linkUserID != 0 && userID != linkUserID {
+		err = IdentityLinkedElsewhere
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	authUser, err := db.SelectUserByID(userID)
 	if err != nil {
 		return nil, err
 	}
+	authUser.RemoteAddr = remoteAddr
+
+	if authUser.Disabled {
+		return nil, errors.New("user is disabled")
+	}
+
+	if authUser.Role != role {
+		err = db.SetUserRole(authUser.ID, role)
+		if err != nil {
+			return nil, err
+		}
+
+		err = auditService.Record(authUser, auditService.UserRole, auditService.EntityUser, authUser.ID,
+			map[string]roles.Role{"Role": authUser.Role}, map[string]interface{}{"Role": role, "Groups": claims.Groups})
+		if err != nil {
+			return nil, err
+		}
+
+		authUser.Role = role
+	}
+
+	bag, err := session.GetByEmail(authUser.Email)
+	if err == session.InactiveSession {
+		authUser.SessionToken = session.New(authUser)
+	} else if err != nil {
+		return nil, err
+	} else {
+		authUser.SessionToken = bag.GetToken()
+		bag.UpdateUser(authUser)
+	}
+
+	return data.NewOutputUser(authUser), nil
+}
+
+// OIDCLinkURL starts a login that links the identity the user signs in with to their account, returning the
+// identity provider URL to send them to and the state for oidc.StateCookie
+func OIDCLinkURL(user *data.User) (string, string, error) {
+	return oidc.AuthCodeURL(user.ID)
+}
+
+// linkIdentity attaches the identity to linkUserID, the signed in user who started the login to link it. Otherwise
+// a user is created for the verified email, an existing account with it has to be linked by its owner
+func linkIdentity(claims *oidc.Claims, email string, linkUserID int) (int, error) {
+	var (
+		user *data.User
+		err  error
+	)
+
+	created := false
+
+	if linkUserID != 0 {
+		user, err = db.SelectUserByID(linkUserID)
+		if err != nil {
+			return 0, err
+		}
+	} else if !claims.EmailVerified || !isEmailValid(email) {
+		return 0, errors.New("identity provider did not supply a verified email")
+	} else {
+		user, err = db.SelectUserByEmail(email)
+		if err == nil {
+			return 0, IdentityAccountExists
+		}
+	}
+
+	if err == sql.ErrNoRows {
+		//The password is random, the user can only sign in through the identity provider until it is reset
+		salt, authHash, err := hash.New(uuid.New().String())
+		if err != nil {
+			return 0, err
+		}
+
+		firstName := claims.GivenName
+		if firstName == "" {
+			firstName = email
+		}
+
+		userID, err := db.CreateUser(email, firstName, claims.FamilyName, time.Unix(0, 0), salt, authHash)
+		if err != nil {
+			return 0, err
+		}
+
+		user, err = db.SelectUserByID(userID)
+		if err != nil {
+			return 0, err
+		}
+
+		created = true
+	} else if err != nil {
+		return 0, err
+	}
+
+	_, err = db.InsertUserIdentity(user.ID, claims.Issuer, claims.Subject)
+	if err != nil {
+		return 0, err
+	}
+
+	err = auditService.Record(user, auditService.UserIdentityLink, auditService.EntityUser, user.ID, nil,
+		map[string]interface{}{"Issuer": claims.Issuer, "Subject": claims.Subject, "Created": created})
+	if err != nil {
+		return 0, err
+	}
+
+	return user.ID, nil
+}
+
+func EditUser(user *data.User, userID, email, oldPassword, password, firstname, names, dobString string) (*data.OutputUser, error) {
 
-	user, err := GetUserFromSession(token)
+	id, err := strconv.Atoi(userID)
 	if err != nil {
 		return nil, err
 	}
 
-	if oldPassword == "" && !user.Admin {
+	canEdit := roles.Has(user.Role, roles.UserEdit)
+
+	if oldPassword == "" && !canEdit {
 		return nil, errors.New("old password not provided")
 	}
 
-	if id != user.ID && !user.Admin {
-		return nil, errors.New("user must be admin to do this")
+	if id != user.ID && !canEdit {
+		return nil, errors.New("user does not have permission to do this")
 	}
 
 	authUser, err := db.SelectUserByID(id)
@@ -176,7 +334,7 @@ func EditUser(token, userID, email, oldPassword, password, firstname, names, dob
 		return nil, nil
 	}
 
-	if !user.Admin {
+	if !canEdit {
 		if oldPassword == "" {
 			return nil, errors.New("old password not provided")
 		}
@@ -246,6 +404,13 @@ func EditUser(token, userID, email, oldPassword, password, firstname, names, dob
 		return nil, err
 	}
 
+	err = auditService.Record(user, auditService.UserEdit, auditService.EntityUser, id,
+		map[string]interface{}{"FirstName": authUser.FirstName, "Names": authUser.Names, "Email": authUser.Email, "DOB": authUser.DOB.Unix()},
+		map[string]interface{}{"FirstName": firstname, "Names": names, "Email": email, "DOB": dob.Unix(), "PasswordChanged": password != ""})
+	if err != nil {
+		return nil, err
+	}
+
 	newUser, err := db.SelectUserByID(id)
 	if err != nil {
 		return &data.OutputUser{}, err
@@ -366,16 +531,203 @@ func isPasswordValid(password string) bool {
 	return true
 }
 
-func GetUserFromSession(token string) (*data.User, error) {
-	err := session.ValidateToken(token)
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+
+// NormalisePhone returns the number in E.164 form. Spaces, dashes, brackets and dots are removed and a
+// leading 00 international prefix is accepted, but the country code must be given
+func NormalisePhone(phone string) (string, error) {
+
+	phone = phoneSeparators.Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+
+	if !e164.MatchString(phone) {
+		return "", InvalidPhone
+	}
+
+	return phone, nil
+}
+
+// SetPhone stores the users mobile number for SMS notifications, an empty phone removes it
+func SetPhone(user *data.User, phone string) (*data.OutputUser, error) {
+	var err error
+
+	if phone != "" {
+		phone, err = NormalisePhone(phone)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.SetUserPhone(user.ID, phone)
 	if err != nil {
 		return nil, err
 	}
 
-	bag, err := session.GetByToken(token)
+	err = auditService.Record(user, auditService.UserPhone, auditService.EntityUser, user.ID,
+		map[string]string{"Phone": user.Phone}, map[string]string{"Phone": phone})
 	if err != nil {
 		return nil, err
 	}
 
-	return bag.GetUser(), nil
+	user.Phone = phone
+
+	return data.NewOutputUser(user), nil
+}
+
+// ExportData writes a ZIP of everything held about the user to writer: their profile, bookings with
+// status history, drivers, the actions they have taken and the documents uploaded for their bookings
+func ExportData(user *data.User, writer io.Writer) error {
+
+	profile, err := db.SelectUserByID(user.ID)
+	if err != nil {
+		return err
+	}
+	outputUser := data.NewOutputUser(profile)
+	outputUser.SessionToken = ""
+
+	bookingIDs, err := db.GetUserBookingIDs(user.ID)
+	if err != nil {
+		return err
+	}
+
+	bookings := make([]*exportBooking, 0, len(bookingIDs))
+	drivers := make([]*data.Driver, 0)
+	seenDrivers := make(map[int]bool)
+	for _, bookingID := range bookingIDs {
+
+		booking, err := db.GetSingleBooking(bookingID)
+		if err != nil {
+			return err
+		}
+
+		booking.Accessories, err = db.GetBookingAccessories(bookingID)
+		if err != nil {
+			return err
+		}
+
+		history, err := db.GetBookingHistory(bookingID)
+		if err != nil {
+			return err
+		}
+
+		bookings = append(bookings, &exportBooking{Booking: booking, History: history})
+
+		driverID := int(booking.DriverID.Int32)
+		if driverID != 0 && !seenDrivers[driverID] {
+			seenDrivers[driverID] = true
+
+			driver, err := db.GetDriverByID(driverID)
+			if err != nil {
+				return err
+			}
+			drivers = append(drivers, driver)
+		}
+	}
+
+	activity, err := db.GetAuditEntries(&data.AuditFilter{ActorID: user.ID, Limit: 100000})
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(writer)
+
+	err = writeJSON(archive, "profile.json", outputUser)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "bookings.json", bookings)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "drivers.json", drivers)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(archive, "activity.json", activity)
+	if err != nil {
+		return err
+	}
+
+	for _, booking := range bookings {
+		if !booking.Booking.DriverID.Valid {
+			continue
+		}
+
+		prefix := storage.Documents + strconv.Itoa(int(booking.Booking.DriverID.Int32)) + "/" + strconv.Itoa(booking.Booking.ID) + "/"
+		err = writeStored(archive, prefix)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return err
+	}
+
+	return auditService.Record(user, auditService.UserExport, auditService.EntityUser, user.ID, nil, nil)
+}
+
+func writeJSON(archive *zip.Writer, name string, value interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+// writeStored copies the stored files under prefix into the archive, keeping their keys as paths
+func writeStored(archive *zip.Writer, prefix string) error {
+	objects, err := storage.List(prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		reader, err := storage.Get(object.Key)
+		if err != nil {
+			return err
+		}
+
+		file, err := archive.Create(object.Key)
+		if err != nil {
+			reader.Close()
+			return err
+		}
+
+		_, err = io.Copy(file, reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RequestErasure queues the users account for erasure, an admin then processes the request
+func RequestErasure(user *data.User) error {
+
+	pending, err := db.GetPendingErasureRequest(user.ID)
+	if err != nil {
+		return err
+	}
+	if pending != nil {
+		return ErasureAlreadyPending
+	}
+
+	requestID, err := db.CreateErasureRequest(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return auditService.Record(user, auditService.UserErasureRequest, auditService.EntityUser, user.ID, nil,
+		map[string]int{"RequestID": requestID})
 }
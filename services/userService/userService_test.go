@@ -0,0 +1,37 @@
+package userService
+
+import "testing"
+
+func TestNormalisePhone(t *testing.T) {
+
+	tests := []struct {
+		phone string
+		want  string
+		valid bool
+	}{
+		{"+447700900123", "+447700900123", true},
+		{" +44 7700 900123 ", "+447700900123", true},
+		{"+44-7700.900 123", "+447700900123", true},
+		{"00447700900123", "+447700900123", true},
+		{"+1 (415) 555-0100", "+14155550100", true},
+		{"+1234567", "+1234567", true},
+		{"+123456789012345", "+123456789012345", true},
+		{"+1234567890123456", "", false},
+		{"+123456", "", false},
+		{"07700900123", "", false},
+		{"447700900123", "", false},
+		{"+0447700900123", "", false},
+		{"+44 7700 90012a", "", false},
+		{"+44\n7700900123", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		got, err := NormalisePhone(test.phone)
+		if test.valid && (err != nil || got != test.want) {
+			t.Errorf("NormalisePhone(%q) = %q, %v, want %q", test.phone, got, err, test.want)
+		} else if !test.valid && err != InvalidPhone {
+			t.Errorf("NormalisePhone(%q) = %q, %v, want InvalidPhone", test.phone, got, err)
+		}
+	}
+}
@@ -49,6 +49,30 @@ func New(user *data.User) string {
 	return newBag.token
 }
 
+//NewImpersonation creates a session that lets an admin view the site as user. It expires after
+//duration regardless of activity and is never returned by GetByEmail, so the users own session is untouched
+func NewImpersonation(user *data.User, impersonatorID int, duration time.Duration, readOnly bool) string {
+	userCopy := *user
+
+	userCopy.SessionToken = uuid.New().String()
+
+	newBag := &sessionBag{
+		lock:           sync.RWMutex{},
+		token:          userCopy.SessionToken,
+		email:          userCopy.Email,
+		user:           userCopy,
+		bag:            map[string]interface{}{"impersonatedBy": impersonatorID, "readOnly": readOnly},
+		lastActive:     time.Now(),
+		impersonatorID: impersonatorID,
+		readOnly:       readOnly,
+		expires:        time.Now().Add(duration),
+	}
+
+	sessions.AddImpersonation(newBag)
+
+	return newBag.token
+}
+
 func GetByEmail(email string) (*sessionBag, error) {
 	return sessions.GetByEmail(email)
 }
@@ -23,6 +23,12 @@ func (ss *sessionStore) Add(bag *sessionBag) {
 	ss.Unlock()
 }
 
+func (ss *sessionStore) AddImpersonation(bag *sessionBag) {
+	ss.Lock()
+	ss.storeByToken[bag.token] = bag
+	ss.Unlock()
+}
+
 func (ss *sessionStore) GetByToken(token string) (*sessionBag, error) {
 	ss.RLock()
 	bag, ok := ss.storeByToken[token]
@@ -60,13 +66,15 @@ func (ss *sessionStore) Delete(bag *sessionBag) {
 	ss.Lock()
 	defer ss.Unlock()
 
-	if _, ok := ss.storeByEmail[bag.email]; ok {
+	if emailBag, ok := ss.storeByEmail[bag.email]; ok && emailBag == bag {
 		delete(ss.storeByEmail, bag.email)
 	}
 	if _, ok := ss.storeByToken[bag.token]; ok {
 		delete(ss.storeByToken, bag.token)
 	}
-	ss.count--
+	if bag.impersonatorID == 0 {
+		ss.count--
+	}
 }
 
 type sessionBag struct {
@@ -76,22 +84,31 @@ type sessionBag struct {
 	user       data.User
 	bag        map[string]interface{}
 	lastActive time.Time
+
+	impersonatorID int
+	readOnly       bool
+	expires        time.Time
 }
 
 //GetUser gives back a copy of the user object stored in the session
 func (sb *sessionBag) GetUser() *data.User {
 	sb.lock.RLock()
 	userCopy := sb.user
+	userCopy.ImpersonatorID = sb.impersonatorID
+	userCopy.ReadOnly = sb.readOnly
 	sb.lock.RUnlock()
 	return &userCopy
 }
 
-//UpdateUser replaced the current user in the session bad with the provided
+//UpdateUser replaced the current user in the session bad with the provided, returning a copy. The address of the
+//request isn't kept as requests on the same session can come from different addresses at once
 func (sb *sessionBag) UpdateUser(user *data.User) *data.User {
-	sb.lock.RLock()
+	sb.lock.Lock()
 	sb.user = *user
-	sb.lock.RUnlock()
-	return &sb.user
+	sb.user.RemoteAddr = ""
+	userCopy := sb.user
+	sb.lock.Unlock()
+	return &userCopy
 }
 
 func (sb *sessionBag) GetToken() string {
@@ -102,10 +119,16 @@ func (sb *sessionBag) GetToken() string {
 }
 
 func (sb *sessionBag) isActive() bool {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+
 	sessionDuration := time.Now().Sub(sb.lastActive)
 	if sessionDuration > sessionExpiry {
 		return false
 	}
+	if !sb.expires.IsZero() && time.Now().After(sb.expires) {
+		return false
+	}
 
 	sb.lastActive = time.Now()
 	return true
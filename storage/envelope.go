@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// Sealed files start with envelopeMagic, then the id of the key encryption key, the data key wrapped by it, and
+// the content encrypted with the data key. Both are AES-256-GCM with the nonce in front of the ciphertext
+const (
+	envelopeMagic = "BENV\x01"
+	dataKeySize   = 32
+)
+
+var (
+	// DocumentKeys are the key encryption keys for identity documents as comma separated id=base64 pairs, each
+	// key 32 bytes. The first key encrypts new documents, the rest are kept to read documents not yet rotated
+	DocumentKeys *string
+	// AllowUnencrypted lets documents be stored unencrypted when no DocumentKeys are set, and documents stored
+	// before keys were set be read until RotateKeys has encrypted them. Without it both are refused
+	AllowUnencrypted *bool
+
+	InvalidDocumentKeys = errors.New("document keys must be id=base64 pairs of 32 byte keys with unique ids")
+	UnknownDocumentKey  = errors.New("document encrypted with an unknown key")
+	DecryptFailed       = errors.New("document failed to decrypt")
+	NoDocumentKeys      = errors.New("no document keys set, identity documents would be stored unencrypted")
+	Unencrypted         = errors.New("document is not encrypted")
+
+	keys        map[string]cipher.AEAD
+	activeKeyID string
+)
+
+// RotateReport counts the documents a key rotation re-encrypted, Encrypted were stored before encryption was enabled
+type RotateReport struct {
+	Rotated   int
+	Encrypted int
+	Current   int
+}
+
+// initKeys parses DocumentKeys, documents are only stored unencrypted when none are set and that's allowed
+func initKeys() error {
+
+	keys = make(map[string]cipher.AEAD)
+	activeKeyID = ""
+
+	if len(strings.TrimSpace(*DocumentKeys)) == 0 {
+		if !*AllowUnencrypted {
+			return NoDocumentKeys
+		}
+
+		log.Println("No document keys set, identity documents are stored unencrypted")
+		return nil
+	}
+
+	for _, pair := range strings.Split(*DocumentKeys, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[0]) > 255 {
+			return InvalidDocumentKeys
+		}
+		if _, ok := keys[parts[0]]; ok {
+			return InvalidDocumentKeys
+		}
+
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(key) != 32 {
+			return InvalidDocumentKeys
+		}
+
+		keys[parts[0]], err = newGCM(key)
+		if err != nil {
+			return err
+		}
+
+		if activeKeyID == "" {
+			activeKeyID = parts[0]
+		}
+	}
+
+	log.Printf("Identity documents encrypted with key %v", activeKeyID)
+	if *AllowUnencrypted {
+		log.Println("Unencrypted identity documents are still served, run the key rotation to encrypt them")
+	}
+
+	return nil
+}
+
+// sealed reports whether files stored under key are encrypted
+func sealed(key string) bool {
+	return activeKeyID != "" && strings.HasPrefix(key, Documents)
+}
+
+// seal encrypts content with a new data key wrapped by the active key. The storage key is authenticated with the
+// content so an encrypted file can't be passed off as another
+func seal(key string, content []byte) ([]byte, error) {
+
+	dataKey := make([]byte, dataKeySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := encrypt(keys[activeKeyID], dataKey, []byte(activeKeyID))
+	if err != nil {
+		return nil, err
+	}
+
+	contentGCM, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := encrypt(contentGCM, content, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(envelopeMagic)
+	buf.WriteByte(byte(len(activeKeyID)))
+	buf.WriteString(activeKeyID)
+	buf.Write(wrapped)
+	buf.Write(ciphertext)
+
+	return buf.Bytes(), nil
+}
+
+// open decrypts a sealed file. Files without the envelope header are returned as they are if allowUnencrypted is
+// set, otherwise refused
+func open(key string, content []byte, allowUnencrypted bool) ([]byte, error) {
+
+	keyID, wrapped, ciphertext, ok := parseEnvelope(content)
+	if !ok {
+		if !allowUnencrypted {
+			return nil, Unencrypted
+		}
+		return content, nil
+	}
+
+	keyGCM, found := keys[keyID]
+	if !found {
+		return nil, UnknownDocumentKey
+	}
+
+	dataKey, err := decrypt(keyGCM, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, DecryptFailed
+	}
+
+	contentGCM, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decrypt(contentGCM, ciphertext, []byte(key))
+	if err != nil {
+		return nil, DecryptFailed
+	}
+
+	return plaintext, nil
+}
+
+// parseEnvelope splits a sealed file into its parts, ok is false when content isn't sealed
+func parseEnvelope(content []byte) (keyID string, wrapped, ciphertext []byte, ok bool) {
+
+	if !bytes.HasPrefix(content, []byte(envelopeMagic)) || len(content) < len(envelopeMagic)+1 {
+		return "", nil, nil, false
+	}
+	content = content[len(envelopeMagic):]
+
+	idLength := int(content[0])
+	wrappedLength := 12 + dataKeySize + 16
+	if len(content) < 1+idLength+wrappedLength {
+		return "", nil, nil, false
+	}
+
+	keyID = string(content[1 : 1+idLength])
+	wrapped = content[1+idLength : 1+idLength+wrappedLength]
+	ciphertext = content[1+idLength+wrappedLength:]
+
+	return keyID, wrapped, ciphertext, true
+}
+
+// RotateKeys re-encrypts every document not already encrypted with the active key, including those stored before
+// encryption was enabled. Once it finishes older keys can be removed from DocumentKeys
+func RotateKeys() (*RotateReport, error) {
+
+	if activeKeyID == "" {
+		return nil, errors.New("no document keys set to rotate to")
+	}
+
+	objects, err := store.List(Documents)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RotateReport{}
+	for _, object := range objects {
+		content, err := readAll(object.Key)
+		if err != nil {
+			return report, err
+		}
+
+		keyID, _, _, ok := parseEnvelope(content)
+		if ok && keyID == activeKeyID {
+			report.Current++
+			continue
+		}
+
+		plaintext, err := open(object.Key, content, true)
+		if err != nil {
+			return report, fmt.Errorf("%v: %v", object.Key, err)
+		}
+
+		content, err = seal(object.Key, plaintext)
+		if err != nil {
+			return report, err
+		}
+
+		_, err = store.Put(object.Key, bytes.NewReader(content))
+		if err != nil {
+			return report, err
+		}
+
+		if ok {
+			report.Rotated++
+		} else {
+			report.Encrypted++
+		}
+	}
+
+	return report, nil
+}
+
+// readAll reads a file from the store as it was stored
+func readAll(key string) ([]byte, error) {
+
+	reader, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func encrypt(gcm cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func decrypt(gcm cipher.AEAD, ciphertext, additional []byte) ([]byte, error) {
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, DecryptFailed
+	}
+
+	return gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], additional)
+}
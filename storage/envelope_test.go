@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"testing"
+)
+
+var (
+	testKeyA = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	testKeyB = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+)
+
+// setKeys sets the flags main otherwise sets and parses them
+func setKeys(documentKeys string, allowUnencrypted bool) error {
+	DocumentKeys, AllowUnencrypted = &documentKeys, &allowUnencrypted
+	return initKeys()
+}
+
+func TestInitKeys(t *testing.T) {
+
+	tests := []struct {
+		documentKeys     string
+		allowUnencrypted bool
+		want             error
+	}{
+		{"", false, NoDocumentKeys},
+		{" ", true, nil},
+		{"a=" + testKeyA, false, nil},
+		{"a=" + testKeyA + ", b=" + testKeyB, false, nil},
+		{"a=" + testKeyA + ",a=" + testKeyB, false, InvalidDocumentKeys},
+		{"a", false, InvalidDocumentKeys},
+		{"=" + testKeyA, false, InvalidDocumentKeys},
+		{"a=not base64", false, InvalidDocumentKeys},
+		{"a=" + base64.StdEncoding.EncodeToString(make([]byte, 16)), false, InvalidDocumentKeys},
+	}
+
+	for _, test := range tests {
+		err := setKeys(test.documentKeys, test.allowUnencrypted)
+		if err != test.want {
+			t.Errorf("initKeys(%q, %v) = %v, want %v", test.documentKeys, test.allowUnencrypted, err, test.want)
+		}
+	}
+
+	err := setKeys("b="+testKeyB+",a="+testKeyA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if activeKeyID != "b" {
+		t.Errorf("activeKeyID = %q, want the first key", activeKeyID)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+
+	err := setKeys("a="+testKeyA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := Documents + "1/2/license.jpg"
+	content := []byte("driving licence scan")
+
+	sealedContent, err := seal(key, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealedContent, []byte(envelopeMagic)) || bytes.Contains(sealedContent, content) {
+		t.Fatalf("sealed content isn't an envelope or holds the plaintext")
+	}
+
+	opened, err := open(key, sealedContent, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, content) {
+		t.Errorf("open = %q, want %q", opened, content)
+	}
+
+	again, err := seal(key, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again, sealedContent) {
+		t.Errorf("sealing twice gave the same ciphertext")
+	}
+}
+
+func TestOpenWrongKey(t *testing.T) {
+
+	err := setKeys("a="+testKeyA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := Documents + "1/2/license.jpg"
+	sealedContent, err := seal(key, []byte("driving licence scan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = setKeys("b="+testKeyB, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = open(key, sealedContent, false); err != UnknownDocumentKey {
+		t.Errorf("open with the key removed = %v, want UnknownDocumentKey", err)
+	}
+
+	err = setKeys("a="+testKeyB, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = open(key, sealedContent, false); err != DecryptFailed {
+		t.Errorf("open with a different key under the same id = %v, want DecryptFailed", err)
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+
+	err := setKeys("a="+testKeyA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := Documents + "1/2/license.jpg"
+	sealedContent, err := seal(key, []byte("driving licence scan"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = open(Documents+"3/4/license.jpg", sealedContent, false); err != DecryptFailed {
+		t.Errorf("open under another storage key = %v, want DecryptFailed", err)
+	}
+
+	tampered := append([]byte(nil), sealedContent...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err = open(key, tampered, false); err != DecryptFailed {
+		t.Errorf("open with the content changed = %v, want DecryptFailed", err)
+	}
+
+	tampered = append([]byte(nil), sealedContent...)
+	tampered[len(envelopeMagic)+1+len("a")] ^= 1
+	if _, err = open(key, tampered, false); err != DecryptFailed {
+		t.Errorf("open with the wrapped key changed = %v, want DecryptFailed", err)
+	}
+}
+
+func TestOpenUnencrypted(t *testing.T) {
+
+	err := setKeys("a="+testKeyA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := Documents + "1/2/license.jpg"
+	content := []byte("stored before keys were set")
+
+	if _, err = open(key, content, false); err != Unencrypted {
+		t.Errorf("open unencrypted = %v, want Unencrypted", err)
+	}
+
+	opened, err := open(key, content, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, content) {
+		t.Errorf("open unencrypted when allowed = %q, want %q", opened, content)
+	}
+}
+
+func TestRotateKeys(t *testing.T) {
+
+	store = NewLocal(t.TempDir())
+
+	plainKey := Documents + "1/2/license.jpg"
+	oldKey := Documents + "3/4/license.jpg"
+
+	_, err := store.Put(plainKey, bytes.NewReader([]byte("plain")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = setKeys("a="+testKeyA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Put(oldKey, bytes.NewReader([]byte("old")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = setKeys("b="+testKeyB+",a="+testKeyA, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := RotateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Encrypted != 1 || report.Rotated != 1 || report.Current != 0 {
+		t.Errorf("RotateKeys = %+v, want one encrypted and one rotated", report)
+	}
+
+	err = setKeys("b="+testKeyB, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{plainKey: "plain", oldKey: "old"} {
+		reader, err := Get(key)
+		if err != nil {
+			t.Fatalf("Get(%v) = %v", key, err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("Get(%v) = %q, want %q", key, content, want)
+		}
+	}
+
+	report, err = RotateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Current != 2 || report.Rotated != 0 || report.Encrypted != 0 {
+		t.Errorf("second RotateKeys = %+v, want both current", report)
+	}
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// localStore keeps files on disk, a key is the path below root
+type localStore struct {
+	root string
+}
+
+// NewLocal returns a Store for files below root, the layout used before other stores were added
+func NewLocal(root string) Store {
+	return &localStore{root: root}
+}
+
+func (ls *localStore) path(key string) (string, error) {
+
+	err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(ls.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes to a temporary file renamed over the key, so readers never see part of a file
+func (ls *localStore) Put(key string, r io.Reader) (*Object, error) {
+
+	name, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		temp.Close()
+		os.Remove(temp.Name())
+	}()
+
+	hash := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(temp, hash), r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = temp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Rename(temp.Name(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{Key: key, Size: size, Hash: hex.EncodeToString(hash.Sum(nil)), Modified: time.Now()}, nil
+}
+
+func (ls *localStore) Get(key string) (io.ReadCloser, error) {
+
+	name, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, NotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// Stat hashes the file, local files have nowhere to keep the hash from when they were stored
+func (ls *localStore) Stat(key string) (*Object, error) {
+
+	name, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) || err == nil && !fi.Mode().IsRegular() {
+		return nil, NotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{Key: key, Size: fi.Size(), Hash: hashContent(content), Modified: fi.ModTime()}, nil
+}
+
+// Delete removes the file and any directories left empty below the key's top level prefix
+func (ls *localStore) Delete(key string) error {
+
+	name, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if os.IsNotExist(err) {
+		return NotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(key, "/")
+	for i := len(parts) - 1; i > 1; i-- {
+		err = os.Remove(filepath.Join(ls.root, filepath.FromSlash(strings.Join(parts[:i], "/"))))
+		if err != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// List walks the directory holding prefix, skipping temporary files from unfinished Puts
+func (ls *localStore) List(prefix string) ([]*Object, error) {
+
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+	start := filepath.Join(ls.root, filepath.FromSlash(dir))
+
+	objects := make([]*Object, 0)
+	err := filepath.Walk(start, func(name string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || strings.HasSuffix(fi.Name(), ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(ls.root, name)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		objects = append(objects, &Object{Key: key, Size: fi.Size(), Modified: fi.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// URL links to the site's storage route, local files can't be downloaded any other way
+func (ls *localStore) URL(key string, expires time.Time) (string, error) {
+	return signedURL(key, expires)
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"log"
+	"path/filepath"
+)
+
+// MigrateReport counts the files a migration moved, Conflicts are keys left in place because the target
+// already had a different file
+type MigrateReport struct {
+	Moved     int
+	Existing  int
+	Bytes     int64
+	Conflicts []string
+}
+
+// MigrateLocal moves the documents and car images kept on disk below root into the configured store
+func MigrateLocal(root string) (*MigrateReport, error) {
+
+	if *Kind == "local" {
+		from, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		to, err := filepath.Abs(*LocalRoot)
+		if err != nil {
+			return nil, err
+		}
+
+		if from == to {
+			return nil, SameStore
+		}
+	}
+
+	return Migrate(NewLocal(root), store, []string{Documents, Cars})
+}
+
+// Migrate moves every file under prefixes from one store to another. A copy is only trusted once the target
+// reports the same hash as the source, then the source is deleted. Files the target already has with the same
+// hash are just deleted from the source, so an interrupted migration can be run again
+func Migrate(from, to Store, prefixes []string) (*MigrateReport, error) {
+
+	report := &MigrateReport{Conflicts: make([]string, 0)}
+
+	for _, prefix := range prefixes {
+		objects, err := from.List(prefix)
+		if err != nil {
+			return report, err
+		}
+
+		for _, object := range objects {
+			source, err := from.Stat(object.Key)
+			if err != nil {
+				return report, err
+			}
+
+			existing, err := to.Stat(object.Key)
+			if err != nil && err != NotFound {
+				return report, err
+			}
+
+			if existing != nil && existing.Hash != source.Hash {
+				log.Printf("Storage migration skipped %v, the target has a different file", object.Key)
+				report.Conflicts = append(report.Conflicts, object.Key)
+				continue
+			}
+
+			if existing != nil {
+				report.Existing++
+			} else {
+				err = copyObject(from, to, source)
+				if err != nil {
+					return report, err
+				}
+
+				report.Moved++
+				report.Bytes += source.Size
+			}
+
+			err = from.Delete(object.Key)
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func copyObject(from, to Store, source *Object) error {
+
+	reader, err := from.Get(source.Key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	_, err = to.Put(source.Key, reader)
+	if err != nil {
+		return err
+	}
+
+	//Checked after the write rather than trusting Put, the target hashes what it actually stored
+	copied, err := to.Stat(source.Key)
+	if err != nil {
+		return err
+	}
+	if copied.Hash != source.Hash {
+		return HashMismatch
+	}
+
+	return nil
+}
@@ -0,0 +1,413 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// hashHeader keeps the content hash with each object, S3 ETags aren't a hash of the content for every upload
+	hashHeader = "X-Amz-Meta-Sha256"
+
+	amzDateLayout   = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// s3Store keeps files in a bucket of an S3 compatible object store, addressed path style as
+// endpoint/bucket/key so it works with stand-ins such as MinIO or mockS3. Requests are signed with AWS Signature V4
+type s3Store struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func newS3FromFlags() (Store, error) {
+	return NewS3(*S3Endpoint, *S3Region, *S3Bucket, *S3AccessKey, *S3SecretKey)
+}
+
+// NewS3 returns a Store for the bucket, which must already exist
+func NewS3(endpoint, region, bucket, accessKey, secretKey string) (Store, error) {
+
+	endpointURL, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if endpointURL.Scheme == "" || endpointURL.Host == "" || bucket == "" {
+		return nil, errors.New("an S3 endpoint URL and bucket are required")
+	}
+
+	ss := &s3Store{
+		endpoint:  endpointURL,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: time.Minute},
+	}
+
+	res, err := ss.do(http.MethodHead, "", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("S3 bucket %v not available: %v", bucket, res.Status)
+	}
+
+	return ss, nil
+}
+
+// Put reads the whole file first, the payload hash is part of the signature
+func (ss *s3Store) Put(key string, r io.Reader) (*Object, error) {
+
+	err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hashContent(content)
+
+	res, err := ss.do(http.MethodPut, key, nil, content, map[string]string{hashHeader: hash})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, responseError(res)
+	}
+
+	return &Object{Key: key, Size: int64(len(content)), Hash: hash, Modified: time.Now()}, nil
+}
+
+func (ss *s3Store) Get(key string) (io.ReadCloser, error) {
+
+	err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ss.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, NotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, responseError(res)
+	}
+
+	return res.Body, nil
+}
+
+func (ss *s3Store) Stat(key string) (*Object, error) {
+
+	err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ss.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, NotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("S3 HEAD %v: %v", key, res.Status)
+	}
+
+	object := &Object{Key: key, Size: res.ContentLength, Hash: res.Header.Get(hashHeader)}
+
+	object.Modified, err = http.ParseTime(res.Header.Get("Last-Modified"))
+	if err != nil {
+		object.Modified = time.Time{}
+	}
+
+	return object, nil
+}
+
+func (ss *s3Store) Delete(key string) error {
+
+	err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	res, err := ss.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+
+	return nil
+}
+
+// listResult is the part of a ListObjectsV2 response used
+type listResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List pages through ListObjectsV2, objects listed don't include their hash
+func (ss *s3Store) List(prefix string) ([]*Object, error) {
+
+	objects := make([]*Object, 0)
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		res, err := ss.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode != http.StatusOK {
+			err = responseError(res)
+			res.Body.Close()
+			return nil, err
+		}
+
+		result := &listResult{}
+		err = xml.NewDecoder(res.Body).Decode(result)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range result.Contents {
+			objects = append(objects, &Object{Key: content.Key, Size: content.Size, Modified: content.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// URL presigns a GET for the object, the store checks the signature and expiry itself
+func (ss *s3Store) URL(key string, expires time.Time) (string, error) {
+
+	err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	seconds := int64(expires.Sub(now).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	target := ss.objectURL(key)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", ss.accessKey+"/"+ss.scope(now))
+	query.Set("X-Amz-Date", now.Format(amzDateLayout))
+	query.Set("X-Amz-Expires", strconv.FormatInt(seconds, 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		target.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + target.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", ss.signature(now, canonical))
+	target.RawQuery = canonicalQuery(query)
+
+	return target.String(), nil
+}
+
+// objectURL is the path style URL of key in the bucket, or of the bucket when key is empty
+func (ss *s3Store) objectURL(key string) *url.URL {
+
+	target := *ss.endpoint
+
+	segments := []string{ss.bucket}
+	if key != "" {
+		segments = append(segments, strings.Split(key, "/")...)
+	}
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+
+	target.RawPath = strings.TrimSuffix(target.Path, "/") + "/" + strings.Join(segments, "/")
+	target.Path, _ = url.PathUnescape(target.RawPath)
+
+	return &target
+}
+
+// do sends a request signed with the payload hash in the x-amz-content-sha256 header
+func (ss *s3Store) do(method, key string, query url.Values, body []byte, headers map[string]string) (*http.Response, error) {
+
+	now := time.Now().UTC()
+
+	target := ss.objectURL(key)
+	target.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+
+	payloadHash := hashContent(body)
+
+	signed := map[string]string{
+		"host":                 target.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format(amzDateLayout),
+	}
+	for name, value := range headers {
+		signed[strings.ToLower(name)] = value
+	}
+
+	names := make([]string, 0, len(signed))
+	for name, value := range signed {
+		names = append(names, name)
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + strings.TrimSpace(signed[name]) + "\n"
+	}
+
+	canonical := strings.Join([]string{
+		method,
+		target.EscapedPath(),
+		canonicalQuery(query),
+		canonicalHeaders,
+		strings.Join(names, ";"),
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+ss.accessKey+"/"+ss.scope(now)+
+		", SignedHeaders="+strings.Join(names, ";")+", Signature="+ss.signature(now, canonical))
+
+	return ss.client.Do(req)
+}
+
+func (ss *s3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + ss.region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request as described for AWS Signature Version 4
+func (ss *s3Store) signature(now time.Time, canonical string) string {
+
+	canonicalHash := sha256.Sum256([]byte(canonical))
+
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format(amzDateLayout) + "\n" + ss.scope(now) + "\n" +
+		hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+ss.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, ss.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+// canonicalQuery sorts and encodes query parameters the way Signature V4 expects
+func canonicalQuery(query url.Values) string {
+
+	pairs := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name)+"="+uriEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent encodes everything but the unreserved characters of RFC 3986
+func uriEncode(s string) string {
+
+	var encoded strings.Builder
+	for _, b := range []byte(s) {
+		if b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '-' || b == '_' || b == '.' || b == '~' {
+			encoded.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&encoded, "%%%02X", b)
+	}
+
+	return encoded.String()
+}
+
+// responseError reads the S3 error document from a failed request
+func responseError(res *http.Response) error {
+
+	s3Error := &struct {
+		Code    string
+		Message string
+	}{}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if xml.Unmarshal(body, s3Error) != nil || s3Error.Code == "" {
+		return fmt.Errorf("S3 %v %v: %v", res.Request.Method, res.Request.URL.Path, res.Status)
+	}
+
+	return fmt.Errorf("S3 %v %v: %v %v", res.Request.Method, res.Request.URL.Path, s3Error.Code, s3Error.Message)
+}
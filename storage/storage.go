@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefixes of the keys files are stored under
+const (
+	Documents = "documents/"
+	Cars      = "cars/"
+)
+
+var (
+	// Kind selects the Store, local to keep files on disk under LocalRoot or s3 for an S3 compatible
+	// object store. Set from flags in main, with the settings below
+	Kind      *string
+	LocalRoot *string
+
+	S3Endpoint  *string
+	S3Region    *string
+	S3Bucket    *string
+	S3AccessKey *string
+	S3SecretKey *string
+
+	// SigningKey signs download URLs served by the local store, a random key is used when empty so URLs
+	// stop working on restart. URLExpiry is how long download URLs are valid for
+	SigningKey *string
+	URLExpiry  *time.Duration
+
+	NotFound     = errors.New("file not found")
+	InvalidKey   = errors.New("invalid storage key")
+	UnknownStore = errors.New("unknown storage kind")
+	InvalidURL   = errors.New("invalid or expired download URL")
+	HashMismatch = errors.New("stored file hash mismatch")
+	SameStore    = errors.New("files are already in the configured store")
+
+	store      Store
+	signingKey []byte
+
+	stores = map[string]func() (Store, error){
+		"local": func() (Store, error) { return NewLocal(*LocalRoot), nil },
+		"s3":    newS3FromFlags,
+	}
+)
+
+// Object describes a stored file, Hash is the hex SHA-256 of its content
+type Object struct {
+	Key      string
+	Size     int64
+	Hash     string
+	Modified time.Time
+}
+
+// Store keeps files by key, a slash separated path such as documents/1/2/license.jpg
+type Store interface {
+	// Put stores everything read from r under key, replacing any file already there
+	Put(key string, r io.Reader) (*Object, error)
+	// Get opens the file, NotFound if there isn't one
+	Get(key string) (io.ReadCloser, error)
+	Stat(key string) (*Object, error)
+	Delete(key string) error
+	// List returns every file whose key starts with prefix
+	List(prefix string) ([]*Object, error)
+	// URL returns a link the file can be downloaded from until expires
+	URL(key string, expires time.Time) (string, error)
+}
+
+func InitStore() error {
+
+	constructor, ok := stores[*Kind]
+	if !ok {
+		return UnknownStore
+	}
+
+	signingKey = []byte(*SigningKey)
+	if len(signingKey) == 0 {
+		signingKey = make([]byte, 32)
+		_, err := rand.Read(signingKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := initKeys()
+	if err != nil {
+		return err
+	}
+
+	newStore, err := constructor()
+	if err != nil {
+		return err
+	}
+	store = newStore
+
+	log.Printf("Files stored using %v store", *Kind)
+
+	return nil
+}
+
+// Key joins parts into a key, refusing parts that would escape the prefix they're joined under
+func Key(parts ...string) (string, error) {
+
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, "/\\") {
+			return "", InvalidKey
+		}
+	}
+
+	return strings.Join(parts, "/"), nil
+}
+
+// cleanKey checks a key is relative and has no . or .. elements
+func cleanKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.Contains(key, "\\") ||
+		strings.HasPrefix(key, "../") || key == ".." {
+		return InvalidKey
+	}
+
+	return nil
+}
+
+// Put stores the file, encrypting identity documents when document keys are set
+func Put(key string, r io.Reader) (*Object, error) {
+
+	if !sealed(key) {
+		return store.Put(key, r)
+	}
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err = seal(key, content)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Put(key, bytes.NewReader(content))
+}
+
+// Get opens the file, decrypting it if it was encrypted when stored
+func Get(key string) (io.ReadCloser, error) {
+
+	if !strings.HasPrefix(key, Documents) {
+		return store.Get(key)
+	}
+
+	content, err := readAll(key)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err = open(key, content, *AllowUnencrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+func Stat(key string) (*Object, error) {
+	return store.Stat(key)
+}
+
+func Delete(key string) error {
+	return store.Delete(key)
+}
+
+func List(prefix string) ([]*Object, error) {
+	return store.List(prefix)
+}
+
+// DeletePrefix deletes every file whose key starts with prefix
+func DeletePrefix(prefix string) error {
+
+	objects, err := store.List(prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		err = store.Delete(object.Key)
+		if err != nil && err != NotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// URL returns a download link for the file valid for URLExpiry. Identity documents are always linked through the
+// site's storage route, the store only has them encrypted
+func URL(key string) (string, time.Time, error) {
+
+	expires := time.Now().Add(*URLExpiry)
+
+	if strings.HasPrefix(key, Documents) {
+		link, err := signedURL(key, expires)
+		return link, expires, err
+	}
+
+	link, err := store.URL(key, expires)
+
+	return link, expires, err
+}
+
+// Verify checks a signature made by signedURL for key is valid and hasn't expired
+func Verify(key, expires, signature string) error {
+
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return InvalidURL
+	}
+	if time.Now().Unix() > expiresUnix {
+		return InvalidURL
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return InvalidURL
+	}
+
+	if !hmac.Equal(expected, sign(key, expiresUnix)) {
+		return InvalidURL
+	}
+
+	return nil
+}
+
+// signedURL links to the site's storage route, which checks the signature before serving the file
+func signedURL(key string, expires time.Time) (string, error) {
+
+	err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", hex.EncodeToString(sign(key, expires.Unix())))
+
+	link := &url.URL{Path: "/storage/" + key, RawQuery: query.Encode()}
+
+	return link.String(), nil
+}
+
+func sign(key string, expires int64) []byte {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+
+	return mac.Sum(nil)
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}